@@ -0,0 +1,232 @@
+package apispec
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Nullable             bool               `yaml:"nullable"`
+	Enum                 []any              `yaml:"enum"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	AdditionalProperties *Additional        `yaml:"additionalProperties"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MaxLength            *int               `yaml:"maxLength"`
+}
+
+// Additional is additionalProperties: false, or the schema the values of
+// properties not listed must match.
+type Additional struct {
+	Forbidden bool
+	Schema    *Schema
+}
+
+func (a *Additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		a.Forbidden = !allowed
+
+		return nil
+	}
+
+	return node.Decode(&a.Schema) //nolint:wrapcheck
+}
+
+const refPrefix = "#/components/schemas/"
+
+func (s *Spec) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.schemas[strings.TrimPrefix(schema.Ref, refPrefix)]
+	}
+
+	return schema
+}
+
+// checkRefs fails on a $ref that does not name a component schema.
+func (s *Spec) checkRefs(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+
+	if schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, refPrefix)
+		if _, found := s.schemas[name]; !ok || !found {
+			return fmt.Errorf("unresolved $ref %q", schema.Ref)
+		}
+
+		return nil
+	}
+
+	children := []*Schema{schema.Items}
+	for _, p := range schema.Properties {
+		children = append(children, p)
+	}
+
+	if schema.AdditionalProperties != nil {
+		children = append(children, schema.AdditionalProperties.Schema)
+	}
+
+	for _, c := range children {
+		if err := s.checkRefs(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks a value decoded from JSON with UseNumber; at names where
+// it is in the document for the error message.
+func (s *Spec) validate(schema *Schema, v any, at string) error {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if v == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+
+		return mismatch(at, "must not be null")
+	}
+
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(e any) bool {
+		return fmt.Sprint(e) == fmt.Sprint(v)
+	}) {
+		return mismatch(at, "want one of %v", schema.Enum)
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return mismatch(at, "want an object")
+		}
+
+		return s.validateObject(schema, obj, at)
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return mismatch(at, "want an array")
+		}
+
+		for i, item := range arr {
+			if err := s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return mismatch(at, "want a string")
+		}
+
+		return validateString(schema, str, at)
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch(at, "want a %s", schema.Type)
+		}
+
+		return validateNumber(schema, n, at)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch(at, "want a boolean")
+		}
+	}
+
+	return nil
+}
+
+func (s *Spec) validateObject(schema *Schema, obj map[string]any, at string) error {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			return mismatch(at+"."+name, "is required")
+		}
+	}
+
+	for name, v := range obj {
+		prop, ok := schema.Properties[name]
+
+		switch {
+		case ok:
+		case schema.AdditionalProperties == nil:
+			continue
+		case schema.AdditionalProperties.Forbidden:
+			return mismatch(at+"."+name, "is not a known property")
+		default:
+			prop = schema.AdditionalProperties.Schema
+		}
+
+		if err := s.validate(prop, v, at+"."+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateString(schema *Schema, str, at string) error {
+	if schema.MaxLength != nil && utf8.RuneCountInString(str) > *schema.MaxLength {
+		return mismatch(at, "longer than %d characters", *schema.MaxLength)
+	}
+
+	switch schema.Format {
+	case "uuid":
+		if _, err := uuid.Parse(str); err != nil {
+			return mismatch(at, "want a UUID")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return mismatch(at, "want an RFC 3339 date-time")
+		}
+	}
+
+	return nil
+}
+
+func validateNumber(schema *Schema, n json.Number, at string) error {
+	f, err := n.Float64()
+	if err != nil {
+		return mismatch(at, "want a %s", schema.Type)
+	}
+
+	if schema.Type == "integer" {
+		if _, err := strconv.ParseInt(n.String(), 10, 64); err != nil {
+			return mismatch(at, "want an integer")
+		}
+	}
+
+	if schema.Minimum != nil && f < *schema.Minimum {
+		return mismatch(at, "less than %v", *schema.Minimum)
+	}
+
+	if schema.Maximum != nil && f > *schema.Maximum {
+		return mismatch(at, "greater than %v", *schema.Maximum)
+	}
+
+	return nil
+}
+
+func mismatch(at, format string, args ...any) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalid, at, fmt.Sprintf(format, args...))
+}
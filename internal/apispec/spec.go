@@ -0,0 +1,195 @@
+// Package apispec loads the OpenAPI document and checks requests and
+// responses against it. It understands the part of OpenAPI 3.0 that
+// schema.yaml uses: path, query and header parameters, JSON bodies, and schemas built
+// from type, format, enum, nullable, properties, required, items,
+// additionalProperties, minimum, maximum, maxLength and $ref.
+package apispec
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalid matches, with errors.Is, every mismatch between a request or
+// response and the spec.
+var ErrInvalid = errors.New("does not match the API spec")
+
+type Spec struct {
+	operations map[Route]*Operation
+	schemas    map[string]*Schema
+}
+
+// Route is an operation of the spec; Path is in OpenAPI form, /api/orders/{id}.
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+type document struct {
+	Paths      map[string]pathItem `yaml:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type pathItem struct {
+	Get    *Operation `yaml:"get"`
+	Put    *Operation `yaml:"put"`
+	Post   *Operation `yaml:"post"`
+	Delete *Operation `yaml:"delete"`
+	Patch  *Operation `yaml:"patch"`
+}
+
+func (p pathItem) operations() map[string]*Operation {
+	return map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	}
+}
+
+type Operation struct {
+	spec *Spec
+
+	Parameters  []Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody        `yaml:"requestBody"`
+	Responses   map[string]Response `yaml:"responses"`
+	Deprecated  bool                `yaml:"deprecated"`
+}
+
+type Parameter struct {
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Content map[string]MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Load parses an OpenAPI document and checks that every $ref in it resolves.
+func Load(data []byte) (*Spec, error) {
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+
+	s := &Spec{
+		operations: make(map[Route]*Operation),
+		schemas:    doc.Components.Schemas,
+	}
+
+	for name, schema := range s.schemas {
+		if err := s.checkRefs(schema); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method, op := range item.operations() {
+			if op == nil {
+				continue
+			}
+
+			route := Route{Method: method, Path: path}
+			if err := s.checkOperation(op); err != nil {
+				return nil, fmt.Errorf("%s: %w", route, err)
+			}
+
+			op.spec = s
+			s.operations[route] = op
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Spec) checkOperation(op *Operation) error {
+	var schemas []*Schema
+
+	for _, p := range op.Parameters {
+		if p.In != "path" && p.In != "query" && p.In != "header" {
+			return fmt.Errorf("parameter %s: unsupported location %q", p.Name, p.In)
+		}
+
+		schemas = append(schemas, p.Schema)
+	}
+
+	if op.RequestBody != nil {
+		for _, m := range op.RequestBody.Content {
+			schemas = append(schemas, m.Schema)
+		}
+	}
+
+	for _, r := range op.Responses {
+		for _, m := range r.Content {
+			schemas = append(schemas, m.Schema)
+		}
+	}
+
+	for _, schema := range schemas {
+		if err := s.checkRefs(schema); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Routes lists the operations of the spec, sorted by path and method.
+func (s *Spec) Routes() []Route {
+	routes := make([]Route, 0, len(s.operations))
+	for r := range s.operations {
+		routes = append(routes, r)
+	}
+
+	slices.SortFunc(routes, func(a, b Route) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Method, b.Method)
+	})
+
+	return routes
+}
+
+// Operation finds the operation for a method and an OpenAPI path.
+func (s *Spec) Operation(method, path string) (*Operation, bool) {
+	op, ok := s.operations[Route{Method: method, Path: path}]
+
+	return op, ok
+}
+
+// PathFromGin turns a gin route, /api/orders/:id, into the OpenAPI form.
+func PathFromGin(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if name, ok := strings.CutPrefix(p, ":"); ok {
+			parts[i] = "{" + name + "}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,197 @@
+package apispec
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	merchshop "github.com/6ermvH/MerchShop"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+openapi: 3.0.0
+paths:
+  /items/{id}: &item
+    post:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+            format: uuid
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 10
+        - name: sort
+          in: query
+          schema:
+            type: string
+            enum: [asc, desc]
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Item'
+      responses:
+        '201':
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Item'
+        '204':
+          description: No body.
+  /v2/items/{id}: *item
+components:
+  schemas:
+    Item:
+      type: object
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          maxLength: 5
+        count:
+          type: integer
+        tags:
+          type: array
+          items:
+            type: string
+        seenAt:
+          type: string
+          format: date-time
+          nullable: true
+      required:
+        - name
+`
+
+const itemID = "5f0c6c5e-7d3c-4f57-9a43-3f1f0a9e52a1"
+
+func loadTest(t *testing.T) *Operation {
+	t.Helper()
+
+	spec, err := Load([]byte(testSpec))
+	require.NoError(t, err)
+
+	op, ok := spec.Operation(http.MethodPost, "/items/{id}")
+	require.True(t, ok)
+
+	return op
+}
+
+func TestLoad_Schema(t *testing.T) {
+	spec, err := Load(merchshop.Schema)
+	require.NoError(t, err)
+
+	routes := spec.Routes()
+	require.Contains(t, routes, Route{Method: http.MethodPost, Path: "/api/v2/purchases"})
+	require.Contains(t, routes, Route{Method: http.MethodGet, Path: "/api/v2/orders"})
+
+	op, ok := spec.Operation(http.MethodGet, "/api/buy/{item}")
+	require.True(t, ok)
+	require.True(t, op.Deprecated)
+}
+
+func TestLoad_AliasedPaths(t *testing.T) {
+	spec, err := Load([]byte(testSpec))
+	require.NoError(t, err)
+
+	require.Equal(t, []Route{
+		{Method: http.MethodPost, Path: "/items/{id}"},
+		{Method: http.MethodPost, Path: "/v2/items/{id}"},
+	}, spec.Routes())
+}
+
+func TestLoad_UnresolvedRef(t *testing.T) {
+	broken := strings.Replace(testSpec, "schemas/Item'\n        '204'", "schemas/Nope'\n        '204'", 1)
+
+	_, err := Load([]byte(broken))
+	require.ErrorContains(t, err, "unresolved $ref")
+}
+
+func TestValidateRequest(t *testing.T) {
+	op := loadTest(t)
+
+	cases := []struct {
+		name  string
+		id    string
+		query string
+		body  string
+		ok    bool
+	}{
+		{name: "valid", id: itemID, query: "limit=3&sort=asc", body: `{"name":"mug","tags":["a"]}`, ok: true},
+		{name: "null allowed", id: itemID, body: `{"name":"mug","seenAt":null}`, ok: true},
+		{name: "bad uuid", id: "42", body: `{"name":"mug"}`},
+		{name: "limit not integer", id: itemID, query: "limit=x", body: `{"name":"mug"}`},
+		{name: "limit too large", id: itemID, query: "limit=11", body: `{"name":"mug"}`},
+		{name: "sort not in enum", id: itemID, query: "sort=up", body: `{"name":"mug"}`},
+		{name: "no body", id: itemID},
+		{name: "not json", id: itemID, body: `{"name":`},
+		{name: "trailing data", id: itemID, body: `{"name":"mug"} {}`},
+		{name: "missing required", id: itemID, body: `{"count":1}`},
+		{name: "unknown property", id: itemID, body: `{"name":"mug","colour":"red"}`},
+		{name: "too long", id: itemID, body: `{"name":"teapot"}`},
+		{name: "wrong type", id: itemID, body: `{"name":"mug","count":"1"}`},
+		{name: "fraction for integer", id: itemID, body: `{"name":"mug","count":1.5}`},
+		{name: "bad item", id: itemID, body: `{"name":"mug","tags":[1]}`},
+		{name: "bad date-time", id: itemID, body: `{"name":"mug","seenAt":"yesterday"}`},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			target := "/items/" + cse.id + "?" + cse.query
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(cse.body))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+			err := op.ValidateRequest(req, map[string]string{"id": cse.id})
+			if cse.ok {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.ErrorIs(t, err, ErrInvalid)
+		})
+	}
+}
+
+func TestValidateRequest_KeepsBody(t *testing.T) {
+	op := loadTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/items/"+itemID, strings.NewReader(`{"name":"mug"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	require.NoError(t, op.ValidateRequest(req, map[string]string{"id": itemID}))
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"mug"}`, string(body))
+}
+
+func TestValidateResponse(t *testing.T) {
+	op := loadTest(t)
+
+	require.NoError(t, op.ValidateResponse(http.StatusCreated, "application/json", []byte(`{"name":"mug"}`)))
+	require.NoError(t, op.ValidateResponse(http.StatusNoContent, "", nil))
+
+	for name, check := range map[string]error{
+		"undocumented status": op.ValidateResponse(http.StatusOK, "application/json", []byte(`{}`)),
+		"bad body":            op.ValidateResponse(http.StatusCreated, "application/json", []byte(`{}`)),
+		"wrong content type":  op.ValidateResponse(http.StatusCreated, "text/plain", []byte(`mug`)),
+		"unexpected body":     op.ValidateResponse(http.StatusNoContent, "application/json", []byte(`{}`)),
+	} {
+		require.ErrorIs(t, check, ErrInvalid, name)
+	}
+}
+
+func TestPathFromGin(t *testing.T) {
+	require.Equal(t, "/api/users/{username}/stats", PathFromGin("/api/users/:username/stats"))
+	require.Equal(t, "/api/orders", PathFromGin("/api/orders"))
+}
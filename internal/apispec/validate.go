@@ -0,0 +1,175 @@
+package apispec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const jsonContentType = "application/json"
+
+// ValidateRequest checks the parameters and the JSON body of r; pathParams
+// are the values the router matched. The body is read and put back.
+func (op *Operation) ValidateRequest(r *http.Request, pathParams map[string]string) error {
+	query := r.URL.Query()
+
+	for _, p := range op.Parameters {
+		var (
+			raw   string
+			found bool
+		)
+
+		switch p.In {
+		case "path":
+			raw, found = pathParams[p.Name]
+		case "header":
+			found = len(r.Header.Values(p.Name)) > 0
+			raw = r.Header.Get(p.Name)
+		default:
+			found = query.Has(p.Name)
+			raw = query.Get(p.Name)
+		}
+
+		if !found {
+			if p.Required {
+				return mismatch(p.In+" parameter "+p.Name, "is required")
+			}
+
+			continue
+		}
+
+		if err := op.spec.validateParam(p, raw); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return mismatch("body", "is required")
+		}
+
+		return nil
+	}
+
+	media, ok := op.RequestBody.Content[mediaType(r.Header.Get("Content-Type"))]
+	if !ok {
+		return mismatch("body", "unsupported content type %q", r.Header.Get("Content-Type"))
+	}
+
+	return op.spec.validateJSON(media.Schema, body, "body")
+}
+
+// ValidateResponse checks that status is documented for the operation and
+// that body matches its schema.
+func (op *Operation) ValidateResponse(status int, contentType string, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%w: status %d is not documented", ErrInvalid, status)
+		}
+	}
+
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%w: status %d has no body", ErrInvalid, status)
+		}
+
+		return nil
+	}
+
+	media, ok := resp.Content[mediaType(contentType)]
+	if !ok {
+		return fmt.Errorf("%w: status %d: unexpected content type %q", ErrInvalid, status, contentType)
+	}
+
+	if mediaType(contentType) != jsonContentType {
+		return nil
+	}
+
+	if err := op.spec.validateJSON(media.Schema, body, "response"); err != nil {
+		return fmt.Errorf("status %d: %w", status, err)
+	}
+
+	return nil
+}
+
+// HasJSONResponses reports whether some response of the operation is JSON,
+// so that its body is worth keeping for ValidateResponse.
+func (op *Operation) HasJSONResponses() bool {
+	for _, r := range op.Responses {
+		if _, ok := r.Content[jsonContentType]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Spec) validateJSON(schema *Schema, data []byte, at string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return mismatch(at, "is not valid JSON")
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return mismatch(at, "has data after the JSON value")
+	}
+
+	return s.validate(schema, v, at)
+}
+
+// validateParam parses a path or query parameter as its schema's type.
+func (s *Spec) validateParam(p Parameter, raw string) error {
+	at := p.In + " parameter " + p.Name
+	schema := s.resolve(p.Schema)
+
+	if schema == nil {
+		return nil
+	}
+
+	var v any
+
+	switch schema.Type {
+	case "integer", "number":
+		v = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return mismatch(at, "want a boolean")
+		}
+
+		v = b
+	default:
+		v = raw
+	}
+
+	return s.validate(schema, v, at)
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+
+	return t
+}
@@ -0,0 +1,249 @@
+// Package app wires the API service together, so that cmd/api and the
+// end-to-end tests start it the same way.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	merchshop "github.com/6ermvH/MerchShop"
+	"github.com/6ermvH/MerchShop/internal/apispec"
+	"github.com/6ermvH/MerchShop/internal/db"
+	"github.com/6ermvH/MerchShop/internal/events"
+	"github.com/6ermvH/MerchShop/internal/http/handlers"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/infocache"
+	"github.com/6ermvH/MerchShop/internal/jobs"
+	"github.com/6ermvH/MerchShop/internal/jwtutil"
+	"github.com/6ermvH/MerchShop/internal/logx"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/6ermvH/MerchShop/internal/repo/memory"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// shutdownTimeout is how long Run waits for requests in flight on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// recentWritesMargin is added to ReplicaMaxLag for how long a user's own
+// history reads go to the primary after a change, covering the time from the
+// commit to the change being noticed.
+const recentWritesMargin = 2 * time.Second
+
+// MemoryDatabaseURL as DATABASE_URL keeps all data in process memory
+// instead of Postgres; it is lost on restart and not shared between instances.
+const MemoryDatabaseURL = "memory://"
+
+type App struct {
+	cfg Config
+	// pool is nil when the app runs on the in-memory repo.
+	pool *pgxpool.Pool
+	// replica is nil without Config.ReplicaURL.
+	replica *pgxpool.Pool
+	repo    repo.MerchRepo
+	broker  *events.Broker
+	spec    *apispec.Spec
+	router  *gin.Engine
+	// stopStreams closes streamsDone, ending the open event streams; Run
+	// calls it on shutdown.
+	stopStreams context.CancelFunc
+	streamsDone <-chan struct{}
+	// specMismatch gets the responses that do not match the spec while
+	// Config.ValidateResponses is on.
+	specMismatch func(*gin.Context, error)
+}
+
+// New connects to the database and builds the routes; nothing runs until
+// Start or Run. Close releases the database connections.
+func New(ctx context.Context, cfg Config) (*App, error) {
+	spec, err := apispec.Load(merchshop.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("load the API spec: %w", err)
+	}
+
+	lg := logx.FromContext(ctx)
+	streams, stopStreams := context.WithCancel(context.Background())
+	a := &App{
+		cfg:         cfg,
+		spec:        spec,
+		stopStreams: stopStreams,
+		streamsDone: streams.Done(),
+		specMismatch: func(c *gin.Context, err error) {
+			lg.Warn(c.Request.Context(), "response does not match the API spec", "err", err)
+		},
+	}
+
+	if cfg.DatabaseURL == MemoryDatabaseURL {
+		a.broker = events.NewBroker(nil, nil)
+		a.repo = memory.New(
+			memory.WithTransferRules(cfg.TransferRules...),
+			memory.WithCoinTTL(cfg.CoinTTL),
+			memory.WithEventSink(a.broker.Publish),
+		)
+		a.router = a.routes()
+
+		return a, nil
+	}
+
+	pool, err := db.NewPool(ctx, cfg.DatabaseURL, cfg.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+
+	a.pool = pool
+	opts := []repo.Option{
+		repo.WithTransferRules(cfg.TransferRules...),
+		repo.WithCoinTTL(cfg.CoinTTL),
+	}
+
+	if cfg.ReplicaURL != "" {
+		if a.replica, err = db.NewPool(ctx, cfg.ReplicaURL, cfg.Pool); err != nil {
+			pool.Close()
+
+			return nil, fmt.Errorf("failed to connect to the Postgres replica: %w", err)
+		}
+
+		opts = append(opts, repo.WithReplica(a.replica, cfg.ReplicaMaxLag))
+	}
+
+	pgRepo := repo.NewRepo(pool, opts...)
+
+	if _, err := pgRepo.BackfillCoinLots(ctx); err != nil {
+		a.Close()
+
+		return nil, fmt.Errorf("failed to backfill coin lots: %w", err)
+	}
+
+	a.repo = pgRepo
+	a.broker = events.NewBroker(events.PoolConnect(pool), a.repo)
+	a.router = a.routes()
+
+	return a, nil
+}
+
+func (a *App) routes() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+
+	r := gin.New()
+	r.Use(gin.Logger(), gin.Recovery(), middleware.RequestId())
+
+	if a.cfg.ValidateResponses {
+		r.Use(middleware.ValidateResponse(a.spec, func(c *gin.Context, err error) {
+			a.specMismatch(c, err)
+		}))
+	}
+
+	r.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	opts := []handlers.Option{
+		handlers.WithTransferCategories(a.cfg.TransferCategories...),
+		handlers.WithOrderCancelWindow(a.cfg.OrderCancelWindow),
+		handlers.WithPendingTransferTTL(a.cfg.PendingTransferTTL),
+		handlers.WithEventStream(a.broker),
+		handlers.WithStreamsDone(a.streamsDone),
+		handlers.WithSpec(a.spec),
+	}
+
+	if a.cfg.InfoCacheTTL > 0 {
+		cache := infocache.New(a.cfg.InfoCacheTTL, 0)
+		a.broker.Watch(cache.Invalidate)
+		opts = append(opts, handlers.WithInfoCache(cache))
+	}
+
+	if a.replica != nil {
+		recent := repo.NewRecentWrites(a.cfg.ReplicaMaxLag + recentWritesMargin)
+		a.broker.Watch(recent.Watch)
+		opts = append(opts, handlers.WithRecentWrites(recent))
+	}
+
+	hs := jwtutil.NewHS256(a.cfg.JWTSecret, a.cfg.JWTIssuer, a.cfg.JWTAudience)
+	api := handlers.NewAPI(a.repo, hs, opts...)
+	api.RegisterRoutes(r)
+
+	return r
+}
+
+// Handler serves the API.
+func (a *App) Handler() http.Handler {
+	return a.router
+}
+
+// Start runs the event broker and the background jobs until ctx is done.
+// The in-memory repo hands events to the broker itself, so there only the
+// pruning of old events has to run.
+func (a *App) Start(ctx context.Context) {
+	if a.pool != nil {
+		go a.broker.Run(ctx)
+	} else {
+		go jobs.Every(ctx, "prune events", time.Hour, func(ctx context.Context) (int64, error) {
+			return a.repo.DeleteEventsBefore(ctx, time.Now().Add(-events.Retention))
+		})
+	}
+
+	go jobs.Every(ctx, "expire pending transfers", time.Minute, a.repo.ExpireTransfers)
+	go jobs.Every(ctx, "expire coins", time.Hour, a.repo.ExpireCoinLots)
+	go jobs.Every(
+		ctx,
+		"run scheduled transfers",
+		15*time.Second, //nolint:mnd
+		a.repo.RunDueScheduledTransfers,
+	)
+}
+
+// Run starts the app and serves HTTP on the configured port until ctx is
+// done, then lets the requests in flight finish.
+func (a *App) Run(ctx context.Context) error {
+	a.Start(ctx)
+
+	srv := &http.Server{
+		Addr:              ":" + a.cfg.Port,
+		Handler:           a.router,
+		ReadHeaderTimeout: 5 * time.Second, //nolint:mnd
+	}
+	// Shutdown waits for handlers to return, and event streams only return
+	// when told to.
+	srv.RegisterOnShutdown(a.stopStreams)
+
+	errc := make(chan error, 1)
+
+	go func() {
+		logx.FromContext(ctx).Info(ctx, "http server starting", "addr", srv.Addr)
+
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("http server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shut down http server: %w", err)
+	}
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server stopped: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the database connections.
+func (a *App) Close() {
+	a.stopStreams()
+
+	if a.pool != nil {
+		a.pool.Close()
+	}
+
+	if a.replica != nil {
+		a.replica.Close()
+	}
+}
@@ -0,0 +1,26 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/apispec"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoutesMatchSpec fails when a route is served but not documented in
+// schema.yaml, or documented but not served.
+func TestRoutesMatchSpec(t *testing.T) {
+	t.Parallel()
+
+	a, err := New(context.Background(), Config{DatabaseURL: MemoryDatabaseURL, JWTSecret: "secret"})
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+
+	var served []apispec.Route
+	for _, r := range a.router.Routes() {
+		served = append(served, apispec.Route{Method: r.Method, Path: apispec.PathFromGin(r.Path)})
+	}
+
+	require.ElementsMatch(t, a.spec.Routes(), served)
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/6ermvH/MerchShop/internal/db"
+	"github.com/6ermvH/MerchShop/internal/repo"
+)
+
+// Config is everything the service is started with.
+type Config struct {
+	Port        string
+	DatabaseURL string
+	// ReplicaURL is a read replica for history reads; empty reads everything
+	// from DatabaseURL.
+	ReplicaURL string
+	// ReplicaMaxLag is how far the replica may fall behind before its reads
+	// go back to the primary.
+	ReplicaMaxLag time.Duration
+	// Pool sizes both pools and sets the session timeouts.
+	Pool db.PoolConfig
+
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+
+	TransferCategories []string
+	TransferRules      []repo.TransferRule
+	PendingTransferTTL time.Duration
+	OrderCancelWindow  time.Duration
+	// CoinTTL is how long credited coins last; 0 keeps them forever.
+	CoinTTL time.Duration
+	// InfoCacheTTL is how long /api/info answers are cached; 0 disables the cache.
+	InfoCacheTTL time.Duration
+	// ValidateResponses checks every response against schema.yaml and logs
+	// the ones that do not match.
+	ValidateResponses bool
+}
+
+var errNoDatabaseURL = errors.New(
+	"DATABASE_URL is empty; set DATABASE_URL, memory:// to run without Postgres, or use docker-compose",
+)
+
+// ConfigFromEnv reads the Config from the environment, with the defaults
+// docker-compose.yml documents.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Port:        getenv("PORT", "8080"),
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+		ReplicaURL:  os.Getenv("DATABASE_REPLICA_URL"),
+		JWTSecret:   getenv("JWT_SECRET", "dev-secret"),
+		JWTIssuer:   getenv("JWT_ISS", "merch-shop"),
+		JWTAudience: getenv("JWT_AUD", "merch-shop-client"),
+	}
+
+	if cfg.DatabaseURL == "" {
+		return Config{}, errNoDatabaseURL
+	}
+
+	var err error
+
+	cfg.TransferCategories, err = transferCategoriesFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("bad TRANSFER_CATEGORIES: %w", err)
+	}
+
+	cfg.OrderCancelWindow, err = time.ParseDuration(getenv("ORDER_CANCEL_WINDOW", "15m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("bad ORDER_CANCEL_WINDOW: %w", err)
+	}
+
+	cfg.CoinTTL, err = time.ParseDuration(getenv("COIN_TTL", "8760h"))
+	if err != nil || cfg.CoinTTL < 0 {
+		return Config{}, errors.New("bad COIN_TTL, want a duration, 0 to keep coins forever")
+	}
+
+	cfg.ReplicaMaxLag, err = time.ParseDuration(getenv("REPLICA_MAX_LAG", "5s"))
+	if err != nil || cfg.ReplicaMaxLag < 0 {
+		return Config{}, errors.New("bad REPLICA_MAX_LAG, want a duration, 0 to never check the lag")
+	}
+
+	cfg.InfoCacheTTL, err = time.ParseDuration(getenv("INFO_CACHE_TTL", "0s"))
+	if err != nil || cfg.InfoCacheTTL < 0 {
+		return Config{}, errors.New("bad INFO_CACHE_TTL, want a duration, 0 to disable the cache")
+	}
+
+	cfg.ValidateResponses, err = strconv.ParseBool(getenv("OPENAPI_VALIDATE_RESPONSES", "false"))
+	if err != nil {
+		return Config{}, errors.New("bad OPENAPI_VALIDATE_RESPONSES, want true or false")
+	}
+
+	cfg.PendingTransferTTL, err = time.ParseDuration(getenv("PENDING_TRANSFER_TTL", "72h"))
+	if err != nil || cfg.PendingTransferTTL <= 0 {
+		return Config{}, errors.New("bad PENDING_TRANSFER_TTL, want a positive duration")
+	}
+
+	cfg.TransferRules, err = transferRulesFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("bad transfer policy: %w", err)
+	}
+
+	cfg.Pool, err = poolConfigFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("bad pool config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// maxCategoryLen is the width of the transfers.category column.
+const maxCategoryLen = 32
+
+// transferCategoriesFromEnv reads the comma-separated categories. Empty
+// entries are refused rather than skipped, as they are most likely a typo.
+func transferCategoriesFromEnv() ([]string, error) {
+	categories := strings.Split(getenv("TRANSFER_CATEGORIES", "thanks,help,birthday"), ",")
+
+	for i, c := range categories {
+		c = strings.TrimSpace(c)
+
+		switch {
+		case c == "":
+			return nil, fmt.Errorf("entry %d is empty", i+1)
+		case utf8.RuneCountInString(c) > maxCategoryLen:
+			return nil, fmt.Errorf("%q is longer than %d characters", c, maxCategoryLen)
+		}
+
+		categories[i] = c
+	}
+
+	return categories, nil
+}
+
+// transferRulesFromEnv builds the transfer policy; a rule is off while its
+// variable is unset or zero.
+func transferRulesFromEnv() ([]repo.TransferRule, error) {
+	var rules []repo.TransferRule
+
+	minAge, err := time.ParseDuration(getenv("TRANSFER_MIN_ACCOUNT_AGE", "0s"))
+	if err != nil {
+		return nil, fmt.Errorf("TRANSFER_MIN_ACCOUNT_AGE: %w", err)
+	}
+
+	if minAge > 0 {
+		rules = append(rules, repo.MinAccountAge{Age: minAge})
+	}
+
+	limits := map[string]int64{}
+	for _, key := range []string{
+		"TRANSFER_MAX_AMOUNT",
+		"TRANSFER_DAILY_CAP",
+		"TRANSFER_WEEKLY_CAP",
+		"TRANSFER_RECIPIENT_LIMIT",
+	} {
+		v, err := strconv.ParseInt(getenv(key, "0"), 10, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s: want a non-negative integer", key)
+		}
+
+		limits[key] = v
+	}
+
+	if v := limits["TRANSFER_MAX_AMOUNT"]; v > 0 {
+		rules = append(rules, repo.MaxTransferAmount{Max: v})
+	}
+
+	if v := limits["TRANSFER_DAILY_CAP"]; v > 0 {
+		rules = append(rules, repo.DailySendCap(v))
+	}
+
+	if v := limits["TRANSFER_WEEKLY_CAP"]; v > 0 {
+		rules = append(rules, repo.WeeklySendCap(v))
+	}
+
+	if v := limits["TRANSFER_RECIPIENT_LIMIT"]; v > 0 {
+		period, err := time.ParseDuration(getenv("TRANSFER_RECIPIENT_PERIOD", "24h"))
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("TRANSFER_RECIPIENT_PERIOD: want a positive duration")
+		}
+
+		rules = append(rules, repo.RecipientLimit{Period: period, Max: v})
+	}
+
+	return rules, nil
+}
+
+// poolConfigFromEnv reads the pool sizing and session timeouts; a timeout of
+// 0 leaves the Postgres default.
+func poolConfigFromEnv() (db.PoolConfig, error) {
+	cfg := db.PoolConfig{ApplicationName: getenv("DB_APPLICATION_NAME", "merch-shop")}
+
+	for _, n := range []struct {
+		key, def string
+		dst      *int32
+	}{
+		{"DB_MAX_CONNS", "20", &cfg.MaxConns},
+		{"DB_MIN_CONNS", "2", &cfg.MinConns},
+	} {
+		v, err := strconv.ParseInt(getenv(n.key, n.def), 10, 32)
+		if err != nil || v < 0 {
+			return db.PoolConfig{}, fmt.Errorf("%s: want a non-negative integer", n.key)
+		}
+
+		*n.dst = int32(v)
+	}
+
+	for _, d := range []struct {
+		key, def string
+		dst      *time.Duration
+	}{
+		{"DB_MAX_CONN_LIFETIME", "1h", &cfg.MaxConnLifetime},
+		{"DB_MAX_CONN_IDLE_TIME", "30m", &cfg.MaxConnIdleTime},
+		{"DB_HEALTH_CHECK_PERIOD", "1m", &cfg.HealthCheckPeriod},
+		{"DB_STATEMENT_TIMEOUT", "30s", &cfg.StatementTimeout},
+		{"DB_LOCK_TIMEOUT", "5s", &cfg.LockTimeout},
+		{"DB_IDLE_IN_TX_TIMEOUT", "1m", &cfg.IdleInTransactionSessionTimeout},
+		{"DB_CONNECT_TIMEOUT", "1m", &cfg.ConnectTimeout},
+	} {
+		v, err := time.ParseDuration(getenv(d.key, d.def))
+		if err != nil || v < 0 {
+			return db.PoolConfig{}, fmt.Errorf("%s: want a non-negative duration", d.key)
+		}
+
+		*d.dst = v
+	}
+
+	if cfg.MinConns > cfg.MaxConns && cfg.MaxConns > 0 {
+		return db.PoolConfig{}, errors.New("DB_MIN_CONNS is above DB_MAX_CONNS")
+	}
+
+	return cfg, nil
+}
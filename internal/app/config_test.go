@@ -0,0 +1,65 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/merch")
+	t.Setenv("TRANSFER_CATEGORIES", "thanks, help")
+	t.Setenv("COIN_TTL", "0")
+	t.Setenv("TRANSFER_MAX_AMOUNT", "500")
+
+	cfg, err := ConfigFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "8080", cfg.Port)
+	require.Equal(t, []string{"thanks", "help"}, cfg.TransferCategories)
+	require.Zero(t, cfg.CoinTTL)
+	require.Zero(t, cfg.InfoCacheTTL)
+	require.False(t, cfg.ValidateResponses)
+	require.Equal(t, 72*time.Hour, cfg.PendingTransferTTL)
+	require.Empty(t, cfg.ReplicaURL)
+	require.Equal(t, 5*time.Second, cfg.ReplicaMaxLag)
+	require.Equal(t, []repo.TransferRule{repo.MaxTransferAmount{Max: 500}}, cfg.TransferRules)
+	require.Equal(t, int32(20), cfg.Pool.MaxConns)
+	require.Equal(t, 30*time.Second, cfg.Pool.StatementTimeout)
+	require.Equal(t, "merch-shop", cfg.Pool.ApplicationName)
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	for key, value := range map[string]string{
+		"DATABASE_URL":               "",
+		"ORDER_CANCEL_WINDOW":        "soon",
+		"COIN_TTL":                   "-1h",
+		"PENDING_TRANSFER_TTL":       "0s",
+		"TRANSFER_DAILY_CAP":         "-5",
+		"REPLICA_MAX_LAG":            "-1s",
+		"DB_MAX_CONNS":               "many",
+		"DB_MIN_CONNS":               "50",
+		"DB_LOCK_TIMEOUT":            "-1s",
+		"INFO_CACHE_TTL":             "forever",
+		"OPENAPI_VALIDATE_RESPONSES": "sometimes",
+		"TRANSFER_CATEGORIES":        "thanks,,help",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/merch")
+			t.Setenv(key, value)
+
+			_, err := ConfigFromEnv()
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("TRANSFER_CATEGORIES too long", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "postgres://localhost/merch")
+		t.Setenv("TRANSFER_CATEGORIES", "thanks,"+strings.Repeat("x", 33))
+
+		_, err := ConfigFromEnv()
+		require.ErrorContains(t, err, "longer than 32")
+	})
+}
@@ -0,0 +1,9 @@
+//go:build integration
+
+package app
+
+import "github.com/6ermvH/MerchShop/internal/pgtest"
+
+func init() {
+	databases = append(databases, database{name: "postgres", dsn: pgtest.DSN})
+}
@@ -0,0 +1,478 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+	"github.com/6ermvH/MerchShop/internal/repo/memory"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Run(m))
+}
+
+// database is a DATABASE_URL the end-to-end tests run the service on.
+type database struct {
+	name string
+	dsn  func(tb testing.TB) string
+}
+
+// databases always has memory://; e2e_postgres_test.go adds Postgres under
+// the integration build tag.
+var databases = []database{
+	{name: "memory", dsn: func(testing.TB) string { return MemoryDatabaseURL }},
+}
+
+// eachDatabase runs test against a fresh server on every database.
+func eachDatabase(t *testing.T, test func(t *testing.T, s *server)) {
+	t.Helper()
+
+	for _, db := range databases {
+		t.Run(db.name, func(t *testing.T) {
+			t.Parallel()
+
+			test(t, newServer(t, db.dsn(t)))
+		})
+	}
+}
+
+// server is the whole service, booted in-process against its own database.
+// Every response is checked against the spec; a mismatch fails the test.
+type server struct {
+	t   *testing.T
+	url string
+	app *App
+	// pool is nil on memory://.
+	pool *pgxpool.Pool
+}
+
+func newServer(t *testing.T, dsn string) *server {
+	t.Helper()
+
+	a, err := New(context.Background(), Config{
+		DatabaseURL:        dsn,
+		JWTSecret:          "e2e-secret",
+		JWTIssuer:          "merch-shop",
+		JWTAudience:        "merch-shop-client",
+		TransferCategories: []string{"thanks"},
+		PendingTransferTTL: time.Hour,
+		OrderCancelWindow:  15 * time.Minute,
+		InfoCacheTTL:       time.Minute,
+		ValidateResponses:  true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+
+	a.specMismatch = func(_ *gin.Context, err error) { t.Error(err) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a.Start(ctx)
+
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(srv.Close)
+
+	s := &server{t: t, url: srv.URL, app: a}
+
+	if dsn != MemoryDatabaseURL {
+		s.pool, err = pgxpool.New(context.Background(), dsn)
+		require.NoError(t, err)
+		t.Cleanup(s.pool.Close)
+	}
+
+	return s
+}
+
+// client is a user signed in through /api/auth.
+type client struct {
+	s     *server
+	name  string
+	token string
+}
+
+func (s *server) login(name string) *client {
+	s.t.Helper()
+
+	var resp openapi.AuthResponse
+	status := s.do(http.MethodPost, "/api/auth", "", openapi.AuthRequest{
+		Username: name,
+		Password: "password-" + name,
+	}, &resp)
+	require.Equal(s.t, http.StatusOK, status)
+	require.NotEmpty(s.t, resp.Token)
+
+	return &client{s: s, name: name, token: resp.Token}
+}
+
+// admin signs in a user and makes it an admin; roles are only set in SQL,
+// or with SetRole on memory://.
+func (s *server) admin(name string) *client {
+	s.t.Helper()
+
+	c := s.login(name)
+
+	if s.pool == nil {
+		require.NoError(s.t, s.app.repo.(*memory.Repo).SetRole(context.Background(), name, model.RoleAdmin))
+
+		return c
+	}
+
+	_, err := s.pool.Exec(context.Background(), `
+		UPDATE merch_shop.users SET role = 'admin' WHERE username = $1
+	`, name)
+	require.NoError(s.t, err)
+
+	return c
+}
+
+// do sends body as JSON, or as is if it is a string, and decodes the
+// response into out, if given. It returns the status code.
+func (s *server) do(method, path, token string, body, out any) int {
+	s.t.Helper()
+
+	var payload io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		payload = strings.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		require.NoError(s.t, err)
+
+		payload = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, s.url+path, payload)
+	require.NoError(s.t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(s.t, err)
+
+	defer resp.Body.Close()
+
+	if out != nil {
+		require.NoError(s.t, json.NewDecoder(resp.Body).Decode(out))
+	}
+
+	return resp.StatusCode
+}
+
+func (c *client) do(method, path string, body, out any) int {
+	c.s.t.Helper()
+
+	return c.s.do(method, path, c.token, body, out)
+}
+
+func (c *client) info() openapi.InfoResponse {
+	c.s.t.Helper()
+
+	var info openapi.InfoResponse
+	require.Equal(c.s.t, http.StatusOK, c.do(http.MethodGet, "/api/info", nil, &info))
+
+	return info
+}
+
+func (c *client) grant(to string, amount int32) {
+	c.s.t.Helper()
+
+	status := c.do(http.MethodPost, "/api/admin/users/"+to+"/balance",
+		openapi.BalanceAdjustmentRequest{Amount: amount, Reason: "e2e"}, nil)
+	require.Equal(c.s.t, http.StatusOK, status)
+}
+
+func TestTransferAndBuy(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		admin := s.admin("admin")
+		alice := s.login("alice")
+		bob := s.login("bob")
+
+		admin.grant("alice", 100)
+
+		require.Equal(t, http.StatusOK, alice.do(http.MethodPost, "/api/sendCoin", openapi.SendCoinRequest{
+			ToUser:   "bob",
+			Amount:   30,
+			Memo:     "for lunch",
+			Category: "thanks",
+		}, nil))
+		require.Equal(t, http.StatusOK, alice.do(http.MethodGet, "/api/buy/pen", nil, nil))
+		require.Equal(t, http.StatusOK, alice.do(http.MethodGet, "/api/buy/pen", nil, nil))
+
+		info := alice.info()
+		require.EqualValues(t, 50, info.Coins)
+		require.Equal(t, []openapi.InfoResponseInventoryInner{{Type: "pen", Quantity: 2}}, info.Inventory)
+		require.Equal(t, []openapi.InfoResponseCoinHistorySentInner{{
+			ToUser: "bob", Amount: 30, Memo: "for lunch", Category: "thanks",
+		}}, info.CoinHistory.Sent)
+
+		info = bob.info()
+		require.EqualValues(t, 30, info.Coins)
+		require.Empty(t, info.Inventory)
+		require.Equal(t, []openapi.InfoResponseCoinHistoryReceivedInner{{
+			FromUser: "alice", Amount: 30, Memo: "for lunch", Category: "thanks",
+		}}, info.CoinHistory.Received)
+	})
+}
+
+func TestPendingTransfer(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		admin := s.admin("admin")
+		alice := s.login("alice")
+		bob := s.login("bob")
+
+		admin.grant("alice", 50)
+
+		var pending openapi.TransferHistoryItem
+		require.Equal(t, http.StatusAccepted, alice.do(http.MethodPost, "/api/sendCoin", openapi.SendCoinRequest{
+			ToUser:            "bob",
+			Amount:            20,
+			RequireAcceptance: true,
+		}, &pending))
+		require.Equal(t, "pending", pending.Status)
+		require.EqualValues(t, 30, alice.info().Coins)
+
+		accept := "/api/transfers/" + pending.Id + "/accept"
+		require.Equal(t, http.StatusNotFound, alice.do(http.MethodPost, accept, nil, nil))
+		require.Equal(t, http.StatusOK, bob.do(http.MethodPost, accept, nil, nil))
+		require.Equal(t, http.StatusConflict, bob.do(http.MethodPost, accept, nil, nil))
+		require.EqualValues(t, 20, bob.info().Coins)
+	})
+}
+
+func TestInfoCache(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		admin := s.admin("admin")
+		alice := s.login("alice")
+
+		admin.grant("alice", 100)
+		require.EqualValues(t, 100, alice.info().Coins)
+
+		// The cached answer is dropped by the balance event, not by the handler.
+		admin.grant("alice", 10)
+		require.Eventually(t, func() bool {
+			return alice.info().Coins == 110
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestV2(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		admin := s.admin("admin")
+		alice := s.login("alice")
+		s.login("bob")
+
+		admin.grant("alice", 100)
+
+		require.Equal(t, http.StatusNoContent, alice.do(http.MethodPost, "/api/v2/transfers",
+			openapi.SendCoinRequest{ToUser: "bob", Amount: 30, Category: "thanks"}, nil))
+
+		var pending openapi.TransferHistoryItem
+		require.Equal(t, http.StatusAccepted, alice.do(http.MethodPost, "/api/v2/transfers",
+			openapi.SendCoinRequest{ToUser: "bob", Amount: 5, RequireAcceptance: true}, &pending))
+		require.Equal(t, "pending", pending.Status)
+
+		var order openapi.Order
+		require.Equal(t, http.StatusCreated, alice.do(http.MethodPost, "/api/v2/purchases",
+			openapi.PurchaseRequest{Product: "pen"}, &order))
+		require.Equal(t, "pen", order.Product)
+		require.Equal(t, "placed", order.Status)
+
+		require.Equal(t, http.StatusNotFound, alice.do(http.MethodPost, "/api/v2/purchases",
+			openapi.PurchaseRequest{Product: "yacht"}, nil))
+		require.Equal(t, http.StatusUnprocessableEntity, alice.do(http.MethodPost, "/api/v2/purchases",
+			openapi.PurchaseRequest{Product: "powerbank"}, nil))
+
+		var account openapi.AccountResponse
+		require.Equal(t, http.StatusOK, alice.do(http.MethodGet, "/api/v2/account", nil, &account))
+		require.EqualValues(t, 55, account.Balance)
+		require.Len(t, account.Inventory, 1)
+		require.Equal(t, "pen", account.Inventory[0].Product)
+		require.EqualValues(t, 1, account.Inventory[0].Quantity)
+		require.Len(t, account.Transfers.Outgoing, 1)
+		require.Equal(t, "alice", account.Transfers.Outgoing[0].FromUser)
+		require.Equal(t, "bob", account.Transfers.Outgoing[0].ToUser)
+		require.Empty(t, account.Transfers.Incoming)
+
+		var history openapi.TransferHistoryResponse
+		require.Equal(t, http.StatusOK,
+			alice.do(http.MethodGet, "/api/v2/transfers?direction=sent", nil, &history))
+		require.Len(t, history.Transfers, 2)
+
+		// The spec rejects these before any handler runs.
+		var bad openapi.ErrorResponse
+		require.Equal(t, http.StatusBadRequest, alice.do(http.MethodPost, "/api/v2/purchases",
+			map[string]any{"product": "pen", "quantity": 2}, &bad))
+		require.Contains(t, bad.Errors, "quantity")
+		require.Equal(t, http.StatusBadRequest, alice.do(http.MethodPost, "/api/v2/transfers",
+			map[string]any{"toUser": "bob", "amount": "ten"}, nil))
+		require.Equal(t, http.StatusBadRequest,
+			alice.do(http.MethodGet, "/api/v2/transfers?limit=1000", nil, nil))
+		require.Equal(t, http.StatusBadRequest,
+			alice.do(http.MethodPost, "/api/v2/orders/42/cancel", nil, nil))
+
+		// v1 stays as it was, without request validation.
+		require.Equal(t, http.StatusOK, alice.do(http.MethodGet, "/api/buy/pen", nil, nil))
+		require.Equal(t, http.StatusNotFound, alice.do(http.MethodGet, "/api/v2/buy/pen", nil, nil))
+	})
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		alice := s.login("alice")
+
+		// Signing in again with the same password gives a working token.
+		again := s.login("alice")
+		require.Equal(t, http.StatusOK, again.do(http.MethodGet, "/api/info", nil, nil))
+
+		require.Equal(t, http.StatusUnauthorized, s.do(http.MethodPost, "/api/auth", "",
+			openapi.AuthRequest{Username: "alice", Password: "wrong"}, nil))
+
+		for name, token := range map[string]string{
+			"missing":  "",
+			"garbage":  "not-a-jwt",
+			"tampered": alice.token[:len(alice.token)-2] + "xx",
+		} {
+			require.Equal(t, http.StatusUnauthorized, s.do(http.MethodGet, "/api/info", token, nil, nil), name)
+		}
+
+		require.Equal(t, http.StatusForbidden,
+			alice.do(http.MethodPost, "/api/admin/users/alice/balance",
+				openapi.BalanceAdjustmentRequest{Amount: 1000}, nil))
+
+		require.Equal(t, http.StatusOK, s.do(http.MethodGet, "/healthz", "", nil, nil))
+	})
+}
+
+func TestMalformedInput(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		admin := s.admin("admin")
+		alice := s.login("alice")
+		s.login("bob")
+
+		admin.grant("alice", 10)
+
+		for _, tc := range []struct {
+			name   string
+			method string
+			path   string
+			body   any
+			want   int
+		}{
+			{"auth not json", http.MethodPost, "/api/auth", `{"username":`, http.StatusBadRequest},
+			{"send not json", http.MethodPost, "/api/sendCoin", `nope`, http.StatusBadRequest},
+			{"send wrong types", http.MethodPost, "/api/sendCoin",
+				`{"toUser":1,"amount":"1"}`, http.StatusBadRequest},
+			{"send no recipient", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{Amount: 1}, http.StatusBadRequest},
+			{"send zero", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{ToUser: "bob"}, http.StatusBadRequest},
+			{"send negative", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{ToUser: "bob", Amount: -5}, http.StatusBadRequest},
+			{"send unknown category", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{ToUser: "bob", Amount: 1, Category: "bribe"}, http.StatusBadRequest},
+			{"send unknown user", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{ToUser: "nobody", Amount: 1}, http.StatusNotFound},
+			{"send too much", http.MethodPost, "/api/sendCoin",
+				openapi.SendCoinRequest{ToUser: "bob", Amount: 11}, http.StatusUnprocessableEntity},
+			{"accept bad id", http.MethodPost, "/api/transfers/not-a-uuid/accept", nil, http.StatusBadRequest},
+			{"unknown route", http.MethodGet, "/api/nope", nil, http.StatusNotFound},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				require.Equal(t, tc.want, alice.do(tc.method, tc.path, tc.body, nil))
+			})
+		}
+
+		require.EqualValues(t, 10, alice.info().Coins)
+	})
+}
+
+func TestConcurrentTransfers(t *testing.T) {
+	t.Parallel()
+
+	eachDatabase(t, func(t *testing.T, s *server) {
+		const (
+			users   = 5
+			balance = 100
+			rounds  = 20
+		)
+
+		admin := s.admin("admin")
+
+		clients := make([]*client, users)
+		for i := range clients {
+			clients[i] = s.login(fmt.Sprintf("user%d", i))
+			admin.grant(clients[i].name, balance)
+		}
+
+		var wg sync.WaitGroup
+
+		statuses := make(chan int, users*rounds)
+
+		for i, c := range clients {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for round := range rounds {
+					to := clients[(i+1+round%(users-1))%users]
+
+					statuses <- c.do(http.MethodPost, "/api/sendCoin", openapi.SendCoinRequest{
+						ToUser: to.name,
+						Amount: int32(1 + (i*7+round*13)%40), //nolint:gosec
+					}, nil)
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(statuses)
+
+		for status := range statuses {
+			require.Contains(t, []int{http.StatusOK, http.StatusUnprocessableEntity}, status)
+		}
+
+		var total int32
+
+		for _, c := range clients {
+			coins := c.info().Coins
+			require.GreaterOrEqual(t, coins, int32(0))
+
+			total += coins
+		}
+
+		require.EqualValues(t, users*balance, total)
+	})
+}
@@ -0,0 +1,60 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// A Monday.
+	from := time.Date(2025, 11, 10, 12, 30, 15, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 11, 10, 12, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 11, 10, 12, 45, 0, 0, time.UTC)},
+		{"30 12 * * *", time.Date(2025, 11, 11, 12, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 11, 11, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1 * *", time.Date(2025, 12, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 5", time.Date(2025, 11, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2025, 11, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 11, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 0 25 12 *", time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matching is enough.
+		{"0 0 20 * 3", time.Date(2025, 11, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, s.Next(from))
+		})
+	}
+}
+
+func TestParse_Bad(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		_, err := Parse(expr)
+		require.ErrorIs(t, err, ErrBadExpression, expr)
+	}
+}
@@ -2,16 +2,178 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/6ermvH/MerchShop/internal/logx"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, dsn)
+// PoolConfig tunes the pool and the sessions it opens. Zero fields keep the
+// pgxpool and Postgres defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// ApplicationName shows up in pg_stat_activity, unless the DSN sets one.
+	ApplicationName string
+	// The session timeouts every connection is opened with.
+	StatementTimeout                time.Duration
+	LockTimeout                     time.Duration
+	IdleInTransactionSessionTimeout time.Duration
+
+	// ConnectTimeout is how long NewPool keeps retrying to reach the
+	// database; 0 tries once.
+	ConnectTimeout time.Duration
+}
+
+// Backoff between connection attempts at startup.
+const (
+	connectBackoffBase = 250 * time.Millisecond
+	connectBackoffMax  = 5 * time.Second
+)
+
+// NewPool opens a pool on dsn and waits for the database to answer, retrying
+// with backoff for up to cfg.ConnectTimeout, so the API does not give up
+// while Postgres is still booting.
+func NewPool(ctx context.Context, dsn string, cfg PoolConfig) (*pgxpool.Pool, error) {
+	poolCfg, err := poolConfig(dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("connect to db: %w", err)
 	}
 
+	if err := waitForDB(ctx, pool.Ping, cfg.ConnectTimeout); err != nil {
+		pool.Close()
+
+		return nil, err
+	}
+
 	return pool, nil
 }
+
+func poolConfig(dsn string, cfg PoolConfig) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse db config: %w", err)
+	}
+
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = min(cfg.MinConns, poolCfg.MaxConns)
+	}
+
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	params := poolCfg.ConnConfig.RuntimeParams
+	if _, ok := params["application_name"]; !ok && cfg.ApplicationName != "" {
+		params["application_name"] = cfg.ApplicationName
+	}
+
+	if settings := sessionSettings(cfg); len(settings) > 0 {
+		poolCfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			return applySessionSettings(ctx, conn, settings)
+		}
+	}
+
+	return poolCfg, nil
+}
+
+type setting struct {
+	name, value string
+}
+
+// sessionSettings lists the timeouts cfg sets, in the form SET takes them.
+func sessionSettings(cfg PoolConfig) []setting {
+	var settings []setting
+
+	for _, s := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"statement_timeout", cfg.StatementTimeout},
+		{"lock_timeout", cfg.LockTimeout},
+		{"idle_in_transaction_session_timeout", cfg.IdleInTransactionSessionTimeout},
+	} {
+		if s.value > 0 {
+			settings = append(settings, setting{s.name, fmt.Sprintf("%dms", s.value.Milliseconds())})
+		}
+	}
+
+	return settings
+}
+
+func applySessionSettings(ctx context.Context, conn *pgx.Conn, settings []setting) error {
+	batch := &pgx.Batch{}
+	for _, s := range settings {
+		batch.Queue(`SELECT set_config($1, $2, false)`, s.name, s.value)
+	}
+
+	if err := conn.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("set session timeouts: %w", err)
+	}
+
+	return nil
+}
+
+// waitForDB pings until the database answers or timeout passes, doubling
+// the wait between attempts up to connectBackoffMax.
+func waitForDB(ctx context.Context, ping func(context.Context) error, timeout time.Duration) error {
+	if timeout <= 0 {
+		if err := ping(ctx); err != nil {
+			return fmt.Errorf("ping db: %w", err)
+		}
+
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lg := logx.FromContext(ctx)
+	wait := connectBackoffBase
+
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if deadline, _ := ctx.Deadline(); time.Until(deadline) < wait {
+			return fmt.Errorf("ping db after %d attempts: %w", attempt, err)
+		}
+
+		lg.Warn(ctx, "database not ready, retrying",
+			"attempt", attempt, "wait", wait.String(), "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ping db after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-time.After(wait):
+		}
+
+		wait = min(2*wait, connectBackoffMax)
+	}
+}
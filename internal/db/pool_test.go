@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfig(t *testing.T) {
+	cfg, err := poolConfig("postgres://localhost/merch", PoolConfig{
+		MaxConns:         4,
+		MinConns:         10,
+		MaxConnLifetime:  time.Hour,
+		ApplicationName:  "merch-shop",
+		StatementTimeout: 30 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(4), cfg.MaxConns)
+	require.Equal(t, int32(4), cfg.MinConns)
+	require.Equal(t, time.Hour, cfg.MaxConnLifetime)
+	require.Equal(t, "merch-shop", cfg.ConnConfig.RuntimeParams["application_name"])
+	require.NotNil(t, cfg.AfterConnect)
+}
+
+func TestPoolConfig_KeepsDSNSettings(t *testing.T) {
+	cfg, err := poolConfig("postgres://localhost/merch?application_name=worker&pool_max_conns=7",
+		PoolConfig{ApplicationName: "merch-shop"})
+	require.NoError(t, err)
+	require.Equal(t, int32(7), cfg.MaxConns)
+	require.Equal(t, "worker", cfg.ConnConfig.RuntimeParams["application_name"])
+	require.Nil(t, cfg.AfterConnect)
+}
+
+func TestSessionSettings(t *testing.T) {
+	require.Equal(t, []setting{
+		{"statement_timeout", "1500ms"},
+		{"idle_in_transaction_session_timeout", "60000ms"},
+	}, sessionSettings(PoolConfig{
+		StatementTimeout:                1500 * time.Millisecond,
+		IdleInTransactionSessionTimeout: time.Minute,
+	}))
+}
+
+func TestWaitForDB_RetriesUntilUp(t *testing.T) {
+	attempts := 0
+	err := waitForDB(context.Background(), func(context.Context) error {
+		if attempts++; attempts < 3 { //nolint:mnd
+			return errors.New("connection refused")
+		}
+
+		return nil
+	}, 10*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+}
+
+func TestWaitForDB_GivesUp(t *testing.T) {
+	down := errors.New("connection refused")
+
+	attempts := 0
+	err := waitForDB(context.Background(), func(context.Context) error {
+		attempts++
+
+		return down
+	}, 0)
+	require.ErrorIs(t, err, down)
+	require.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = waitForDB(context.Background(), func(context.Context) error {
+		attempts++
+
+		return down
+	}, 300*time.Millisecond)
+	require.ErrorIs(t, err, down)
+	require.Equal(t, 2, attempts)
+}
@@ -0,0 +1,232 @@
+// Package events fans out the events the repo announces with pg_notify to
+// the live streams of this API instance. Every instance runs its own Broker,
+// so a change committed through any replica reaches clients on all of them.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/logx"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// subscriberBuffer is how many events a slow client may lag behind
+	// before it is dropped; it reconnects and catches up with Last-Event-ID.
+	subscriberBuffer = 64
+	reconnectDelay   = time.Second
+	pruneEvery       = time.Hour
+	// Retention is how long events stay available for Last-Event-ID resume.
+	Retention = 24 * time.Hour
+)
+
+// Conn is a dedicated database connection the broker LISTENs on.
+type Conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Release()
+}
+
+type Connect func(ctx context.Context) (Conn, error)
+
+// Pruner drops events older than Retention.
+type Pruner interface {
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Broker struct {
+	connect Connect
+	pruner  Pruner
+
+	mu       sync.Mutex
+	subs     map[uuid.UUID]map[chan model.Event]struct{}
+	watchers []func(model.Event)
+}
+
+func NewBroker(connect Connect, pruner Pruner) *Broker {
+	return &Broker{
+		connect: connect,
+		pruner:  pruner,
+		subs:    make(map[uuid.UUID]map[chan model.Event]struct{}),
+	}
+}
+
+// PoolConnect takes the broker's connection out of pool.
+func PoolConnect(pool *pgxpool.Pool) Connect {
+	return func(ctx context.Context) (Conn, error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("acquire conn: %w", err)
+		}
+
+		return poolConn{conn}, nil
+	}
+}
+
+type poolConn struct{ *pgxpool.Conn }
+
+func (c poolConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	return c.Conn.Conn().WaitForNotification(ctx) //nolint:wrapcheck
+}
+
+// Subscribe returns the user's live events. The channel is closed when the
+// returned cancel func is called or when the subscriber falls too far behind.
+func (b *Broker) Subscribe(userId uuid.UUID) (<-chan model.Event, func()) {
+	ch := make(chan model.Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[userId] == nil {
+		b.subs[userId] = make(map[chan model.Event]struct{})
+	}
+
+	b.subs[userId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() { b.unsubscribe(userId, ch) }
+}
+
+func (b *Broker) unsubscribe(userId uuid.UUID, ch chan model.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[userId][ch]; !ok {
+		return
+	}
+
+	delete(b.subs[userId], ch)
+
+	if len(b.subs[userId]) == 0 {
+		delete(b.subs, userId)
+	}
+
+	close(ch)
+}
+
+// Watch calls fn with every event published, whoever it is for. fn runs
+// with the broker locked and must not block.
+func (b *Broker) Watch(fn func(model.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.watchers = append(b.watchers, fn)
+}
+
+// Publish hands an event to the watchers and the user's subscribers on this
+// instance.
+func (b *Broker) Publish(e model.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, fn := range b.watchers {
+		fn(e)
+	}
+
+	for ch := range b.subs[e.UserID] {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs[e.UserID], ch)
+			close(ch)
+		}
+	}
+
+	if len(b.subs[e.UserID]) == 0 {
+		delete(b.subs, e.UserID)
+	}
+}
+
+// Run listens on repo.EventsChannel until ctx is done, reconnecting after
+// connection errors, and prunes old events once an hour.
+func (b *Broker) Run(ctx context.Context) {
+	lg := logx.FromContext(ctx)
+	lastPrune := time.Time{}
+
+	for ctx.Err() == nil {
+		if err := b.listen(ctx, &lastPrune); err != nil && ctx.Err() == nil {
+			lg.Warn(ctx, "event listener failed, reconnecting", "error", err.Error())
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context, lastPrune *time.Time) error {
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+repo.EventsChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	defer conn.Exec(context.WithoutCancel(ctx), "UNLISTEN *") //nolint:errcheck
+
+	for {
+		if time.Since(*lastPrune) >= pruneEvery {
+			b.prune(ctx)
+			*lastPrune = time.Now()
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, pruneEvery)
+		n, err := conn.WaitForNotification(waitCtx)
+
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil //nolint:nilerr
+			}
+
+			if waitCtx.Err() != nil {
+				continue
+			}
+
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+
+		b.dispatch(ctx, n.Payload)
+	}
+}
+
+// payload mirrors the json_build_object in repo.publishEvent.
+type payload struct {
+	ID     int64           `json:"id"`
+	UserID uuid.UUID       `json:"userId"`
+	Type   model.EventType `json:"type"`
+	Data   map[string]any  `json:"data"`
+}
+
+func (b *Broker) dispatch(ctx context.Context, raw string) {
+	var p payload
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		logx.FromContext(ctx).Warn(ctx, "bad event payload", "error", err.Error())
+
+		return
+	}
+
+	b.Publish(model.Event{ID: p.ID, UserID: p.UserID, Type: p.Type, Data: p.Data})
+}
+
+func (b *Broker) prune(ctx context.Context) {
+	if b.pruner == nil {
+		return
+	}
+
+	if _, err := b.pruner.DeleteEventsBefore(ctx, time.Now().Add(-Retention)); err != nil {
+		logx.FromContext(ctx).Warn(ctx, "prune events", "error", err.Error())
+	}
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	execs         []string
+	notifications chan *pgconn.Notification
+	released      chan struct{}
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.execs = append(c.execs, sql)
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakeConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n := <-c.notifications:
+		return n, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeConn) Release() { close(c.released) }
+
+type fakePruner struct{ calls chan time.Time }
+
+func (p fakePruner) DeleteEventsBefore(_ context.Context, before time.Time) (int64, error) {
+	p.calls <- before
+
+	return 0, nil
+}
+
+func TestBroker_RunDispatchesToUser(t *testing.T) {
+	conn := &fakeConn{
+		notifications: make(chan *pgconn.Notification, 2),
+		released:      make(chan struct{}),
+	}
+	pruner := fakePruner{calls: make(chan time.Time, 1)}
+	broker := NewBroker(func(context.Context) (Conn, error) { return conn, nil }, pruner)
+
+	me, other := uuid.New(), uuid.New()
+	events, cancelSub := broker.Subscribe(me)
+
+	defer cancelSub()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		broker.Run(ctx)
+		close(done)
+	}()
+
+	conn.notifications <- &pgconn.Notification{
+		Payload: `{"id":3,"userId":"` + other.String() + `","type":"balance","data":{}}`,
+	}
+	conn.notifications <- &pgconn.Notification{
+		Payload: `{"id":4,"userId":"` + me.String() + `","type":"order","data":{"status":"packed"}}`,
+	}
+
+	select {
+	case e := <-events:
+		require.Equal(t, model.Event{
+			ID:     4,
+			UserID: me,
+			Type:   model.EventOrder,
+			Data:   map[string]any{"status": "packed"},
+		}, e)
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	select {
+	case before := <-pruner.calls:
+		require.WithinDuration(t, time.Now().Add(-Retention), before, time.Minute)
+	case <-time.After(time.Second):
+		t.Fatal("events not pruned")
+	}
+
+	cancel()
+	<-done
+	<-conn.released
+	require.Equal(t, []string{"LISTEN merch_events", "UNLISTEN *"}, conn.execs)
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	broker := NewBroker(nil, nil)
+	user := uuid.New()
+	events, cancel := broker.Subscribe(user)
+
+	for i := range subscriberBuffer + 1 {
+		broker.Publish(model.Event{ID: int64(i + 1), UserID: user})
+	}
+
+	got := 0
+	for range events {
+		got++
+	}
+
+	require.Equal(t, subscriberBuffer, got)
+
+	cancel()
+}
+
+func TestBroker_WatchSeesEveryUser(t *testing.T) {
+	broker := NewBroker(nil, nil)
+
+	var seen []uuid.UUID
+
+	broker.Watch(func(e model.Event) { seen = append(seen, e.UserID) })
+
+	alice, bob := uuid.New(), uuid.New()
+	events, cancel := broker.Subscribe(alice)
+
+	defer cancel()
+
+	broker.Publish(model.Event{ID: 1, UserID: alice})
+	broker.Publish(model.Event{ID: 2, UserID: bob})
+
+	require.Equal(t, []uuid.UUID{alice, bob}, seen)
+	require.Equal(t, int64(1), (<-events).ID)
+}
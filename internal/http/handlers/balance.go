@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// adjustReasonMaxLen keeps the reason short enough to read in a notification.
+const adjustReasonMaxLen = 200
+
+func (api *API) ApiAdminUsersUsernameBalancePost(c *gin.Context) {
+	var request openapi.BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	reason := sanitizeMemo(request.Reason)
+	if request.Amount == 0 || utf8.RuneCountInString(reason) > adjustReasonMaxLen {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	user, err := api.repos.FindUserByUsername(ctx, strings.TrimSpace(c.Param("username")))
+	if err == nil {
+		user, err = api.repos.AdjustBalance(ctx, user.ID, int64(request.Amount), reason)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "user not found"})
+		case errors.Is(err, repo.ErrInsufficient):
+			c.JSON(
+				http.StatusUnprocessableEntity,
+				openapi.ErrorResponse{Errors: "insufficient funds"},
+			)
+		default:
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+		}
+
+		return
+	}
+
+	c.JSON(http.StatusOK, openapi.UserBalance{
+		Username: user.Username,
+		Balance:  int32(user.Balance), //nolint:gosec
+	})
+}
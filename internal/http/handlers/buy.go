@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/6ermvH/MerchShop/gen/openapi"
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
 	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
 	"github.com/gin-gonic/gin"
 )
 
@@ -32,14 +34,38 @@ func (api *API) ApiBuyItemGet(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
 	defer cancel()
 
-	if err := api.repos.BuyProduct(ctx, user.ID, product); err != nil {
-		c.JSON(
-			http.StatusInternalServerError,
-			openapi.ErrorResponse{Errors: fmt.Sprintf("db error: %v", err)},
-		)
+	purchase := model.Purchase{
+		Product:   product,
+		Variant:   c.Query("variant"),
+		PromoCode: c.Query("promo"),
+	}
+
+	if _, err := api.repos.BuyProduct(ctx, user.ID, purchase); err != nil {
+		writeBuyError(c, err)
 
 		return
 	}
 
+	api.changed(user.ID)
 	c.Status(http.StatusOK)
 }
+
+func writeBuyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repo.ErrOutOfStock):
+		c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: "out of stock"})
+	case errors.Is(err, repo.ErrVariantRequired):
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "variant required"})
+	case errors.Is(err, repo.ErrUnknownVariant):
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "unknown variant"})
+	case errors.Is(err, repo.ErrPromoCodeInvalid):
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "invalid promo code"})
+	case errors.Is(err, repo.ErrPromoCodeExhausted), errors.Is(err, repo.ErrPromoCodeUserLimit):
+		c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: "promo code already used"})
+	default:
+		c.JSON(
+			http.StatusInternalServerError,
+			openapi.ErrorResponse{Errors: fmt.Sprintf("db error: %v", err)},
+		)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
 	"github.com/6ermvH/MerchShop/internal/jwtutil"
 	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
@@ -37,8 +39,8 @@ func TestBuyItem_OK(t *testing.T) {
 				FindUserByID(gomock.Any(), user.ID).
 				Return(user, nil)
 			repoMock.EXPECT().
-				BuyProduct(gomock.Any(), user.ID, product).
-				Return(nil)
+				BuyProduct(gomock.Any(), user.ID, model.Purchase{Product: product}).
+				Return(model.Order{}, nil)
 
 			j := jwtutil.NewHS256("is-my-private-secret-key-hello-world", "merch", "merch")
 
@@ -82,8 +84,8 @@ func TestBuyItem_UnknownItem(t *testing.T) {
 				FindUserByID(gomock.Any(), user.ID).
 				Return(user, nil)
 			repoMock.EXPECT().
-				BuyProduct(gomock.Any(), user.ID, product).
-				Return(errors.New("Bad product"))
+				BuyProduct(gomock.Any(), user.ID, model.Purchase{Product: product}).
+				Return(model.Order{}, errors.New("Bad product"))
 
 			j := jwtutil.NewHS256("is-my-private-secret-key-hello-world", "merch", "merch")
 
@@ -108,3 +110,110 @@ func TestBuyItem_UnknownItem(t *testing.T) {
 		})
 	}
 }
+
+func TestBuyItem_OutOfStock_409(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "german", Balance: 100}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		BuyProduct(gomock.Any(), user.ID, model.Purchase{Product: "cup"}).
+		Return(model.Order{}, fmt.Errorf("tx fn: %w", repo.ErrOutOfStock))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/buy/:item", withUser(user), api.ApiBuyItemGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/buy/cup", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("has code: %d want code: %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestBuyItem_Variant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name    string
+		variant string
+		result  error
+		want    int
+	}{
+		{name: "ok", variant: "t-shirt-m", want: http.StatusOK},
+		{name: "missing", variant: "", result: repo.ErrVariantRequired, want: http.StatusBadRequest},
+		{name: "unknown", variant: "xxl", result: repo.ErrUnknownVariant, want: http.StatusBadRequest},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := model.User{ID: uuid.New(), Username: "german", Balance: 100}
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			repoMock.EXPECT().
+				BuyProduct(
+					gomock.Any(), user.ID, model.Purchase{Product: "t-shirt", Variant: cse.variant},
+				).
+				Return(model.Order{}, cse.result)
+
+			api := NewAPI(repoMock, nil)
+			r := gin.New()
+			r.GET("/api/buy/:item", withUser(user), api.ApiBuyItemGet)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/buy/t-shirt?variant="+cse.variant, nil)
+			r.ServeHTTP(w, req)
+
+			if w.Code != cse.want {
+				t.Fatalf("has code: %d want code: %d", w.Code, cse.want)
+			}
+		})
+	}
+}
+
+func TestBuyItem_PromoCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name   string
+		result error
+		want   int
+	}{
+		{name: "ok", want: http.StatusOK},
+		{name: "invalid", result: repo.ErrPromoCodeInvalid, want: http.StatusBadRequest},
+		{name: "exhausted", result: repo.ErrPromoCodeExhausted, want: http.StatusConflict},
+		{name: "user limit", result: repo.ErrPromoCodeUserLimit, want: http.StatusConflict},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := model.User{ID: uuid.New(), Username: "german", Balance: 100}
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			repoMock.EXPECT().
+				BuyProduct(gomock.Any(), user.ID, model.Purchase{Product: "socks", PromoCode: "SALE10"}).
+				Return(model.Order{}, cse.result)
+
+			api := NewAPI(repoMock, nil)
+			r := gin.New()
+			r.GET("/api/buy/:item", withUser(user), api.ApiBuyItemGet)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/buy/socks?promo=SALE10", nil)
+			r.ServeHTTP(w, req)
+
+			if w.Code != cse.want {
+				t.Fatalf("has code: %d want code: %d", w.Code, cse.want)
+			}
+		})
+	}
+}
@@ -4,31 +4,171 @@
 package handlers
 
 import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/apispec"
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/infocache"
 	"github.com/6ermvH/MerchShop/internal/jwtutil"
+	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/6ermvH/MerchShop/internal/repo"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+var defaultTransferCategories = []string{"thanks", "help", "birthday"}
+
 type API struct {
 	repos repo.MerchRepo
 	hs    jwtutil.JWT
+
+	categories   map[string]struct{}
+	cancelWindow time.Duration
+	pendingTTL   time.Duration
+	events       EventSubscriber
+	heartbeat    time.Duration
+	streamsDone  <-chan struct{}
+	infoCache    *infocache.Cache
+	spec         *apispec.Spec
+	recentWrites *repo.RecentWrites
 }
 
-func NewAPI(repo repo.MerchRepo, hs jwtutil.JWT) *API {
-	return &API{
-		repos: repo,
-		hs:    hs,
+type Option func(*API)
+
+// WithTransferCategories replaces the set of categories a transfer may be tagged with.
+func WithTransferCategories(categories ...string) Option {
+	return func(api *API) {
+		api.categories = make(map[string]struct{}, len(categories))
+
+		for _, c := range categories {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+				api.categories[c] = struct{}{}
+			}
+		}
 	}
 }
 
+// WithRecentWrites sends the history reads of users who changed something
+// lately to the primary, so that /api/orders right after a purchase or
+// /api/transfers right after a send show it even with a lagging replica.
+func WithRecentWrites(w *repo.RecentWrites) Option {
+	return func(api *API) {
+		api.recentWrites = w
+	}
+}
+
+// changed is called after a write that touched the users' balance, orders
+// or transfers.
+func (api *API) changed(userIds ...uuid.UUID) {
+	api.forgetInfo(userIds...)
+
+	if api.recentWrites != nil {
+		api.recentWrites.Mark(userIds...)
+	}
+}
+
+// ownReads is ctx for reads of the user's own history.
+func (api *API) ownReads(ctx context.Context, userId uuid.UUID) context.Context {
+	if api.recentWrites == nil {
+		return ctx
+	}
+
+	return api.recentWrites.Context(ctx, userId)
+}
+
+func NewAPI(repo repo.MerchRepo, hs jwtutil.JWT, opts ...Option) *API {
+	api := &API{
+		repos:        repo,
+		hs:           hs,
+		cancelWindow: defaultOrderCancelWindow,
+		pendingTTL:   defaultPendingTransferTTL,
+		heartbeat:    defaultStreamHeartbeat,
+	}
+
+	WithTransferCategories(defaultTransferCategories...)(api)
+
+	for _, opt := range opts {
+		opt(api)
+	}
+
+	return api
+}
+
+// RegisterRoutes serves v1 under /api and v2 under /api/v2. v2 shares
+// everything but purchases, transfers and the account summary, which v1
+// exposes as GET /buy/:item, POST /sendCoin and GET /info.
 func (api *API) RegisterRoutes(r *gin.Engine) {
-	r.POST("/api/auth", api.ApiAuthPost)
+	v1 := api.registerCommon(r.Group("/api"))
+	{
+		v1.GET("/buy/:item", api.ApiBuyItemGet)
+		v1.GET("/info", api.ApiInfoGet)
+		v1.POST("/sendCoin", api.ApiSendCoinPost)
+	}
+
+	var validate []gin.HandlerFunc
+	if api.spec != nil {
+		validate = append(validate, middleware.ValidateRequest(api.spec))
+	}
+
+	v2 := api.registerCommon(r.Group("/api/v2"), validate...)
+	{
+		v2.POST("/purchases", api.ApiV2PurchasesPost)
+		v2.POST("/transfers", api.ApiV2TransfersPost)
+		v2.GET("/account", api.ApiV2AccountGet)
+	}
+}
 
-	apiG := r.Group("/api", middleware.Auth(api.hs, api.repos))
+// registerCommon adds the routes v1 and v2 share to g, running validate
+// before each handler, and returns the group that requires a user.
+func (api *API) registerCommon(g *gin.RouterGroup, validate ...gin.HandlerFunc) *gin.RouterGroup {
+	publicG := g.Group("", validate...)
 	{
-		apiG.GET("/buy/:item", api.ApiBuyItemGet)
-		apiG.GET("/info", api.ApiInfoGet)
-		apiG.POST("/sendCoin", api.ApiSendCoinPost)
+		publicG.POST("/auth", api.ApiAuthPost)
+		publicG.GET("/products", api.ApiProductsGet)
+		publicG.GET("/products/:id", api.ApiProductsIdGet)
 	}
+
+	apiG := g.Group("", append([]gin.HandlerFunc{middleware.Auth(api.hs, api.repos)}, validate...)...)
+	{
+		apiG.GET("/transfers", api.ApiTransfersGet)
+		apiG.POST("/transfers/:id/accept", api.ApiTransfersIdAcceptPost)
+		apiG.POST("/transfers/:id/decline", api.ApiTransfersIdDeclinePost)
+		apiG.GET("/schedules", api.ApiSchedulesGet)
+		apiG.POST("/schedules", api.ApiSchedulesPost)
+		apiG.POST("/schedules/:id/pause", api.ApiSchedulesIdPausePost)
+		apiG.POST("/schedules/:id/resume", api.ApiSchedulesIdResumePost)
+		apiG.POST("/schedules/:id/cancel", api.ApiSchedulesIdCancelPost)
+		apiG.GET("/orders", api.ApiOrdersGet)
+		apiG.POST("/orders/:id/cancel", api.ApiOrdersIdCancelPost)
+		apiG.GET("/wishlist", api.ApiWishlistGet)
+		apiG.POST("/wishlist", api.ApiWishlistPost)
+		apiG.DELETE("/wishlist", api.ApiWishlistDelete)
+		apiG.GET("/notifications", api.ApiNotificationsGet)
+		apiG.POST("/notifications/read", api.ApiNotificationsReadPost)
+		apiG.GET("/notifications/preferences", api.ApiNotificationsPreferencesGet)
+		apiG.PUT("/notifications/preferences", api.ApiNotificationsPreferencesPut)
+		apiG.GET("/stream", api.ApiStreamGet)
+		apiG.GET("/leaderboard", api.ApiLeaderboardGet)
+		apiG.PUT("/leaderboard/preferences", api.ApiLeaderboardPreferencesPut)
+		apiG.GET("/users/:username/stats", api.ApiUsersUsernameStatsGet)
+	}
+
+	staffG := apiG.Group("/staff", middleware.RequireRole(model.RoleStaff, model.RoleAdmin))
+	{
+		staffG.GET("/orders", api.ApiStaffOrdersGet)
+		staffG.POST("/orders/:id/status", api.ApiStaffOrdersIdStatusPost)
+	}
+
+	adminG := apiG.Group("/admin", middleware.RequireRole(model.RoleAdmin))
+	{
+		adminG.POST("/orders/:id/refund", api.ApiAdminOrdersIdRefundPost)
+		adminG.POST("/promotions", api.ApiAdminPromotionsPost)
+		adminG.POST("/promo-codes", api.ApiAdminPromoCodesPost)
+		adminG.PATCH("/products/:id", api.ApiAdminProductsIdPatch)
+		adminG.POST("/users/:username/balance", api.ApiAdminUsersUsernameBalancePost)
+	}
+
+	return apiG
 }
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/6ermvH/MerchShop/gen/openapi"
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/infocache"
 	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func (api *API) ApiInfoGet(c *gin.Context) {
@@ -21,79 +24,139 @@ func (api *API) ApiInfoGet(c *gin.Context) {
 
 	user := userRaw.(model.User) //nolint:forcetypeassert
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
-	defer cancel()
+	var full bool
 
-	orders, err := api.repos.FindOrdersByUserID(ctx, user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+	switch c.DefaultQuery("detail", infoDetailSummary) {
+	case infoDetailSummary:
+	case infoDetailFull:
+		full = true
+	default:
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: errBadInfoDetail.Error()})
 
 		return
 	}
 
-	inventory := makeInfoResponseInventory(orders)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
 
-	recv, err := api.repos.FindTransfersFromID(ctx, user.ID)
+	info, err := api.loadInfo(ctx, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
 
 		return
 	}
 
-	coinHistoryTo := make([]openapi.InfoResponseCoinHistorySentInner, 0)
-	for _, rec := range recv {
-		coinHistoryTo = append(coinHistoryTo,
-			openapi.InfoResponseCoinHistorySentInner{
-				ToUser: rec.FromUserName,
-				Amount: int32(rec.Amount), //nolint:gosec
-			})
-	}
+	c.JSON(http.StatusOK, makeInfoResponse(info, full))
+}
 
-	sent, err := api.repos.FindTransfersToID(ctx, user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+// ?detail=full adds transfer IDs and times to /api/info; the summary keeps
+// the fields clients had before.
+const (
+	infoDetailSummary = "summary"
+	infoDetailFull    = "full"
+)
 
-		return
+var errBadInfoDetail = errors.New("bad detail, want summary or full")
+
+// infoHistoryLimit is how many of the latest orders, sent and received
+// transfers /api/info lists; the full history is paged via /api/orders and
+// /api/transfers.
+const infoHistoryLimit = 100
+
+// WithInfoCache serves /api/info from cache. Purchases and transfers made
+// here drop the summaries of the users involved right away; anything else
+// must reach the cache through Invalidate.
+func WithInfoCache(cache *infocache.Cache) Option {
+	return func(api *API) {
+		api.infoCache = cache
 	}
+}
 
-	coinHistoryFrom := make([]openapi.InfoResponseCoinHistoryReceivedInner, 0)
-	for _, sen := range sent {
-		coinHistoryFrom = append(coinHistoryFrom,
-			openapi.InfoResponseCoinHistoryReceivedInner{
-				FromUser: sen.ToUserName,
-				Amount:   int32(sen.Amount), //nolint:gosec
-			})
+func (api *API) loadInfo(ctx context.Context, userId uuid.UUID) (model.UserInfo, error) {
+	load := func(ctx context.Context) (model.UserInfo, error) {
+		return api.repos.FindUserInfo(ctx, userId, infoHistoryLimit) //nolint:wrapcheck
 	}
 
-	response := openapi.InfoResponse{
-		Coins:     int32(user.Balance), //nolint:gosec
-		Inventory: inventory,
-		CoinHistory: openapi.InfoResponseCoinHistory{
-			Received: coinHistoryFrom,
-			Sent:     coinHistoryTo,
-		},
+	if api.infoCache == nil {
+		return load(ctx)
 	}
 
-	c.JSON(http.StatusOK, response)
+	return api.infoCache.Load(ctx, userId, load) //nolint:wrapcheck
 }
 
-type productName string
+// forgetInfo drops the cached /api/info of users whose balance or history changed.
+func (api *API) forgetInfo(userIds ...uuid.UUID) {
+	if api.infoCache != nil {
+		api.infoCache.Forget(userIds...)
+	}
+}
+
+func makeInfoResponse(info model.UserInfo, full bool) openapi.InfoResponse {
+	inventory := make([]openapi.InfoResponseInventoryInner, 0, len(info.Inventory))
+	for _, i := range info.Inventory {
+		item := openapi.InfoResponseInventoryInner{
+			Type:     i.ProductTitle,
+			Variant:  i.VariantSKU,
+			Quantity: int32(i.Count), //nolint:gosec
+		}
+		if full {
+			item.AcquiredAt = &i.AcquiredAt
+		}
+
+		inventory = append(inventory, item)
+	}
+
+	orders := make([]openapi.Order, 0, len(info.Orders))
+	for _, o := range info.Orders {
+		orders = append(orders, makeOrderResponse(o))
+	}
 
-func makeInfoResponseInventory(orders []model.Order) []openapi.InfoResponseInventoryInner {
-	inventory := make([]openapi.InfoResponseInventoryInner, 0)
-	productCounter := make(map[productName]int)
+	sent := make([]openapi.InfoResponseCoinHistorySentInner, 0, len(info.Sent))
+	for _, t := range info.Sent {
+		item := openapi.InfoResponseCoinHistorySentInner{
+			ToUser:   t.ToUserName,
+			Amount:   int32(t.Amount), //nolint:gosec
+			Memo:     t.Memo,
+			Category: t.Category,
+		}
+		if full {
+			item.Id, item.CreatedAt = t.ID.String(), &t.CreatedAt
+		}
+
+		sent = append(sent, item)
+	}
 
-	for _, order := range orders {
-		productCounter[productName(order.ProductTitle)]++
+	received := make([]openapi.InfoResponseCoinHistoryReceivedInner, 0, len(info.Received))
+	for _, t := range info.Received {
+		item := openapi.InfoResponseCoinHistoryReceivedInner{
+			FromUser: t.FromUserName,
+			Amount:   int32(t.Amount), //nolint:gosec
+			Memo:     t.Memo,
+			Category: t.Category,
+		}
+		if full {
+			item.Id, item.CreatedAt = t.ID.String(), &t.CreatedAt
+		}
+
+		received = append(received, item)
 	}
 
-	for title, count := range productCounter {
-		inventory = append(inventory,
-			openapi.InfoResponseInventoryInner{
-				Type:     string(title),
-				Quantity: int32(count), //nolint:gosec
-			})
+	expiringCoins := make([]openapi.InfoResponseExpiringCoinsInner, 0, len(info.Expirations))
+	for _, e := range info.Expirations {
+		expiringCoins = append(expiringCoins, openapi.InfoResponseExpiringCoinsInner{
+			Amount:    int32(e.Amount), //nolint:gosec
+			ExpiresAt: e.ExpiresAt,
+		})
 	}
 
-	return inventory
+	return openapi.InfoResponse{
+		Coins:     int32(info.Balance), //nolint:gosec
+		Inventory: inventory,
+		Orders:    orders,
+		CoinHistory: openapi.InfoResponseCoinHistory{
+			Received: received,
+			Sent:     sent,
+		},
+		ExpiringCoins: expiringCoins,
+	}
 }
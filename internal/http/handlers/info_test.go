@@ -5,13 +5,13 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
-	"sort"
 	"testing"
 	"time"
 
 	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
 	"github.com/6ermvH/MerchShop/gen/openapi"
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/infocache"
 	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
@@ -45,7 +45,7 @@ func TestInfo_NoUserInContext_401(t *testing.T) {
 	require.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
-func TestInfo_FindOrdersError_500(t *testing.T) {
+func TestInfo_FindUserInfoError_500(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	ctrl := gomock.NewController(t)
@@ -54,8 +54,8 @@ func TestInfo_FindOrdersError_500(t *testing.T) {
 	user := model.User{ID: uuid.New(), Username: "u", Balance: 100, CreatedAt: time.Now()}
 	repoMock := mock_repo.NewMockMerchRepo(ctrl)
 	repoMock.EXPECT().
-		FindOrdersByUserID(gomock.Any(), user.ID).
-		Return(nil, errors.New("db"))
+		FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+		Return(model.UserInfo{}, errors.New("db"))
 
 	api := NewAPI(repoMock, nil)
 	r := gin.New()
@@ -68,22 +68,37 @@ func TestInfo_FindOrdersError_500(t *testing.T) {
 	require.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
-func TestInfo_FindTransfersFromError_500(t *testing.T) {
+func TestInfo_OK(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 130}
 	repoMock := mock_repo.NewMockMerchRepo(ctrl)
 
+	expiresAt := time.Date(2026, 11, 10, 12, 0, 0, 0, time.UTC)
 	repoMock.EXPECT().
-		FindOrdersByUserID(gomock.Any(), user.ID).
-		Return([]model.Order{{ProductTitle: "coffee", ProductPrice: 50, CreatedAt: time.Now()}}, nil)
-
-	repoMock.EXPECT().
-		FindTransfersFromID(gomock.Any(), user.ID).
-		Return(nil, errors.New("db"))
+		FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+		Return(model.UserInfo{
+			Balance: 120,
+			Inventory: []model.InventoryItem{
+				{ProductTitle: "coffee", Count: 2},
+				{ProductTitle: "t-shirt", VariantSKU: "t-shirt-m", Count: 2},
+			},
+			Orders: []model.Order{
+				{ProductTitle: "tea", ProductPrice: 30, Count: 1, Status: model.OrderStatusRefunded},
+				{ProductTitle: "coffee", ProductPrice: 50, Count: 2, Status: model.OrderStatusPlaced},
+			},
+			Sent: []model.Transfer{
+				{ToUserName: "charlie", Amount: 7, Memo: "for lunch", Category: "thanks"},
+			},
+			Received: []model.Transfer{
+				{FromUserName: "bob", Amount: 5, Category: "birthday"},
+				{FromUserName: "alice", Amount: 10},
+			},
+			Expirations: []model.CoinExpiration{{Amount: 100, ExpiresAt: expiresAt}},
+		}, nil)
 
 	api := NewAPI(repoMock, nil)
 	r := gin.New()
@@ -93,10 +108,32 @@ func TestInfo_FindTransfersFromError_500(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
 	r.ServeHTTP(w, req)
 
-	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.InfoResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Equal(t, int32(120), resp.Coins)
+	require.Len(t, resp.Orders, 2)
+	require.Equal(t, "refunded", resp.Orders[0].Status)
+	require.Equal(t, []openapi.InfoResponseInventoryInner{
+		{Type: "coffee", Quantity: 2},
+		{Type: "t-shirt", Variant: "t-shirt-m", Quantity: 2},
+	}, resp.Inventory)
+	require.Equal(t, []openapi.InfoResponseCoinHistoryReceivedInner{
+		{FromUser: "bob", Amount: 5, Category: "birthday"},
+		{FromUser: "alice", Amount: 10},
+	}, resp.CoinHistory.Received)
+	require.Equal(t, []openapi.InfoResponseCoinHistorySentInner{
+		{ToUser: "charlie", Amount: 7, Memo: "for lunch", Category: "thanks"},
+	}, resp.CoinHistory.Sent)
+	require.Equal(t, []openapi.InfoResponseExpiringCoinsInner{
+		{Amount: 100, ExpiresAt: expiresAt},
+	}, resp.ExpiringCoins)
 }
 
-func TestInfo_FindTransfersToError_500(t *testing.T) {
+func TestInfo_CachedUntilPurchase(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	ctrl := gomock.NewController(t)
@@ -105,96 +142,111 @@ func TestInfo_FindTransfersToError_500(t *testing.T) {
 	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
 	repoMock := mock_repo.NewMockMerchRepo(ctrl)
 
-	repoMock.EXPECT().
-		FindOrdersByUserID(gomock.Any(), user.ID).
-		Return([]model.Order{{ProductTitle: "coffee", ProductPrice: 50, CreatedAt: time.Now()}}, nil)
-
-	repoMock.EXPECT().
-		FindTransfersFromID(gomock.Any(), user.ID).
-		Return([]model.Transfer{}, nil)
-
-	repoMock.EXPECT().
-		FindTransfersToID(gomock.Any(), user.ID).
-		Return(nil, errors.New("db"))
+	gomock.InOrder(
+		repoMock.EXPECT().
+			FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+			Return(model.UserInfo{Balance: 100}, nil),
+		repoMock.EXPECT().
+			BuyProduct(gomock.Any(), user.ID, gomock.Any()).
+			Return(model.Order{}, nil),
+		repoMock.EXPECT().
+			FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+			Return(model.UserInfo{Balance: 90}, nil),
+	)
 
-	api := NewAPI(repoMock, nil)
+	api := NewAPI(repoMock, nil, WithInfoCache(infocache.New(time.Minute, 0)))
 	r := gin.New()
 	r.GET("/api/info", withUser(user), api.ApiInfoGet)
+	r.GET("/api/buy/:item", withUser(user), api.ApiBuyItemGet)
+
+	coins := func() int32 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/info", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp openapi.InfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		return resp.Coins
+	}
+
+	require.Equal(t, int32(100), coins())
+	require.Equal(t, int32(100), coins())
 
 	w := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
-	r.ServeHTTP(w, req)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/buy/pen", nil))
+	require.Equal(t, http.StatusOK, w.Code)
 
-	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, int32(90), coins())
 }
 
-func TestInfo_OK_Aggregates(t *testing.T) {
+func TestInfo_DetailFull(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	user := model.User{ID: uuid.New(), Username: "u", Balance: 130}
+	user := model.User{ID: uuid.New(), Username: "u"}
 	repoMock := mock_repo.NewMockMerchRepo(ctrl)
 
-	orders := []model.Order{
-		{ProductTitle: "coffee", ProductPrice: 50},
-		{ProductTitle: "coffee", ProductPrice: 50},
-		{ProductTitle: "tea", ProductPrice: 30},
-	}
-	repoMock.EXPECT().
-		FindOrdersByUserID(gomock.Any(), user.ID).
-		Return(orders, nil)
+	sentAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	receivedAt := sentAt.Add(time.Hour)
+	sent := model.Transfer{ID: uuid.New(), ToUserName: "bob", Amount: 7, CreatedAt: sentAt}
+	received := model.Transfer{ID: uuid.New(), FromUserName: "alice", Amount: 3, CreatedAt: receivedAt}
 
-	recv := []model.Transfer{
-		{FromUserName: "alice", Amount: 10},
-		{FromUserName: "bob", Amount: 5},
-	}
 	repoMock.EXPECT().
-		FindTransfersFromID(gomock.Any(), user.ID).
-		Return(recv, nil)
-
-	sent := []model.Transfer{
-		{ToUserName: "charlie", Amount: 7},
-	}
-	repoMock.EXPECT().
-		FindTransfersToID(gomock.Any(), user.ID).
-		Return(sent, nil)
+		FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+		Return(model.UserInfo{
+			Inventory: []model.InventoryItem{{ProductTitle: "pen", Count: 1, AcquiredAt: sentAt}},
+			Sent:      []model.Transfer{sent},
+			Received:  []model.Transfer{received},
+		}, nil).
+		Times(2)
 
 	api := NewAPI(repoMock, nil)
 	r := gin.New()
 	r.GET("/api/info", withUser(user), api.ApiInfoGet)
 
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
-	r.ServeHTTP(w, req)
+	get := func(url string) openapi.InfoResponse {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		require.Equal(t, http.StatusOK, w.Code)
 
-	require.Equal(t, http.StatusOK, w.Code)
+		var resp openapi.InfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 
-	var resp openapi.InfoResponse
+		return resp
+	}
 
-	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	full := get("/api/info?detail=full")
+	require.Equal(t, []openapi.InfoResponseInventoryInner{
+		{Type: "pen", Quantity: 1, AcquiredAt: &sentAt},
+	}, full.Inventory)
+	require.Equal(t, []openapi.InfoResponseCoinHistorySentInner{
+		{Id: sent.ID.String(), ToUser: "bob", Amount: 7, CreatedAt: &sentAt},
+	}, full.CoinHistory.Sent)
+	require.Equal(t, []openapi.InfoResponseCoinHistoryReceivedInner{
+		{Id: received.ID.String(), FromUser: "alice", Amount: 3, CreatedAt: &receivedAt},
+	}, full.CoinHistory.Received)
 
-	require.Equal(t, int32(user.Balance), resp.Coins)
+	summary := get("/api/info")
+	require.Nil(t, summary.Inventory[0].AcquiredAt)
+	require.Empty(t, summary.CoinHistory.Sent[0].Id)
+	require.Nil(t, summary.CoinHistory.Received[0].CreatedAt)
+}
 
-	sort.Slice(
-		resp.Inventory,
-		func(i, j int) bool { return resp.Inventory[i].Type < resp.Inventory[j].Type },
-	)
-	require.Equal(t, []openapi.InfoResponseInventoryInner{
-		{Type: "coffee", Quantity: 2},
-		{Type: "tea", Quantity: 1},
-	}, resp.Inventory)
+func TestInfo_BadDetail_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
 
-	sort.Slice(resp.CoinHistory.Received, func(i, j int) bool {
-		return resp.CoinHistory.Received[i].FromUser < resp.CoinHistory.Received[j].FromUser
-	})
-	require.Equal(t, []openapi.InfoResponseCoinHistoryReceivedInner{
-		{FromUser: "alice", Amount: 10},
-		{FromUser: "bob", Amount: 5},
-	}, resp.CoinHistory.Received)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	require.Equal(t, []openapi.InfoResponseCoinHistorySentInner{
-		{ToUser: "charlie", Amount: 7},
-	}, resp.CoinHistory.Sent)
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/info", withUser(model.User{ID: uuid.New()}), api.ApiInfoGet)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/info?detail=everything", nil))
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
 }
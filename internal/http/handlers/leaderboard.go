@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultLeaderboardLimit = 10
+
+var errBadWindow = errors.New("bad window, want week, month or all")
+
+func (api *API) ApiLeaderboardGet(c *gin.Context) {
+	window := model.LeaderboardWindow(c.DefaultQuery("window", string(model.LeaderboardMonth)))
+
+	if !window.Valid() {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: errBadWindow.Error()})
+
+		return
+	}
+
+	limit := defaultLeaderboardLimit
+
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: errBadPage.Error()})
+
+			return
+		}
+
+		limit = min(v, maxPageLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	board, err := api.repos.FindLeaderboard(ctx, window, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, openapi.LeaderboardResponse{
+		Window:       string(window),
+		TopReceivers: makeLeaderboardEntries(board.TopReceivers),
+		TopSenders:   makeLeaderboardEntries(board.TopSenders),
+		MostGenerous: makeLeaderboardEntries(board.MostGenerous),
+	})
+}
+
+func makeLeaderboardEntries(entries []model.LeaderboardEntry) []openapi.LeaderboardEntry {
+	items := make([]openapi.LeaderboardEntry, 0, len(entries))
+	for i, e := range entries {
+		items = append(items, openapi.LeaderboardEntry{
+			Rank:      int32(i + 1), //nolint:gosec
+			User:      e.UserName,
+			Value:     int32(e.Amount), //nolint:gosec
+			Transfers: int32(e.Count),  //nolint:gosec
+		})
+	}
+
+	return items
+}
+
+func (api *API) ApiUsersUsernameStatsGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	me := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	user := me
+	if username := c.Param("username"); username != me.Username {
+		var err error
+		if user, err = api.repos.FindUserByUsername(ctx, username); err != nil {
+			writeStatsError(c, err)
+
+			return
+		}
+	}
+
+	stats, err := api.repos.FindUserStats(ctx, user.ID)
+	if err != nil {
+		writeStatsError(c, err)
+
+		return
+	}
+
+	// Opting out of ranking hides the numbers from everyone but the user.
+	if stats.LeaderboardOptOut && user.ID != me.ID {
+		writeStatsError(c, repo.ErrNotFound)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, openapi.UserStats{
+		User:              stats.UserName,
+		Sent:              int32(stats.Sent),           //nolint:gosec
+		SentCount:         int32(stats.SentCount),      //nolint:gosec
+		Received:          int32(stats.Received),       //nolint:gosec
+		ReceivedCount:     int32(stats.ReceivedCount),  //nolint:gosec
+		Counterparties:    int32(stats.Counterparties), //nolint:gosec
+		FavouriteProduct:  stats.FavouriteProduct,
+		LeaderboardOptOut: stats.LeaderboardOptOut,
+	})
+}
+
+func writeStatsError(c *gin.Context, err error) {
+	if errors.Is(err, repo.ErrNotFound) {
+		c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "user not found"})
+
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+}
+
+func (api *API) ApiLeaderboardPreferencesPut(c *gin.Context) {
+	var request openapi.LeaderboardPreferences
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	if err := api.repos.SetLeaderboardOptOut(ctx, user.ID, request.OptOut); err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
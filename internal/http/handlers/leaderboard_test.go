@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderboard_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindLeaderboard(gomock.Any(), model.LeaderboardWeek, 5).
+		Return(model.Leaderboard{
+			TopReceivers: []model.LeaderboardEntry{
+				{UserName: "alice", Amount: 50, Count: 4},
+				{UserName: "bob", Amount: 20, Count: 1},
+			},
+			MostGenerous: []model.LeaderboardEntry{{UserName: "carol", Amount: 3, Count: 5}},
+		}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/leaderboard", withUser(user), api.ApiLeaderboardGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/leaderboard?window=week&limit=5", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.LeaderboardResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, openapi.LeaderboardResponse{
+		Window: "week",
+		TopReceivers: []openapi.LeaderboardEntry{
+			{Rank: 1, User: "alice", Value: 50, Transfers: 4},
+			{Rank: 2, User: "bob", Value: 20, Transfers: 1},
+		},
+		MostGenerous: []openapi.LeaderboardEntry{{Rank: 1, User: "carol", Value: 3, Transfers: 5}},
+	}, resp)
+}
+
+func TestLeaderboard_AllTime_DefaultLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindLeaderboard(gomock.Any(), model.LeaderboardAll, defaultLeaderboardLimit).
+		Return(model.Leaderboard{}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/leaderboard", api.ApiLeaderboardGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/leaderboard?window=all", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLeaderboard_BadQuery_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/leaderboard", api.ApiLeaderboardGet)
+
+	for _, query := range []string{"window=year", "limit=0", "limit=x"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/leaderboard?"+query, nil)
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestUserStats_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "u"}
+	other := model.User{ID: uuid.New(), Username: "alice"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "alice").Return(other, nil)
+	repoMock.EXPECT().FindUserStats(gomock.Any(), other.ID).Return(model.UserStats{
+		UserName:         "alice",
+		Sent:             30,
+		SentCount:        2,
+		Received:         15,
+		ReceivedCount:    1,
+		Counterparties:   3,
+		FavouriteProduct: "cup",
+	}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/users/:username/stats", withUser(me), api.ApiUsersUsernameStatsGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/users/alice/stats", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.UserStats
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, openapi.UserStats{
+		User:             "alice",
+		Sent:             30,
+		SentCount:        2,
+		Received:         15,
+		ReceivedCount:    1,
+		Counterparties:   3,
+		FavouriteProduct: "cup",
+	}, resp)
+}
+
+func TestUserStats_OptedOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "u"}
+	other := model.User{ID: uuid.New(), Username: "alice"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "alice").Return(other, nil)
+	repoMock.EXPECT().
+		FindUserStats(gomock.Any(), other.ID).
+		Return(model.UserStats{UserName: "alice", LeaderboardOptOut: true}, nil)
+	repoMock.EXPECT().
+		FindUserStats(gomock.Any(), me.ID).
+		Return(model.UserStats{UserName: "u", LeaderboardOptOut: true}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/users/:username/stats", withUser(me), api.ApiUsersUsernameStatsGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/users/alice/stats", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/users/u/stats", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLeaderboardPreferences_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().SetLeaderboardOptOut(gomock.Any(), user.ID, true).Return(nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.PUT("/api/leaderboard/preferences", withUser(user), api.ApiLeaderboardPreferencesPut)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/leaderboard/preferences",
+		bytes.NewBufferString(`{"optOut":true}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"optOut":true}`, w.Body.String())
+}
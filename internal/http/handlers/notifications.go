@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (api *API) ApiNotificationsGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	var (
+		filter model.NotificationFilter
+		err    error
+	)
+
+	if raw := c.Query("unread"); raw != "" {
+		if filter.UnreadOnly, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad unread"})
+
+			return
+		}
+	}
+
+	filter.Limit, filter.Offset, err = parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	notifications, err := api.repos.FindNotifications(ctx, user.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	unread, err := api.repos.CountUnreadNotifications(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.Notification, 0, len(notifications))
+	for _, n := range notifications {
+		items = append(items, openapi.Notification{
+			Id:        n.ID.String(),
+			Kind:      string(n.Kind),
+			Message:   n.Message,
+			Data:      n.Data,
+			Read:      n.ReadAt != nil,
+			CreatedAt: n.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, openapi.NotificationsResponse{
+		Unread:        int32(unread), //nolint:gosec
+		Notifications: items,
+	})
+}
+
+func (api *API) ApiNotificationsReadPost(c *gin.Context) {
+	var request openapi.NotificationsReadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	if !request.All && len(request.Ids) == 0 {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "ids or all required"})
+
+		return
+	}
+
+	var ids []uuid.UUID
+
+	if !request.All {
+		ids = make([]uuid.UUID, 0, len(request.Ids))
+
+		for _, raw := range request.Ids {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad notification id"})
+
+				return
+			}
+
+			ids = append(ids, id)
+		}
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	marked, err := api.repos.MarkNotificationsRead(ctx, user.ID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	unread, err := api.repos.CountUnreadNotifications(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, openapi.NotificationsReadResponse{
+		Marked: int32(marked), //nolint:gosec
+		Unread: int32(unread), //nolint:gosec
+	})
+}
+
+func (api *API) ApiNotificationsPreferencesGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	kinds, err := api.repos.FindMutedNotificationKinds(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeNotificationPreferences(kinds))
+}
+
+func (api *API) ApiNotificationsPreferencesPut(c *gin.Context) {
+	var request openapi.NotificationPreferences
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	kinds := make([]model.NotificationKind, 0, len(request.Muted))
+	for _, raw := range request.Muted {
+		kind := model.NotificationKind(raw)
+		if !kind.Valid() {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "unknown notification kind"})
+
+			return
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	if err := api.repos.SetMutedNotificationKinds(ctx, user.ID, kinds); err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeNotificationPreferences(kinds))
+}
+
+func makeNotificationPreferences(kinds []model.NotificationKind) openapi.NotificationPreferences {
+	muted := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		muted = append(muted, string(kind))
+	}
+
+	return openapi.NotificationPreferences{Muted: muted}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifications_List_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	at := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+	notification := model.Notification{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Kind:      model.NotificationCoinsReceived,
+		Message:   "alice sent you 10 coins",
+		Data:      map[string]string{"from": "alice", "amount": "10"},
+		CreatedAt: at,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindNotifications(gomock.Any(), user.ID, model.NotificationFilter{
+			UnreadOnly: true,
+			Limit:      10,
+			Offset:     20,
+		}).
+		Return([]model.Notification{notification}, nil)
+	repoMock.EXPECT().CountUnreadNotifications(gomock.Any(), user.ID).Return(int64(3), nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/notifications", withUser(user), api.ApiNotificationsGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/notifications?unread=true&limit=10&offset=20", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.NotificationsResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, openapi.NotificationsResponse{
+		Unread: 3,
+		Notifications: []openapi.Notification{{
+			Id:        notification.ID.String(),
+			Kind:      "coins_received",
+			Message:   "alice sent you 10 coins",
+			Data:      map[string]string{"from": "alice", "amount": "10"},
+			CreatedAt: at,
+		}},
+	}, resp)
+}
+
+func TestNotifications_List_BadQuery_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/notifications", withUser(model.User{ID: uuid.New()}), api.ApiNotificationsGet)
+
+	for _, query := range []string{"?unread=maybe", "?limit=0", "?offset=-1"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/notifications"+query, nil)
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "query %s", query)
+	}
+}
+
+func TestNotifications_MarkRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	id := uuid.New()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	gomock.InOrder(
+		repoMock.EXPECT().
+			MarkNotificationsRead(gomock.Any(), user.ID, []uuid.UUID{id}).
+			Return(int64(1), nil),
+		repoMock.EXPECT().CountUnreadNotifications(gomock.Any(), user.ID).Return(int64(2), nil),
+		repoMock.EXPECT().
+			MarkNotificationsRead(gomock.Any(), user.ID, gomock.Nil()).
+			Return(int64(2), nil),
+		repoMock.EXPECT().CountUnreadNotifications(gomock.Any(), user.ID).Return(int64(0), nil),
+	)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/notifications/read", withUser(user), api.ApiNotificationsReadPost)
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"ids":["` + id.String() + `"]}`, http.StatusOK},
+		{`{"all":true}`, http.StatusOK},
+		{`{}`, http.StatusBadRequest},
+		{`{"ids":["nope"]}`, http.StatusBadRequest},
+	}
+	for i, cse := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/notifications/read",
+			bytes.NewBufferString(cse.body),
+		)
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, cse.want, w.Code, "case %d", i)
+	}
+}
+
+func TestNotifications_Preferences(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	muted := []model.NotificationKind{model.NotificationPriceDrop}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().SetMutedNotificationKinds(gomock.Any(), user.ID, muted).Return(nil)
+	repoMock.EXPECT().FindMutedNotificationKinds(gomock.Any(), user.ID).Return(muted, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.PUT("/api/notifications/preferences", withUser(user), api.ApiNotificationsPreferencesPut)
+	r.GET("/api/notifications/preferences", withUser(user), api.ApiNotificationsPreferencesGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/notifications/preferences",
+		bytes.NewBufferString(`{"muted":["birthday"]}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(
+		http.MethodPut,
+		"/api/notifications/preferences",
+		bytes.NewBufferString(`{"muted":["price_drop"]}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/notifications/preferences", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"muted":["price_drop"]}`, w.Body.String())
+}
+
+func TestAdminBalance_Adjust(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "alice", Balance: 100}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "alice").Return(user, nil).Times(2)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "bob").Return(model.User{}, repo.ErrNotFound)
+	gomock.InOrder(
+		repoMock.EXPECT().
+			AdjustBalance(gomock.Any(), user.ID, int64(50), "hackathon prize").
+			Return(model.User{Username: "alice", Balance: 150}, nil),
+		repoMock.EXPECT().
+			AdjustBalance(gomock.Any(), user.ID, int64(-500), "").
+			Return(model.User{}, repo.ErrInsufficient),
+	)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/admin/users/:username/balance", api.ApiAdminUsersUsernameBalancePost)
+
+	cases := []struct {
+		user string
+		body string
+		want int
+	}{
+		{"alice", `{"amount":50,"reason":" hackathon\nprize "}`, http.StatusOK},
+		{"alice", `{"amount":-500}`, http.StatusUnprocessableEntity},
+		{"bob", `{"amount":5}`, http.StatusNotFound},
+		{"alice", `{"amount":0}`, http.StatusBadRequest},
+	}
+	for i, cse := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/admin/users/"+cse.user+"/balance",
+			bytes.NewBufferString(cse.body),
+		)
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, cse.want, w.Code, "case %d", i)
+	}
+}
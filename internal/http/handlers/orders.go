@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultOrderCancelWindow = 15 * time.Minute
+
+// WithOrderCancelWindow sets how long after a purchase the buyer may cancel it.
+func WithOrderCancelWindow(d time.Duration) Option {
+	return func(api *API) {
+		api.cancelWindow = d
+	}
+}
+
+func (api *API) ApiOrdersGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	orders, err := api.repos.FindOrdersByUserID(api.ownReads(ctx, user.ID), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.Order, 0, len(orders))
+	for _, o := range orders {
+		items = append(items, makeOrderResponse(o))
+	}
+
+	c.JSON(http.StatusOK, openapi.OrdersResponse{Orders: items})
+}
+
+func (api *API) ApiOrdersIdCancelPost(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad order id"})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	order, err := api.repos.CancelOrder(ctx, user.ID, orderID, api.cancelWindow)
+	if err != nil {
+		writeOrderError(c, err)
+
+		return
+	}
+
+	api.changed(user.ID)
+
+	c.JSON(http.StatusOK, makeOrderResponse(order))
+}
+
+func (api *API) ApiAdminOrdersIdRefundPost(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad order id"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	order, err := api.repos.RefundOrder(ctx, orderID)
+	if err != nil {
+		writeOrderError(c, err)
+
+		return
+	}
+
+	api.changed(order.UserID)
+
+	c.JSON(http.StatusOK, makeOrderResponse(order))
+}
+
+func writeOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "order not found"})
+	case errors.Is(err, repo.ErrOrderNotCancellable):
+		c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrOrderNotCancellable.Error()})
+	case errors.Is(err, repo.ErrCancelWindowExpired):
+		c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrCancelWindowExpired.Error()})
+	case errors.Is(err, repo.ErrOrderNotRefundable):
+		c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrOrderNotRefundable.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+	}
+}
+
+func makeOrderResponse(o model.Order) openapi.Order {
+	return openapi.Order{
+		Id:               o.ID.String(),
+		User:             o.UserName,
+		Product:          o.ProductTitle,
+		Variant:          o.VariantSKU,
+		Price:            int32(o.ProductPrice), //nolint:gosec
+		Quantity:         o.Count,
+		PricePaid:        int32(o.PricePaid), //nolint:gosec
+		PromoCode:        o.PromoCode,
+		Status:           string(o.Status),
+		CreatedAt:        o.CreatedAt,
+		PackedAt:         o.Timeline.PackedAt,
+		ReadyForPickupAt: o.Timeline.ReadyForPickupAt,
+		DeliveredAt:      o.Timeline.DeliveredAt,
+		CancelledAt:      o.Timeline.CancelledAt,
+		RefundedAt:       o.Timeline.RefundedAt,
+	}
+}
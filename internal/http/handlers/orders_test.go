@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/jwtutil"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrders_List_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	at := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+	order := model.Order{
+		ID:           uuid.New(),
+		ProductTitle: "cup",
+		ProductPrice: 20,
+		Status:       model.OrderStatusCancelled,
+		CreatedAt:    at,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindOrdersByUserID(gomock.Any(), user.ID).Return([]model.Order{order}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/orders", withUser(user), api.ApiOrdersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.OrdersResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, []openapi.Order{{
+		Id:        order.ID.String(),
+		Product:   "cup",
+		Price:     20,
+		Status:    "cancelled",
+		CreatedAt: at,
+	}}, resp.Orders)
+}
+
+func TestOrders_Cancel_BadID_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.POST("/api/orders/:id/cancel", withUser(model.User{ID: uuid.New()}), api.ApiOrdersIdCancelPost)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders/not-a-uuid/cancel", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOrders_Cancel_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{err: repo.ErrNotFound, want: http.StatusNotFound},
+		{err: fmt.Errorf("tx fn: %w", repo.ErrCancelWindowExpired), want: http.StatusConflict},
+		{err: repo.ErrOrderNotCancellable, want: http.StatusConflict},
+		{err: errors.New("db"), want: http.StatusInternalServerError},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.err.Error(), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := model.User{ID: uuid.New(), Username: "u"}
+			orderID := uuid.New()
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			repoMock.EXPECT().
+				CancelOrder(gomock.Any(), user.ID, orderID, 10*time.Minute).
+				Return(model.Order{}, cse.err)
+
+			api := NewAPI(repoMock, nil, WithOrderCancelWindow(10*time.Minute))
+			r := gin.New()
+			r.POST("/api/orders/:id/cancel", withUser(user), api.ApiOrdersIdCancelPost)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/orders/"+orderID.String()+"/cancel", nil)
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
+
+func TestOrders_Cancel_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	order := model.Order{ID: uuid.New(), ProductTitle: "pink-hoody", Status: model.OrderStatusCancelled}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		CancelOrder(gomock.Any(), user.ID, order.ID, defaultOrderCancelWindow).
+		Return(order, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/orders/:id/cancel", withUser(user), api.ApiOrdersIdCancelPost)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders/"+order.ID.String()+"/cancel", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.Order
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "cancelled", resp.Status)
+}
+
+func TestOrders_Refund_RequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	orderID := uuid.New()
+	j := jwtutil.NewHS256("is-my-private-secret-key-hello-world", "merch", "merch")
+
+	cases := []struct {
+		role model.Role
+		want int
+	}{
+		{role: model.RoleUser, want: http.StatusForbidden},
+		{role: model.RoleAdmin, want: http.StatusOK},
+	}
+
+	for _, cse := range cases {
+		t.Run(string(cse.role), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := model.User{ID: uuid.New(), Username: "boss", Role: cse.role}
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			repoMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+
+			if cse.role == model.RoleAdmin {
+				repoMock.EXPECT().
+					RefundOrder(gomock.Any(), orderID).
+					Return(model.Order{ID: orderID, Status: model.OrderStatusRefunded}, nil)
+			}
+
+			r := gin.New()
+			NewAPI(repoMock, j).RegisterRoutes(r)
+
+			token, _ := j.Sign(user.ID, user.Username)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/api/admin/orders/"+orderID.String()+"/refund",
+				nil,
+			)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
+
+func TestOrders_Refund_AlreadyReturned_409(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderID := uuid.New()
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		RefundOrder(gomock.Any(), orderID).
+		Return(model.Order{}, repo.ErrOrderNotRefundable)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/admin/orders/:id/refund", api.ApiAdminOrdersIdRefundPost)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/orders/"+orderID.String()+"/refund", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+var errBadPage = errors.New("bad limit or offset")
+
+func parsePage(c *gin.Context) (int, int, error) {
+	limit, offset := defaultPageLimit, 0
+
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return 0, 0, errBadPage
+		}
+
+		limit = min(v, maxPageLimit)
+	}
+
+	if raw := c.Query("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return 0, 0, errBadPage
+		}
+
+		offset = v
+	}
+
+	return limit, offset, nil
+}
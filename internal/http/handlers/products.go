@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	errBadSort  = errors.New("bad sort")
+	errBadPrice = errors.New("bad price range")
+)
+
+func (api *API) ApiProductsGet(c *gin.Context) {
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	products, err := api.repos.FindProducts(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.Product, 0, len(products))
+	for _, p := range products {
+		items = append(items, makeProductResponse(p, nil))
+	}
+
+	c.JSON(http.StatusOK, openapi.ProductsResponse{Products: items})
+}
+
+func (api *API) ApiProductsIdGet(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad product id"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	product, err := api.repos.FindProductByID(ctx, productID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "product not found"})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	variants, err := api.repos.FindVariantsByProductID(ctx, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeProductResponse(product, variants))
+}
+
+func (api *API) ApiAdminProductsIdPatch(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad product id"})
+
+		return
+	}
+
+	var request openapi.ProductUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	if request.Price != nil && *request.Price < 0 {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad price"})
+
+		return
+	}
+
+	update := model.ProductUpdate{Restock: int64(request.Restock)}
+	if request.Price != nil {
+		price := int64(*request.Price)
+		update.Price = &price
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	if request.Variant != "" {
+		variants, err := api.repos.FindVariantsByProductID(ctx, productID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+			return
+		}
+
+		for _, v := range variants {
+			if strings.EqualFold(v.SKU, request.Variant) {
+				update.VariantID = &v.ID
+			}
+		}
+
+		if update.VariantID == nil {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "unknown variant"})
+
+			return
+		}
+	}
+
+	product, err := api.repos.UpdateProduct(ctx, productID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "product not found"})
+		case errors.Is(err, repo.ErrOutOfStock):
+			c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: "stock cannot go below zero"})
+		default:
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+		}
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeProductResponse(product, nil))
+}
+
+func parseProductFilter(c *gin.Context) (model.ProductFilter, error) {
+	var (
+		filter model.ProductFilter
+		err    error
+	)
+
+	filter.Query = strings.TrimSpace(c.Query("q"))
+
+	filter.Sort = model.ProductSort(c.DefaultQuery("sort", string(model.ProductSortName)))
+	switch filter.Sort {
+	case model.ProductSortName, model.ProductSortNameDesc,
+		model.ProductSortPrice, model.ProductSortPriceDesc:
+	default:
+		return filter, errBadSort
+	}
+
+	if filter.MinPrice, err = parsePrice(c.Query("minPrice")); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxPrice, err = parsePrice(c.Query("maxPrice")); err != nil {
+		return filter, err
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, errBadPrice
+	}
+
+	filter.Limit, filter.Offset, err = parsePage(c)
+
+	return filter, err
+}
+
+func parsePrice(raw string) (*int64, error) {
+	if raw == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v < 0 {
+		return nil, errBadPrice
+	}
+
+	return &v, nil
+}
+
+func makeProductResponse(p model.Product, variants []model.ProductVariant) openapi.Product {
+	resp := openapi.Product{
+		Id:          p.ID.String(),
+		Title:       p.Title,
+		Price:       int32(p.Price), //nolint:gosec
+		Description: p.Description,
+		ImageUrl:    p.ImageURL,
+		Available:   p.Available,
+		Stock:       toInt32Ptr(p.Stock),
+	}
+
+	for _, v := range variants {
+		resp.Variants = append(resp.Variants, openapi.ProductVariant{
+			Id:         v.ID.String(),
+			Sku:        v.SKU,
+			Attributes: v.Attributes,
+			Price:      int32(v.PriceOr(p.Price)), //nolint:gosec
+			Stock:      toInt32Ptr(v.Stock),
+			Available:  v.InStock(),
+			Default:    v.Default,
+		})
+	}
+
+	return resp
+}
+
+func toInt32Ptr(v *int64) *int32 {
+	if v == nil {
+		return nil
+	}
+
+	r := int32(*v) //nolint:gosec
+
+	return &r
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProducts_BadFilter_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/products", api.ApiProductsGet)
+
+	queries := []string{
+		"?sort=popularity",
+		"?minPrice=cheap",
+		"?maxPrice=-1",
+		"?minPrice=100&maxPrice=10",
+		"?offset=x",
+	}
+	for _, q := range queries {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/products"+q, nil)
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "query %s", q)
+	}
+}
+
+func TestProducts_List_IsPublic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	minPrice, maxPrice := int64(10), int64(100)
+	stock := int64(3)
+	cup := model.Product{ID: uuid.New(), Title: "cup", Price: 20, Stock: &stock, Available: true}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindProducts(gomock.Any(), model.ProductFilter{
+			Query:    "cu",
+			MinPrice: &minPrice,
+			MaxPrice: &maxPrice,
+			Sort:     model.ProductSortPriceDesc,
+			Limit:    20,
+		}).
+		Return([]model.Product{cup}, nil)
+
+	r := gin.New()
+	NewAPI(repoMock, nil).RegisterRoutes(r)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/products?q=%20cu%20&minPrice=10&maxPrice=100&sort=-price&limit=20",
+		nil,
+	)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.ProductsResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Products, 1)
+	require.Equal(t, "cup", resp.Products[0].Title)
+	require.True(t, resp.Products[0].Available)
+	require.Equal(t, int32(3), *resp.Products[0].Stock)
+}
+
+func TestProducts_List_DBError_500(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindProducts(gomock.Any(), gomock.Any()).Return(nil, errors.New("db"))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/products", api.ApiProductsGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestProducts_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	productID := uuid.New()
+
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{name: "bad id", path: "/api/products/cup", want: http.StatusBadRequest},
+		{
+			name: "not found",
+			path: "/api/products/" + productID.String(),
+			err:  repo.ErrNotFound,
+			want: http.StatusNotFound,
+		},
+		{
+			name: "db error",
+			path: "/api/products/" + productID.String(),
+			err:  errors.New("db"),
+			want: http.StatusInternalServerError,
+		},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			if cse.err != nil {
+				repoMock.EXPECT().
+					FindProductByID(gomock.Any(), productID).
+					Return(model.Product{}, cse.err)
+			}
+
+			api := NewAPI(repoMock, nil)
+			r := gin.New()
+			r.GET("/api/products/:id", api.ApiProductsIdGet)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, cse.path, nil)
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
+
+func TestProducts_Get_WithVariants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	product := model.Product{
+		ID:          uuid.New(),
+		Title:       "t-shirt",
+		Price:       80,
+		Description: "Cotton t-shirt with the logo",
+		ImageURL:    "https://cdn.example.com/t-shirt.png",
+		Available:   true,
+	}
+	zero, premium := int64(0), int64(120)
+	variants := []model.ProductVariant{
+		{ID: uuid.New(), SKU: "t-shirt-m", Attributes: map[string]string{"size": "M"}},
+		{
+			ID:         uuid.New(),
+			SKU:        "t-shirt-xl",
+			Attributes: map[string]string{"size": "XL"},
+			Price:      &premium,
+			Stock:      &zero,
+		},
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindProductByID(gomock.Any(), product.ID).Return(product, nil)
+	repoMock.EXPECT().FindVariantsByProductID(gomock.Any(), product.ID).Return(variants, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/products/:id", api.ApiProductsIdGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/products/"+product.ID.String(), nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.Product
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, product.Description, resp.Description)
+	require.Equal(t, product.ImageURL, resp.ImageUrl)
+	require.Nil(t, resp.Stock)
+	require.Len(t, resp.Variants, 2)
+	require.Equal(t, int32(80), resp.Variants[0].Price)
+	require.True(t, resp.Variants[0].Available)
+	require.Equal(t, int32(120), resp.Variants[1].Price)
+	require.False(t, resp.Variants[1].Available)
+	require.Equal(t, map[string]string{"size": "XL"}, resp.Variants[1].Attributes)
+}
+
+func TestAdminProducts_Patch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	product := model.Product{ID: uuid.New(), Title: "t-shirt", Price: 60}
+	variant := model.ProductVariant{ID: uuid.New(), ProductID: product.ID, SKU: "t-shirt-m"}
+	price := int64(60)
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindVariantsByProductID(gomock.Any(), product.ID).
+		Return([]model.ProductVariant{variant}, nil)
+	repoMock.EXPECT().
+		UpdateProduct(gomock.Any(), product.ID, model.ProductUpdate{
+			Price:     &price,
+			Restock:   5,
+			VariantID: &variant.ID,
+		}).
+		Return(product, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.PATCH("/api/admin/products/:id", api.ApiAdminProductsIdPatch)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPatch,
+		"/api/admin/products/"+product.ID.String(),
+		bytes.NewBufferString(`{"price":60,"restock":5,"variant":"t-shirt-m"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+func (api *API) ApiAdminPromotionsPost(c *gin.Context) {
+	var request openapi.PromotionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	if request.Product == "" || request.Price < 0 || !request.StartsAt.Before(request.EndsAt) {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	product, err := api.repos.FindProductByTitle(ctx, request.Product)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "product not found"})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	promotion := model.Promotion{
+		ProductID: product.ID,
+		Price:     int64(request.Price),
+		StartsAt:  request.StartsAt,
+		EndsAt:    request.EndsAt,
+	}
+
+	if request.Variant != "" {
+		variants, err := api.repos.FindVariantsByProductID(ctx, product.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+			return
+		}
+
+		for _, v := range variants {
+			if strings.EqualFold(v.SKU, request.Variant) {
+				promotion.VariantID = &v.ID
+			}
+		}
+
+		if promotion.VariantID == nil {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "unknown variant"})
+
+			return
+		}
+	}
+
+	promotion, err = api.repos.CreatePromotion(ctx, promotion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, openapi.Promotion{
+		Id:       promotion.ID.String(),
+		Product:  product.Title,
+		Variant:  request.Variant,
+		Price:    int32(promotion.Price), //nolint:gosec
+		StartsAt: promotion.StartsAt,
+		EndsAt:   promotion.EndsAt,
+	})
+}
+
+func (api *API) ApiAdminPromoCodesPost(c *gin.Context) {
+	var request openapi.PromoCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	code, ok := makePromoCode(request)
+	if !ok {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	code, err := api.repos.CreatePromoCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, repo.ErrPromoCodeExists) {
+			c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: "promo code already exists"})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, openapi.PromoCode{
+		Code:         code.Code,
+		Kind:         string(code.Kind),
+		Value:        int32(code.Value), //nolint:gosec
+		MaxUses:      toInt32Ptr(code.MaxUses),
+		PerUserLimit: toInt32Ptr(code.PerUserLimit),
+		ExpiresAt:    code.ExpiresAt,
+		UsedCount:    int32(code.UsedCount), //nolint:gosec
+	})
+}
+
+func makePromoCode(request openapi.PromoCodeRequest) (model.PromoCode, bool) {
+	code := model.PromoCode{
+		Code:         strings.ToUpper(strings.TrimSpace(request.Code)),
+		Kind:         model.PromoCodeKind(request.Kind),
+		Value:        int64(request.Value),
+		MaxUses:      toInt64Ptr(request.MaxUses),
+		PerUserLimit: toInt64Ptr(request.PerUserLimit),
+		ExpiresAt:    request.ExpiresAt,
+	}
+
+	if code.Code == "" || code.Value <= 0 {
+		return code, false
+	}
+
+	switch code.Kind {
+	case model.PromoCodePercent:
+		if code.Value > 100 { //nolint:mnd
+			return code, false
+		}
+	case model.PromoCodeFixed:
+	default:
+		return code, false
+	}
+
+	for _, limit := range []*int64{code.MaxUses, code.PerUserLimit} {
+		if limit != nil && *limit <= 0 {
+			return code, false
+		}
+	}
+
+	return code, true
+}
+
+func toInt64Ptr(v *int32) *int64 {
+	if v == nil {
+		return nil
+	}
+
+	r := int64(*v)
+
+	return &r
+}
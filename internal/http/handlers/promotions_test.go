@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminPromotions_Variant_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2025, 11, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(7 * 24 * time.Hour)
+	product := model.Product{ID: uuid.New(), Title: "t-shirt", Price: 80}
+	variant := model.ProductVariant{ID: uuid.New(), ProductID: product.ID, SKU: "t-shirt-m"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindProductByTitle(gomock.Any(), "t-shirt").Return(product, nil)
+	repoMock.EXPECT().
+		FindVariantsByProductID(gomock.Any(), product.ID).
+		Return([]model.ProductVariant{variant}, nil)
+	repoMock.EXPECT().
+		CreatePromotion(gomock.Any(), model.Promotion{
+			ProductID: product.ID,
+			VariantID: &variant.ID,
+			Price:     40,
+			StartsAt:  start,
+			EndsAt:    end,
+		}).
+		DoAndReturn(func(_ any, p model.Promotion) (model.Promotion, error) {
+			p.ID = uuid.New()
+
+			return p, nil
+		})
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/admin/promotions", api.ApiAdminPromotionsPost)
+
+	body, _ := json.Marshal(openapi.PromotionRequest{
+		Product:  "t-shirt",
+		Variant:  "T-SHIRT-M",
+		Price:    40,
+		StartsAt: start,
+		EndsAt:   end,
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/promotions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestAdminPromotions_BadPayload_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.POST("/api/admin/promotions", api.ApiAdminPromotionsPost)
+
+	start := time.Date(2025, 11, 10, 0, 0, 0, 0, time.UTC)
+	cases := []openapi.PromotionRequest{
+		{Price: 10, StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Product: "socks", Price: -1, StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Product: "socks", Price: 5, StartsAt: start, EndsAt: start},
+	}
+	for i, cse := range cases {
+		body, _ := json.Marshal(cse)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/promotions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "case %d", i)
+	}
+}
+
+func TestAdminPromoCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	limit := int32(1)
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		CreatePromoCode(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ any, c model.PromoCode) (model.PromoCode, error) {
+			require.Equal(t, "WELCOME", c.Code)
+			require.Equal(t, int64(1), *c.PerUserLimit)
+
+			return c, nil
+		})
+	repoMock.EXPECT().
+		CreatePromoCode(gomock.Any(), gomock.Any()).
+		Return(model.PromoCode{}, repo.ErrPromoCodeExists)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/admin/promo-codes", api.ApiAdminPromoCodesPost)
+
+	cases := []struct {
+		request openapi.PromoCodeRequest
+		want    int
+	}{
+		{
+			openapi.PromoCodeRequest{Code: " welcome ", Kind: "percent", Value: 10, PerUserLimit: &limit},
+			http.StatusCreated,
+		},
+		{openapi.PromoCodeRequest{Code: "WELCOME", Kind: "fixed", Value: 5}, http.StatusConflict},
+		{openapi.PromoCodeRequest{Code: "X", Kind: "percent", Value: 150}, http.StatusBadRequest},
+		{openapi.PromoCodeRequest{Code: "X", Kind: "free", Value: 1}, http.StatusBadRequest},
+		{openapi.PromoCodeRequest{Code: "", Kind: "fixed", Value: 1}, http.StatusBadRequest},
+	}
+	for i, cse := range cases {
+		body, _ := json.Marshal(cse.request)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/promo-codes", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, cse.want, w.Code, "case %d", i)
+	}
+}
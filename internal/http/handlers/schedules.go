@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/cron"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	errScheduleWhen       = errors.New("set either runAt or recurrence")
+	errRunAtInPast        = errors.New("runAt must be in the future")
+	errRecurrenceNeverRun = errors.New("recurrence never matches")
+)
+
+func (api *API) ApiSchedulesPost(c *gin.Context) {
+	var request openapi.ScheduledTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	if strings.TrimSpace(request.ToUser) == "" || request.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	note, err := api.makeTransferNote(request.Memo, request.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	recurrence := strings.TrimSpace(request.Recurrence)
+
+	firstRun, err := firstScheduledRun(request.RunAt, recurrence, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	to, err := api.repos.FindUserByUsername(ctx, request.ToUser)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "receiver not found"})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	schedule, err := api.repos.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: user.ID,
+		ToUserID:   to.ID,
+		Amount:     int64(request.Amount),
+		Note:       note,
+		Recurrence: recurrence,
+		NextRunAt:  &firstRun,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrTransferToSelf) {
+			c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: repo.ErrTransferToSelf.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, makeScheduleResponse(schedule))
+}
+
+// firstScheduledRun is runAt for a one-off transfer or the first match of
+// recurrence after now; exactly one of them must be set.
+func firstScheduledRun(runAt *time.Time, recurrence string, now time.Time) (time.Time, error) {
+	switch {
+	case (runAt == nil) == (recurrence == ""):
+		return time.Time{}, errScheduleWhen
+	case runAt != nil:
+		if !runAt.After(now) {
+			return time.Time{}, errRunAtInPast
+		}
+
+		return runAt.UTC(), nil
+	}
+
+	schedule, err := cron.Parse(recurrence)
+	if err != nil {
+		return time.Time{}, err //nolint:wrapcheck
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return time.Time{}, errRecurrenceNeverRun
+	}
+
+	return next, nil
+}
+
+func (api *API) ApiSchedulesGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	schedules, err := api.repos.FindScheduledTransfers(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.ScheduledTransfer, 0, len(schedules))
+	for _, s := range schedules {
+		items = append(items, makeScheduleResponse(s))
+	}
+
+	c.JSON(http.StatusOK, openapi.ScheduledTransfersResponse{Schedules: items})
+}
+
+func (api *API) ApiSchedulesIdPausePost(c *gin.Context) {
+	api.setScheduleStatus(c, model.SchedulePaused)
+}
+
+func (api *API) ApiSchedulesIdResumePost(c *gin.Context) {
+	api.setScheduleStatus(c, model.ScheduleActive)
+}
+
+func (api *API) ApiSchedulesIdCancelPost(c *gin.Context) {
+	api.setScheduleStatus(c, model.ScheduleCancelled)
+}
+
+func (api *API) setScheduleStatus(c *gin.Context, status model.ScheduleStatus) {
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad schedule id"})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	schedule, err := api.repos.SetScheduledTransferStatus(ctx, user.ID, scheduleID, status)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "schedule not found"})
+		case errors.Is(err, repo.ErrScheduleTransition):
+			c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrScheduleTransition.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+		}
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeScheduleResponse(schedule))
+}
+
+func makeScheduleResponse(s model.ScheduledTransfer) openapi.ScheduledTransfer {
+	resp := openapi.ScheduledTransfer{
+		Id:         s.ID.String(),
+		ToUser:     s.ToUserName,
+		Amount:     int32(s.Amount), //nolint:gosec
+		Memo:       s.Note.Memo,
+		Category:   s.Note.Category,
+		Recurrence: s.Recurrence,
+		Status:     string(s.Status),
+		NextRunAt:  s.NextRunAt,
+		CreatedAt:  s.CreatedAt,
+	}
+
+	if s.LastRun != nil {
+		resp.LastRun = &openapi.ScheduledTransferRun{
+			ScheduledFor: s.LastRun.ScheduledFor,
+			Status:       string(s.LastRun.Status),
+			Error:        s.LastRun.Error,
+			RanAt:        s.LastRun.CreatedAt,
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedules_Create_Recurring_201(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "lead"}
+	to := model.User{ID: uuid.New(), Username: "alice"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "alice").Return(to, nil)
+	repoMock.EXPECT().
+		CreateScheduledTransfer(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ any, s model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+			require.Equal(t, me.ID, s.FromUserID)
+			require.Equal(t, to.ID, s.ToUserID)
+			require.Equal(t, int64(100), s.Amount)
+			require.Equal(t, model.TransferNote{Memo: "allowance", Category: "thanks"}, s.Note)
+			require.Equal(t, "0 9 1 * *", s.Recurrence)
+			require.NotNil(t, s.NextRunAt)
+			require.Equal(t, 1, s.NextRunAt.Day())
+			require.Equal(t, 9, s.NextRunAt.Hour())
+
+			s.ID = uuid.New()
+			s.ToUserName = to.Username
+			s.Status = model.ScheduleActive
+
+			return s, nil
+		})
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/schedules", withUser(me), api.ApiSchedulesPost)
+
+	body, _ := json.Marshal(openapi.ScheduledTransferRequest{
+		ToUser:     "alice",
+		Amount:     100,
+		Memo:       "allowance",
+		Category:   "thanks",
+		Recurrence: "0 9 1 * *",
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/schedules", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp openapi.ScheduledTransfer
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "alice", resp.ToUser)
+	require.Equal(t, "active", resp.Status)
+	require.Equal(t, "0 9 1 * *", resp.Recurrence)
+}
+
+func TestSchedules_Create_BadPayload_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.POST("/api/schedules", withUser(model.User{ID: uuid.New()}), api.ApiSchedulesPost)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	cases := []openapi.ScheduledTransferRequest{
+		{ToUser: "alice", Amount: 0, Recurrence: "@daily"},
+		{ToUser: "alice", Amount: 10},
+		{ToUser: "alice", Amount: 10, RunAt: &future, Recurrence: "@daily"},
+		{ToUser: "alice", Amount: 10, RunAt: &past},
+		{ToUser: "alice", Amount: 10, Recurrence: "every day"},
+		{ToUser: "alice", Amount: 10, Recurrence: "0 0 30 2 *"},
+		{ToUser: "alice", Amount: 10, Recurrence: "@daily", Category: "bribe"},
+	}
+	for _, tc := range cases {
+		body, _ := json.Marshal(tc)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/schedules", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		require.Equalf(t, http.StatusBadRequest, w.Code, "%+v", tc)
+	}
+}
+
+func TestSchedules_List_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "lead"}
+	at := time.Date(2025, 11, 1, 9, 0, 0, 0, time.UTC)
+	next := at.AddDate(0, 1, 0)
+	schedule := model.ScheduledTransfer{
+		ID:         uuid.New(),
+		ToUserName: "alice",
+		Amount:     100,
+		Recurrence: "0 9 1 * *",
+		Status:     model.ScheduleActive,
+		NextRunAt:  &next,
+		LastRun: &model.ScheduledRun{
+			ScheduledFor: at,
+			Status:       model.ScheduledRunSkipped,
+			Error:        "insufficient funds",
+			CreatedAt:    at,
+		},
+		CreatedAt: at.AddDate(0, -1, 0),
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindScheduledTransfers(gomock.Any(), me.ID).
+		Return([]model.ScheduledTransfer{schedule}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/schedules", withUser(me), api.ApiSchedulesGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.ScheduledTransfersResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Schedules, 1)
+	require.Equal(t, schedule.ID.String(), resp.Schedules[0].Id)
+	require.NotNil(t, resp.Schedules[0].LastRun)
+	require.Equal(t, "skipped", resp.Schedules[0].LastRun.Status)
+	require.Equal(t, "insufficient funds", resp.Schedules[0].LastRun.Error)
+}
+
+func TestSchedules_SetStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "lead"}
+	paused, missing, finished := uuid.New(), uuid.New(), uuid.New()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		SetScheduledTransferStatus(gomock.Any(), me.ID, paused, model.SchedulePaused).
+		Return(model.ScheduledTransfer{ID: paused, Status: model.SchedulePaused}, nil)
+	repoMock.EXPECT().
+		SetScheduledTransferStatus(gomock.Any(), me.ID, missing, model.ScheduleActive).
+		Return(model.ScheduledTransfer{}, repo.ErrNotFound)
+	repoMock.EXPECT().
+		SetScheduledTransferStatus(gomock.Any(), me.ID, finished, model.ScheduleCancelled).
+		Return(model.ScheduledTransfer{}, fmt.Errorf("set schedule status: %w", repo.ErrScheduleTransition))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/schedules/:id/pause", withUser(me), api.ApiSchedulesIdPausePost)
+	r.POST("/api/schedules/:id/resume", withUser(me), api.ApiSchedulesIdResumePost)
+	r.POST("/api/schedules/:id/cancel", withUser(me), api.ApiSchedulesIdCancelPost)
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/api/schedules/" + paused.String() + "/pause", http.StatusOK},
+		{"/api/schedules/" + missing.String() + "/resume", http.StatusNotFound},
+		{"/api/schedules/" + finished.String() + "/cancel", http.StatusConflict},
+		{"/api/schedules/nope/cancel", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, tc.want, w.Code, tc.path)
+	}
+}
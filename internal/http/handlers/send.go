@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/6ermvH/MerchShop/gen/openapi"
 	"github.com/6ermvH/MerchShop/internal/http/middleware"
@@ -14,6 +16,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// memoMaxLen matches the VARCHAR size of merch_shop.transfers.memo.
+	memoMaxLen                = 200
+	defaultPendingTransferTTL = 72 * time.Hour
+)
+
+// WithPendingTransferTTL sets how long the recipient has to accept a transfer
+// sent with requireAcceptance before the coins go back to the sender.
+func WithPendingTransferTTL(d time.Duration) Option {
+	return func(api *API) {
+		api.pendingTTL = d
+	}
+}
+
+var (
+	errMemoTooLong     = errors.New("memo too long")
+	errUnknownCategory = errors.New("unknown category")
+)
+
 func (api *API) ApiSendCoinPost(c *gin.Context) {
 	var request openapi.SendCoinRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -28,6 +49,19 @@ func (api *API) ApiSendCoinPost(c *gin.Context) {
 		return
 	}
 
+	api.sendCoins(c, request, http.StatusOK)
+}
+
+// sendCoins makes the transfer and answers with sentStatus, or with 202 and
+// the transfer when it waits for the recipient to accept it.
+func (api *API) sendCoins(c *gin.Context, request openapi.SendCoinRequest, sentStatus int) {
+	note, err := api.makeTransferNote(request.Memo, request.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
 	userRaw, ok := c.Get(middleware.CtxUserKey)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
@@ -53,19 +87,92 @@ func (api *API) ApiSendCoinPost(c *gin.Context) {
 		return
 	}
 
-	if err := api.repos.SendCoins(ctx, user.ID, to.ID, int64(request.Amount)); err != nil {
-		switch {
-		case strings.Contains(err.Error(), "insufficient funds"):
-			c.JSON(
-				http.StatusUnprocessableEntity,
-				openapi.ErrorResponse{Errors: "insufficient funds"},
-			)
-		default:
-			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: err.Error()})
+	if request.RequireAcceptance {
+		transfer, err := api.repos.SendPendingCoins(
+			ctx, user.ID, to.ID, int64(request.Amount), note, api.pendingTTL,
+		)
+		if err != nil {
+			writeSendError(c, err)
+
+			return
 		}
 
+		api.changed(user.ID)
+		c.JSON(http.StatusAccepted, makeTransferHistoryItem(transfer))
+
+		return
+	}
+
+	if err := api.repos.SendCoins(ctx, user.ID, to.ID, int64(request.Amount), note); err != nil {
+		writeSendError(c, err)
+
 		return
 	}
 
-	c.Status(http.StatusOK)
+	api.changed(user.ID, to.ID)
+	c.Status(sentStatus)
+}
+
+func writeSendError(c *gin.Context, err error) {
+	var policyErr *repo.TransferPolicyError
+
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(
+			http.StatusForbidden,
+			openapi.ErrorResponse{Errors: policyErr.Message, Code: policyErr.Code},
+		)
+	case strings.Contains(err.Error(), "insufficient funds"):
+		c.JSON(
+			http.StatusUnprocessableEntity,
+			openapi.ErrorResponse{Errors: "insufficient funds"},
+		)
+	default:
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: err.Error()})
+	}
+}
+
+func (api *API) makeTransferNote(memo, category string) (model.TransferNote, error) {
+	memo = sanitizeMemo(memo)
+	if utf8.RuneCountInString(memo) > memoMaxLen {
+		return model.TransferNote{}, errMemoTooLong
+	}
+
+	category, err := api.normalizeCategory(category)
+	if err != nil {
+		return model.TransferNote{}, err
+	}
+
+	return model.TransferNote{Memo: memo, Category: category}, nil
+}
+
+func (api *API) normalizeCategory(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return "", nil
+	}
+
+	if _, ok := api.categories[category]; !ok {
+		return "", errUnknownCategory
+	}
+
+	return category, nil
+}
+
+// sanitizeMemo drops invalid UTF-8 and control characters and collapses
+// whitespace, so memos render as a single clean line.
+func sanitizeMemo(memo string) string {
+	memo = strings.ToValidUTF8(memo, "")
+	memo = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		default:
+			return r
+		}
+	}, memo)
+
+	return strings.Join(strings.Fields(memo), " ")
 }
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -153,7 +155,7 @@ func TestSendCoin_InsufficientFunds_422(t *testing.T) {
 		Return(to, nil)
 
 	repoMock.EXPECT().
-		SendCoins(gomock.Any(), me.ID, to.ID, int64(100)).
+		SendCoins(gomock.Any(), me.ID, to.ID, int64(100), model.TransferNote{}).
 		Return(errors.New("insufficient funds: balance=50, need=100"))
 
 	api := NewAPI(repoMock, nil)
@@ -169,6 +171,96 @@ func TestSendCoin_InsufficientFunds_422(t *testing.T) {
 	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
 }
 
+func TestSendCoin_PolicyViolation_403(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "me"}
+	to := model.User{ID: uuid.New(), Username: "alice"}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+
+	repoMock.EXPECT().
+		FindUserByUsername(gomock.Any(), "alice").
+		Return(to, nil)
+
+	repoMock.EXPECT().
+		SendCoins(gomock.Any(), me.ID, to.ID, int64(100), model.TransferNote{}).
+		Return(fmt.Errorf("send coins: %w", &repo.TransferPolicyError{
+			Code:    repo.TransferCodeDailyCap,
+			Message: "at most 50 coins per 24h0m0s, 0 left",
+		}))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/sendCoin", withUser(me), api.ApiSendCoinPost)
+
+	body, _ := json.Marshal(openapi.SendCoinRequest{ToUser: "alice", Amount: 100})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	var resp openapi.ErrorResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "daily_send_cap", resp.Code)
+}
+
+func TestSendCoin_RequireAcceptance_202(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "me"}
+	to := model.User{ID: uuid.New(), Username: "alice"}
+	expires := time.Date(2025, 11, 13, 12, 0, 0, 0, time.UTC)
+	transfer := model.Transfer{
+		ID:           uuid.New(),
+		FromUserName: "me",
+		ToUserName:   "alice",
+		Amount:       40,
+		Status:       model.TransferPending,
+		ExpiresAt:    &expires,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindUserByUsername(gomock.Any(), "alice").
+		Return(to, nil)
+	repoMock.EXPECT().
+		SendPendingCoins(gomock.Any(), me.ID, to.ID, int64(40), model.TransferNote{}, 24*time.Hour).
+		Return(transfer, nil)
+
+	api := NewAPI(repoMock, nil, WithPendingTransferTTL(24*time.Hour))
+	r := gin.New()
+	r.POST("/api/sendCoin", withUser(me), api.ApiSendCoinPost)
+
+	body, _ := json.Marshal(openapi.SendCoinRequest{
+		ToUser:            "alice",
+		Amount:            40,
+		RequireAcceptance: true,
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	var resp openapi.TransferHistoryItem
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, transfer.ID.String(), resp.Id)
+	require.Equal(t, "pending", resp.Status)
+	require.NotNil(t, resp.ExpiresAt)
+	require.True(t, expires.Equal(*resp.ExpiresAt))
+}
+
 func TestSendCoin_OtherSendError_500(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -184,7 +276,7 @@ func TestSendCoin_OtherSendError_500(t *testing.T) {
 		Return(to, nil)
 
 	repoMock.EXPECT().
-		SendCoins(gomock.Any(), me.ID, to.ID, int64(5)).
+		SendCoins(gomock.Any(), me.ID, to.ID, int64(5), model.TransferNote{}).
 		Return(errors.New("deadlock detected"))
 
 	api := NewAPI(repoMock, nil)
@@ -215,7 +307,7 @@ func TestSendCoin_OK(t *testing.T) {
 		Return(to, nil)
 
 	repoMock.EXPECT().
-		SendCoins(gomock.Any(), me.ID, to.ID, int64(10)).
+		SendCoins(gomock.Any(), me.ID, to.ID, int64(10), model.TransferNote{}).
 		Return(nil)
 
 	api := NewAPI(repoMock, nil)
@@ -230,3 +322,77 @@ func TestSendCoin_OK(t *testing.T) {
 
 	require.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestSendCoin_MemoAndCategory_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	me := model.User{ID: uuid.New(), Username: "me"}
+	to := model.User{ID: uuid.New(), Username: "alice"}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+
+	repoMock.EXPECT().
+		FindUserByUsername(gomock.Any(), "alice").
+		Return(to, nil)
+
+	repoMock.EXPECT().
+		SendCoins(gomock.Any(), me.ID, to.ID, int64(10), model.TransferNote{
+			Memo:     "thanks for the review",
+			Category: "thanks",
+		}).
+		Return(nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/sendCoin", withUser(me), api.ApiSendCoinPost)
+
+	body, _ := json.Marshal(openapi.SendCoinRequest{
+		ToUser:   "alice",
+		Amount:   10,
+		Memo:     "  thanks\tfor the\u200b\x07 review\n",
+		Category: " Thanks ",
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSendCoin_BadMemoOrCategory_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil, WithTransferCategories("kudos"))
+	r := gin.New()
+	r.POST(
+		"/api/sendCoin",
+		withUser(model.User{ID: uuid.New(), Username: "me"}),
+		api.ApiSendCoinPost,
+	)
+
+	cases := []openapi.SendCoinRequest{
+		{ToUser: "alice", Amount: 10, Memo: strings.Repeat("я", 201)},
+		{ToUser: "alice", Amount: 10, Category: "thanks"},
+		{ToUser: "alice", Amount: 10, Category: "bribe"},
+	}
+	for i, cse := range cases {
+		body, _ := json.Marshal(cse)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "case %d", i)
+	}
+}
+
+func TestSanitizeMemo(t *testing.T) {
+	require.Equal(t, "", sanitizeMemo("  \n\t "))
+	require.Equal(t, "a b c", sanitizeMemo("a\r\nb\x00  c"))
+	require.Equal(t, "ok", sanitizeMemo("o\u202ek\xff"))
+}
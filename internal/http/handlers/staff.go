@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (api *API) ApiStaffOrdersGet(c *gin.Context) {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	orders, err := api.repos.FindOrders(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.Order, 0, len(orders))
+	for _, o := range orders {
+		items = append(items, makeOrderResponse(o))
+	}
+
+	c.JSON(http.StatusOK, openapi.OrdersResponse{Orders: items})
+}
+
+func (api *API) ApiStaffOrdersIdStatusPost(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad order id"})
+
+		return
+	}
+
+	var request openapi.OrderStatusUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	next := model.OrderStatus(request.Status)
+	if !next.Valid() {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad status"})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	order, err := api.repos.AdvanceOrder(ctx, orderID, next)
+	if err != nil {
+		if errors.Is(err, repo.ErrBadOrderTransition) {
+			c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrBadOrderTransition.Error()})
+
+			return
+		}
+
+		writeOrderError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeOrderResponse(order))
+}
+
+var (
+	errBadStatus = errors.New("bad status")
+	errBadTime   = errors.New("bad from or to, want RFC 3339")
+)
+
+func parseOrderFilter(c *gin.Context) (model.OrderFilter, error) {
+	var (
+		filter model.OrderFilter
+		err    error
+	)
+
+	filter.Status = model.OrderStatus(c.Query("status"))
+	if filter.Status != "" && !filter.Status.Valid() {
+		return filter, errBadStatus
+	}
+
+	filter.Product = c.Query("product")
+
+	if raw := c.Query("from"); raw != "" {
+		if filter.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return filter, errBadTime
+		}
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		if filter.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return filter, errBadTime
+		}
+	}
+
+	filter.Limit, filter.Offset, err = parsePage(c)
+
+	return filter, err
+}
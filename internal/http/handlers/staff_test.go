@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/jwtutil"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaffOrders_BadFilter_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/staff/orders", api.ApiStaffOrdersGet)
+
+	queries := []string{
+		"?status=lost",
+		"?from=yesterday",
+		"?to=2025-11-10",
+		"?limit=-1",
+	}
+	for _, q := range queries {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/staff/orders"+q, nil)
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "query %s", q)
+	}
+}
+
+func TestStaffOrders_Filter_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	from := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 11, 8, 0, 0, 0, 0, time.UTC)
+	packedAt := from.Add(time.Hour)
+	order := model.Order{
+		ID:           uuid.New(),
+		UserName:     "alice",
+		ProductTitle: "hoody",
+		ProductPrice: 300,
+		Status:       model.OrderStatusPacked,
+		Timeline:     model.OrderTimeline{PackedAt: &packedAt},
+		CreatedAt:    from,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindOrders(gomock.Any(), model.OrderFilter{
+			Status:  model.OrderStatusPacked,
+			Product: "hoody",
+			From:    from,
+			To:      to,
+			Limit:   defaultPageLimit,
+		}).
+		Return([]model.Order{order}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/staff/orders", api.ApiStaffOrdersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/staff/orders?status=packed&product=hoody&from=2025-11-01T00:00:00Z&to=2025-11-08T00:00:00Z",
+		nil,
+	)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.OrdersResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Orders, 1)
+	require.Equal(t, "alice", resp.Orders[0].User)
+	require.Equal(t, "packed", resp.Orders[0].Status)
+	require.NotNil(t, resp.Orders[0].PackedAt)
+	require.True(t, packedAt.Equal(*resp.Orders[0].PackedAt))
+	require.Nil(t, resp.Orders[0].DeliveredAt)
+}
+
+func TestStaffOrders_FindError_500(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindOrders(gomock.Any(), gomock.Any()).Return(nil, errors.New("db"))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/staff/orders", api.ApiStaffOrdersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/staff/orders", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestStaffOrders_Advance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	orderID := uuid.New()
+
+	cases := []struct {
+		name   string
+		body   string
+		repo   bool
+		result error
+		want   int
+	}{
+		{name: "bad json", body: `{bad`, want: http.StatusBadRequest},
+		{name: "unknown status", body: `{"status":"lost"}`, want: http.StatusBadRequest},
+		{
+			name:   "skip a step",
+			body:   `{"status":"delivered"}`,
+			repo:   true,
+			result: repo.ErrBadOrderTransition,
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "missing order",
+			body:   `{"status":"delivered"}`,
+			repo:   true,
+			result: repo.ErrNotFound,
+			want:   http.StatusNotFound,
+		},
+		{name: "ok", body: `{"status":"delivered"}`, repo: true, want: http.StatusOK},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			if cse.repo {
+				repoMock.EXPECT().
+					AdvanceOrder(gomock.Any(), orderID, model.OrderStatusDelivered).
+					Return(model.Order{ID: orderID, Status: model.OrderStatusDelivered}, cse.result)
+			}
+
+			api := NewAPI(repoMock, nil)
+			r := gin.New()
+			r.POST("/api/staff/orders/:id/status", api.ApiStaffOrdersIdStatusPost)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/api/staff/orders/"+orderID.String()+"/status",
+				bytes.NewBufferString(cse.body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
+
+func TestStaffOrders_RequiresStaff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	j := jwtutil.NewHS256("is-my-private-secret-key-hello-world", "merch", "merch")
+
+	cases := []struct {
+		role model.Role
+		want int
+	}{
+		{role: model.RoleUser, want: http.StatusForbidden},
+		{role: model.RoleStaff, want: http.StatusOK},
+		{role: model.RoleAdmin, want: http.StatusOK},
+	}
+
+	for _, cse := range cases {
+		t.Run(string(cse.role), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := model.User{ID: uuid.New(), Username: "desk", Role: cse.role}
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			repoMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+
+			if cse.want == http.StatusOK {
+				repoMock.EXPECT().FindOrders(gomock.Any(), gomock.Any()).Return(nil, nil)
+			}
+
+			r := gin.New()
+			NewAPI(repoMock, j).RegisterRoutes(r)
+
+			token, _ := j.Sign(user.ID, user.Username)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/staff/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultStreamHeartbeat = 15 * time.Second
+	// streamReplayPage bounds each query while catching up after Last-Event-ID.
+	streamReplayPage = 200
+	// streamReplaySlack is how far below the newest id a client has the
+	// replay starts. Ids are taken before commit, so an event can turn up
+	// after one with a higher id was sent; the ids sent within the window
+	// travel in the cursor so that the replay skips them.
+	streamReplaySlack = 256
+	// streamRetry tells EventSource clients how soon to reconnect.
+	streamRetry = 3 * time.Second
+)
+
+var errBadLastEventID = errors.New("bad Last-Event-ID")
+
+// EventSubscriber delivers a user's live events; see events.Broker.
+type EventSubscriber interface {
+	Subscribe(userId uuid.UUID) (<-chan model.Event, func())
+}
+
+// WithEventStream enables GET /api/stream backed by sub.
+func WithEventStream(sub EventSubscriber) Option {
+	return func(api *API) {
+		api.events = sub
+	}
+}
+
+// WithStreamsDone ends open event streams once done is closed, so that a
+// graceful shutdown does not wait for clients that never hang up.
+func WithStreamsDone(done <-chan struct{}) Option {
+	return func(api *API) {
+		api.streamsDone = done
+	}
+}
+
+func (api *API) ApiStreamGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	if api.events == nil {
+		c.JSON(http.StatusServiceUnavailable, openapi.ErrorResponse{Errors: "event stream disabled"})
+
+		return
+	}
+
+	cursor, resume, err := parseLastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost;
+	// live events already sent are skipped below.
+	live, unsubscribe := api.events.Subscribe(user.ID)
+	defer unsubscribe()
+
+	var backlog []model.Event
+	if resume {
+		if backlog, err = api.replayEvents(c.Request.Context(), user.ID, cursor.from()); err != nil {
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	if !resume {
+		// A fresh client has nothing to resume from, so start it off with
+		// the balance it would otherwise have to poll /api/info for.
+		writeStreamEvent(w, "", model.Event{
+			Type: model.EventBalance,
+			Data: map[string]any{"balance": user.Balance},
+		})
+	}
+
+	for _, e := range backlog {
+		if cursor.add(e.ID) {
+			writeStreamEvent(w, cursor.String(), e)
+		}
+	}
+
+	w.Flush()
+
+	heartbeat := time.NewTicker(api.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-api.streamsDone:
+			return
+		case e, ok := <-live:
+			if !ok {
+				return
+			}
+
+			if !cursor.add(e.ID) {
+				continue
+			}
+
+			if !writeStreamEvent(w, cursor.String(), e) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+
+		w.Flush()
+	}
+}
+
+// streamCursor is what a client has been sent: the newest event id and the
+// others within streamReplaySlack below it. It goes out as the SSE id in the
+// form "newest,d1,d2", each d being how far below newest an id is, and comes
+// back as Last-Event-ID; a bare event id is a cursor too.
+type streamCursor struct {
+	newest int64
+	sent   map[int64]struct{}
+}
+
+// from is the id the replay starts after.
+func (s *streamCursor) from() int64 {
+	return max(0, s.newest-streamReplaySlack)
+}
+
+// add records id as sent and reports whether it was not sent before.
+func (s *streamCursor) add(id int64) bool {
+	if _, ok := s.sent[id]; ok {
+		return false
+	}
+
+	if s.sent == nil {
+		s.sent = make(map[int64]struct{})
+	}
+
+	s.sent[id] = struct{}{}
+
+	if id > s.newest {
+		s.newest = id
+
+		for old := range s.sent {
+			if old <= s.from() {
+				delete(s.sent, old)
+			}
+		}
+	}
+
+	return true
+}
+
+func (s *streamCursor) String() string {
+	deltas := make([]int64, 0, len(s.sent))
+
+	for id := range s.sent {
+		if id < s.newest && id > s.from() {
+			deltas = append(deltas, s.newest-id)
+		}
+	}
+
+	slices.Sort(deltas)
+
+	var b strings.Builder
+
+	b.WriteString(strconv.FormatInt(s.newest, 10))
+
+	for _, d := range deltas {
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatInt(d, 10))
+	}
+
+	return b.String()
+}
+
+// parseLastEventID reads the cursor EventSource sends on reconnect, or the
+// lastEventId query parameter for clients that cannot set headers.
+func parseLastEventID(c *gin.Context) (streamCursor, bool, error) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("lastEventId")
+	}
+
+	if raw == "" {
+		return streamCursor{}, false, nil
+	}
+
+	parts := strings.Split(raw, ",")
+
+	newest, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || newest < 0 {
+		return streamCursor{}, false, errBadLastEventID
+	}
+
+	cursor := streamCursor{newest: newest, sent: map[int64]struct{}{newest: {}}}
+
+	for _, part := range parts[1:] {
+		d, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || d <= 0 || d > newest {
+			return streamCursor{}, false, errBadLastEventID
+		}
+
+		if d < streamReplaySlack {
+			cursor.sent[newest-d] = struct{}{}
+		}
+	}
+
+	return cursor, true, nil
+}
+
+func (api *API) replayEvents(
+	ctx context.Context,
+	userId uuid.UUID,
+	afterId int64,
+) ([]model.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	var backlog []model.Event
+
+	for {
+		page, err := api.repos.FindEventsSince(ctx, userId, afterId, streamReplayPage)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		backlog = append(backlog, page...)
+
+		if len(page) < streamReplayPage {
+			return backlog, nil
+		}
+
+		afterId = page[len(page)-1].ID
+	}
+}
+
+// writeStreamEvent writes e in text/event-stream format under the cursor
+// id; snapshots that cannot be resumed from go without one.
+func writeStreamEvent(w io.Writer, id string, e model.Event) bool {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return false
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return false
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+
+	return err == nil
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSubscriber struct {
+	events []model.Event
+	userID uuid.UUID
+}
+
+// Subscribe hands out the canned events and then closes the stream, which
+// makes the handler return.
+func (s *fakeSubscriber) Subscribe(userId uuid.UUID) (<-chan model.Event, func()) {
+	s.userID = userId
+
+	ch := make(chan model.Event, len(s.events))
+	for _, e := range s.events {
+		ch <- e
+	}
+
+	close(ch)
+
+	return ch, func() {}
+}
+
+func TestStream_ResumeSkipsDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 90}
+	replayed := []model.Event{
+		{ID: 6, UserID: user.ID, Type: model.EventBalance, Data: map[string]any{"balance": 100}},
+		{ID: 8, UserID: user.ID, Type: model.EventOrder, Data: map[string]any{"status": "packed"}},
+	}
+	// 7 was taken before 8 but committed after the replay read.
+	sub := &fakeSubscriber{events: []model.Event{
+		replayed[1],
+		{ID: 7, UserID: user.ID, Type: model.EventTransfer, Data: map[string]any{"amount": 5}},
+		{ID: 9, UserID: user.ID, Type: model.EventBalance, Data: map[string]any{"balance": 90}},
+	}}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindEventsSince(gomock.Any(), user.ID, int64(0), streamReplayPage).
+		Return(replayed, nil)
+
+	api := NewAPI(repoMock, nil, WithEventStream(sub))
+	r := gin.New()
+	r.GET("/api/stream", withUser(user), api.ApiStreamGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	req.Header.Set("Last-Event-ID", "5")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	require.Equal(t, user.ID, sub.userID)
+	require.Equal(t, "retry: 3000\n\n"+
+		"id: 6,1\nevent: balance\ndata: {\"balance\":100}\n\n"+
+		"id: 8,2,3\nevent: order\ndata: {\"status\":\"packed\"}\n\n"+
+		"id: 8,1,2,3\nevent: transfer\ndata: {\"amount\":5}\n\n"+
+		"id: 9,1,2,3,4\nevent: balance\ndata: {\"balance\":90}\n\n",
+		w.Body.String())
+}
+
+func TestStream_ResumeReplaysLateCommits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	// The client got 298 and 300; 299 committed after it hung up.
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindEventsSince(gomock.Any(), user.ID, int64(300-streamReplaySlack), streamReplayPage).
+		Return([]model.Event{
+			{ID: 298, UserID: user.ID, Type: model.EventBalance, Data: map[string]any{"balance": 10}},
+			{ID: 299, UserID: user.ID, Type: model.EventTransfer, Data: map[string]any{"amount": 5}},
+			{ID: 300, UserID: user.ID, Type: model.EventBalance, Data: map[string]any{"balance": 15}},
+		}, nil)
+
+	api := NewAPI(repoMock, nil, WithEventStream(&fakeSubscriber{}))
+	r := gin.New()
+	r.GET("/api/stream", withUser(user), api.ApiStreamGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	req.Header.Set("Last-Event-ID", "300,2")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "retry: 3000\n\n"+
+		"id: 300,1,2\nevent: transfer\ndata: {\"amount\":5}\n\n",
+		w.Body.String())
+}
+
+func TestStream_FreshClientGetsBalance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 42}
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil, WithEventStream(&fakeSubscriber{}))
+	r := gin.New()
+	r.GET("/api/stream", withUser(user), api.ApiStreamGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "retry: 3000\n\nevent: balance\ndata: {\"balance\":42}\n\n", w.Body.String())
+}
+
+func TestStream_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+
+	disabled := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	enabled := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil, WithEventStream(&fakeSubscriber{}))
+	r := gin.New()
+	r.GET("/disabled", withUser(user), disabled.ApiStreamGet)
+	r.GET("/enabled", withUser(user), enabled.ApiStreamGet)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/disabled", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	for _, cursor := range []string{"abc", "-1", "5,", "5,0", "5,6"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/enabled?lastEventId="+cursor, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, cursor)
+	}
+}
+
+// openSubscriber hands out a stream that stays open.
+type openSubscriber struct{}
+
+func (openSubscriber) Subscribe(uuid.UUID) (<-chan model.Event, func()) {
+	return make(chan model.Event), func() {}
+}
+
+func TestStream_EndsWhenStreamsDone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 42}
+	done := make(chan struct{})
+	close(done)
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil,
+		WithEventStream(openSubscriber{}), WithStreamsDone(done))
+	r := gin.New()
+	r.GET("/api/stream", withUser(user), api.ApiStreamGet)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/stream", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "retry: 3000\n\nevent: balance\ndata: {\"balance\":42}\n\n", w.Body.String())
+}
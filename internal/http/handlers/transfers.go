@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (api *API) ApiTransfersGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	direction := model.TransferDirection(c.Query("direction"))
+	switch direction {
+	case model.TransferDirectionAny, model.TransferDirectionSent, model.TransferDirectionReceived:
+	default:
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad direction"})
+
+		return
+	}
+
+	category, err := api.normalizeCategory(c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: err.Error()})
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	transfers, err := api.repos.FindTransfersByUserID(api.ownReads(ctx, user.ID), user.ID, model.TransferFilter{
+		Direction: direction,
+		Category:  category,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.TransferHistoryItem, 0, len(transfers))
+	for _, t := range transfers {
+		items = append(items, makeTransferHistoryItem(t))
+	}
+
+	c.JSON(http.StatusOK, openapi.TransferHistoryResponse{Transfers: items})
+}
+
+func makeTransferHistoryItem(t model.Transfer) openapi.TransferHistoryItem {
+	return openapi.TransferHistoryItem{
+		Id:         t.ID.String(),
+		FromUser:   t.FromUserName,
+		ToUser:     t.ToUserName,
+		Amount:     int32(t.Amount), //nolint:gosec
+		Memo:       t.Memo,
+		Category:   t.Category,
+		Status:     string(t.Status),
+		ExpiresAt:  t.ExpiresAt,
+		ResolvedAt: t.ResolvedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func (api *API) ApiTransfersIdAcceptPost(c *gin.Context) {
+	api.resolveTransfer(c, api.repos.AcceptTransfer)
+}
+
+func (api *API) ApiTransfersIdDeclinePost(c *gin.Context) {
+	api.resolveTransfer(c, api.repos.DeclineTransfer)
+}
+
+// resolveTransfer answers a pending transfer sent to the user with resolve.
+func (api *API) resolveTransfer(
+	c *gin.Context,
+	resolve func(ctx context.Context, userId, transferId uuid.UUID) (model.Transfer, error),
+) {
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad transfer id"})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	transfer, err := resolve(ctx, user.ID, transferID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "transfer not found"})
+		case errors.Is(err, repo.ErrTransferNotPending):
+			c.JSON(http.StatusConflict, openapi.ErrorResponse{Errors: repo.ErrTransferNotPending.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+		}
+
+		return
+	}
+
+	api.changed(transfer.FromUserID, transfer.ToUserID)
+	c.JSON(http.StatusOK, makeTransferHistoryItem(transfer))
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfers_NoUserInContext_401(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/transfers", api.ApiTransfersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/transfers", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTransfers_BadQuery_400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api := NewAPI(mock_repo.NewMockMerchRepo(ctrl), nil)
+	r := gin.New()
+	r.GET("/api/transfers", withUser(model.User{ID: uuid.New()}), api.ApiTransfersGet)
+
+	queries := []string{
+		"?direction=up",
+		"?category=bribe",
+		"?limit=0",
+		"?limit=abc",
+		"?offset=-1",
+	}
+	for _, q := range queries {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/transfers"+q, nil)
+		r.ServeHTTP(w, req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "query %s", q)
+	}
+}
+
+func TestTransfers_DBError_500(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindTransfersByUserID(gomock.Any(), user.ID, gomock.Any()).
+		Return(nil, errors.New("db"))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/transfers", withUser(user), api.ApiTransfersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/transfers", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTransfers_FilterByCategory_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	at := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+	transfer := model.Transfer{
+		ID:           uuid.New(),
+		FromUserName: "alice",
+		ToUserName:   "u",
+		Amount:       15,
+		Memo:         "happy birthday",
+		Category:     "birthday",
+		CreatedAt:    at,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindTransfersByUserID(gomock.Any(), user.ID, model.TransferFilter{
+			Direction: model.TransferDirectionReceived,
+			Category:  "birthday",
+			Limit:     maxPageLimit,
+			Offset:    10,
+		}).
+		Return([]model.Transfer{transfer}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/transfers", withUser(user), api.ApiTransfersGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/transfers?direction=received&category=Birthday&limit=500&offset=10",
+		nil,
+	)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.TransferHistoryResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, []openapi.TransferHistoryItem{{
+		Id:        transfer.ID.String(),
+		FromUser:  "alice",
+		ToUser:    "u",
+		Amount:    15,
+		Memo:      "happy birthday",
+		Category:  "birthday",
+		CreatedAt: at,
+	}}, resp.Transfers)
+}
+
+func TestTransfers_Accept_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	at := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+	resolved := at.Add(time.Hour)
+	transfer := model.Transfer{
+		ID:           uuid.New(),
+		FromUserName: "alice",
+		ToUserName:   "u",
+		Amount:       15,
+		Status:       model.TransferAccepted,
+		ResolvedAt:   &resolved,
+		CreatedAt:    at,
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().AcceptTransfer(gomock.Any(), user.ID, transfer.ID).Return(transfer, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/transfers/:id/accept", withUser(user), api.ApiTransfersIdAcceptPost)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/transfers/"+transfer.ID.String()+"/accept",
+		nil,
+	)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.TransferHistoryItem
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "accepted", resp.Status)
+	require.NotNil(t, resp.ResolvedAt)
+	require.True(t, resolved.Equal(*resp.ResolvedAt))
+}
+
+func TestTransfers_Decline_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	missing, resolved, broken := uuid.New(), uuid.New(), uuid.New()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		DeclineTransfer(gomock.Any(), user.ID, missing).
+		Return(model.Transfer{}, repo.ErrNotFound)
+	repoMock.EXPECT().
+		DeclineTransfer(gomock.Any(), user.ID, resolved).
+		Return(model.Transfer{}, fmt.Errorf("lock transfer: %w", repo.ErrTransferNotPending))
+	repoMock.EXPECT().
+		DeclineTransfer(gomock.Any(), user.ID, broken).
+		Return(model.Transfer{}, errors.New("db"))
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/transfers/:id/decline", withUser(user), api.ApiTransfersIdDeclinePost)
+
+	cases := map[string]int{
+		"not-a-uuid":      http.StatusBadRequest,
+		missing.String():  http.StatusNotFound,
+		resolved.String(): http.StatusConflict,
+		broken.String():   http.StatusInternalServerError,
+	}
+	for id, want := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/transfers/"+id+"/decline", nil)
+		r.ServeHTTP(w, req)
+		require.Equalf(t, want, w.Code, "id %s", id)
+	}
+}
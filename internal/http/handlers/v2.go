@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/apispec"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// WithSpec checks requests to /api/v2 against the OpenAPI document; v1 is
+// served as it always was.
+func WithSpec(spec *apispec.Spec) Option {
+	return func(api *API) {
+		api.spec = spec
+	}
+}
+
+// ApiV2PurchasesPost is the v2 of GET /api/buy/{item}: a POST that answers
+// with the order placed.
+func (api *API) ApiV2PurchasesPost(c *gin.Context) {
+	var request openapi.PurchaseRequest
+	if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Product) == "" {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	order, err := api.repos.BuyProduct(ctx, user.ID, model.Purchase{
+		Product:   request.Product,
+		Variant:   request.Variant,
+		PromoCode: request.PromoCode,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "product not found"})
+		case errors.Is(err, repo.ErrInsufficient):
+			c.JSON(http.StatusUnprocessableEntity, openapi.ErrorResponse{Errors: "insufficient funds"})
+		default:
+			writeBuyError(c, err)
+		}
+
+		return
+	}
+
+	api.changed(user.ID)
+	c.JSON(http.StatusCreated, makeOrderResponse(order))
+}
+
+// ApiV2TransfersPost is the v2 of POST /api/sendCoin; a transfer made right
+// away answers 204.
+func (api *API) ApiV2TransfersPost(c *gin.Context) {
+	var request openapi.SendCoinRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	if strings.TrimSpace(request.ToUser) == "" || request.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	api.sendCoins(c, request, http.StatusNoContent)
+}
+
+// ApiV2AccountGet is the v2 of GET /api/info, always with full detail.
+func (api *API) ApiV2AccountGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	info, err := api.loadInfo(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, makeAccountResponse(user, info))
+}
+
+func makeAccountResponse(user model.User, info model.UserInfo) openapi.AccountResponse {
+	inventory := make([]openapi.InventoryItem, 0, len(info.Inventory))
+	for _, i := range info.Inventory {
+		inventory = append(inventory, openapi.InventoryItem{
+			Product:    i.ProductTitle,
+			Variant:    i.VariantSKU,
+			Quantity:   int32(i.Count), //nolint:gosec
+			AcquiredAt: i.AcquiredAt,
+		})
+	}
+
+	orders := make([]openapi.Order, 0, len(info.Orders))
+	for _, o := range info.Orders {
+		orders = append(orders, makeOrderResponse(o))
+	}
+
+	// /api/info lists accepted transfers only and leaves out the user's own name.
+	outgoing := make([]openapi.TransferHistoryItem, 0, len(info.Sent))
+	for _, t := range info.Sent {
+		t.FromUserName, t.Status = user.Username, model.TransferAccepted
+		outgoing = append(outgoing, makeTransferHistoryItem(t))
+	}
+
+	incoming := make([]openapi.TransferHistoryItem, 0, len(info.Received))
+	for _, t := range info.Received {
+		t.ToUserName, t.Status = user.Username, model.TransferAccepted
+		incoming = append(incoming, makeTransferHistoryItem(t))
+	}
+
+	expiringCoins := make([]openapi.CoinExpiration, 0, len(info.Expirations))
+	for _, e := range info.Expirations {
+		expiringCoins = append(expiringCoins, openapi.CoinExpiration{
+			Amount:    int32(e.Amount), //nolint:gosec
+			ExpiresAt: e.ExpiresAt,
+		})
+	}
+
+	return openapi.AccountResponse{
+		Balance:       int32(info.Balance), //nolint:gosec
+		Inventory:     inventory,
+		Orders:        orders,
+		Transfers:     openapi.AccountTransfers{Incoming: incoming, Outgoing: outgoing},
+		ExpiringCoins: expiringCoins,
+	}
+}
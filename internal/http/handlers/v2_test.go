@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV2Purchases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
+	orderID := uuid.New()
+
+	cases := []struct {
+		name    string
+		body    string
+		buyErr  error
+		want    int
+		wantBuy bool
+	}{
+		{name: "created", body: `{"product":"hoody","variant":"m"}`, want: http.StatusCreated, wantBuy: true},
+		{name: "bad json", body: `{"product":`, want: http.StatusBadRequest},
+		{name: "no product", body: `{"variant":"m"}`, want: http.StatusBadRequest},
+		{name: "unknown product", body: `{"product":"hoody","variant":"m"}`,
+			buyErr: repo.ErrNotFound, want: http.StatusNotFound, wantBuy: true},
+		{name: "insufficient funds", body: `{"product":"hoody","variant":"m"}`,
+			buyErr: repo.ErrInsufficient, want: http.StatusUnprocessableEntity, wantBuy: true},
+		{name: "out of stock", body: `{"product":"hoody","variant":"m"}`,
+			buyErr: repo.ErrOutOfStock, want: http.StatusConflict, wantBuy: true},
+		{name: "db error", body: `{"product":"hoody","variant":"m"}`,
+			buyErr: errors.New("db"), want: http.StatusInternalServerError, wantBuy: true},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repoMock := mock_repo.NewMockMerchRepo(ctrl)
+			if cse.wantBuy {
+				repoMock.EXPECT().
+					BuyProduct(gomock.Any(), user.ID, model.Purchase{Product: "hoody", Variant: "m"}).
+					Return(model.Order{ID: orderID, ProductTitle: "hoody"}, cse.buyErr)
+			}
+
+			api := NewAPI(repoMock, nil)
+			r := gin.New()
+			r.POST("/api/v2/purchases", withUser(user), api.ApiV2PurchasesPost)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/purchases", strings.NewReader(cse.body))
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code, w.Body.String())
+
+			if cse.want == http.StatusCreated {
+				var order openapi.Order
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+				require.Equal(t, orderID.String(), order.Id)
+			}
+		})
+	}
+}
+
+func TestV2Transfers_NoContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
+	to := model.User{ID: uuid.New(), Username: "bob"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindUserByUsername(gomock.Any(), "bob").Return(to, nil)
+	repoMock.EXPECT().SendCoins(gomock.Any(), user.ID, to.ID, int64(10), model.TransferNote{}).Return(nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/v2/transfers", withUser(user), api.ApiV2TransfersPost)
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"toUser":"bob","amount":10}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/transfers", body)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Empty(t, w.Body.String())
+}
+
+func TestV2Account_OK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
+	at := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	sentID, receivedID := uuid.New(), uuid.New()
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().
+		FindUserInfo(gomock.Any(), user.ID, infoHistoryLimit).
+		Return(model.UserInfo{
+			Balance:   90,
+			Inventory: []model.InventoryItem{{ProductTitle: "cup", Count: 2, AcquiredAt: at}},
+			Sent:      []model.Transfer{{ID: sentID, ToUserName: "bob", Amount: 7, CreatedAt: at}},
+			Received:  []model.Transfer{{ID: receivedID, FromUserName: "alice", Amount: 3, CreatedAt: at}},
+		}, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/v2/account", withUser(user), api.ApiV2AccountGet)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/account", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.AccountResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.EqualValues(t, 90, resp.Balance)
+	require.Equal(t, []openapi.InventoryItem{{Product: "cup", Quantity: 2, AcquiredAt: at}}, resp.Inventory)
+	require.Empty(t, resp.Orders)
+	require.NotNil(t, resp.ExpiringCoins)
+	require.Equal(t, []openapi.TransferHistoryItem{{
+		Id: sentID.String(), FromUser: "u", ToUser: "bob", Amount: 7, Status: "accepted", CreatedAt: at,
+	}}, resp.Transfers.Outgoing)
+	require.Equal(t, []openapi.TransferHistoryItem{{
+		Id: receivedID.String(), FromUser: "alice", ToUser: "u", Amount: 3, Status: "accepted", CreatedAt: at,
+	}}, resp.Transfers.Incoming)
+}
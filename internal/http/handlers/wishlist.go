@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/http/middleware"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (api *API) ApiWishlistGet(c *gin.Context) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	wishlist, err := api.repos.FindWishlist(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	items := make([]openapi.WishlistItem, 0, len(wishlist))
+	for _, item := range wishlist {
+		items = append(items, openapi.WishlistItem{
+			Product:     makeProductResponse(item.Product, nil),
+			Price:       int32(item.Price),                      //nolint:gosec
+			CoinsNeeded: int32(max(item.Price-user.Balance, 0)), //nolint:gosec
+			AddedAt:     item.AddedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, openapi.WishlistResponse{
+		Balance: int32(user.Balance), //nolint:gosec
+		Items:   items,
+	})
+}
+
+func (api *API) ApiWishlistPost(c *gin.Context) {
+	var request openapi.WishlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Product) == "" {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "bad payload"})
+
+		return
+	}
+
+	api.changeWishlist(c, request.Product, api.repos.AddToWishlist)
+}
+
+func (api *API) ApiWishlistDelete(c *gin.Context) {
+	product := c.Query("product")
+	if strings.TrimSpace(product) == "" {
+		c.JSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: "empty product"})
+
+		return
+	}
+
+	api.changeWishlist(c, product, api.repos.RemoveFromWishlist)
+}
+
+// changeWishlist resolves the product by title and applies change to the
+// current user's wishlist.
+func (api *API) changeWishlist(
+	c *gin.Context,
+	title string,
+	change func(ctx context.Context, userId, productId uuid.UUID) error,
+) {
+	userRaw, ok := c.Get(middleware.CtxUserKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, openapi.ErrorResponse{Errors: "no user in context"})
+
+		return
+	}
+
+	user := userRaw.(model.User) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second) //nolint:mnd
+	defer cancel()
+
+	product, err := api.repos.FindProductByTitle(ctx, title)
+	if err == nil {
+		err = change(ctx, user.ID, product.ID)
+	}
+
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			c.JSON(http.StatusNotFound, openapi.ErrorResponse{Errors: "product not found"})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, openapi.ErrorResponse{Errors: "db error"})
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
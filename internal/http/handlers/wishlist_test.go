@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mock_repo "github.com/6ermvH/MerchShop/gen/mock/repo"
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWishlist_Get_CoinsNeeded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u", Balance: 100}
+	at := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+	wishlist := []model.WishlistItem{
+		{Product: model.Product{Title: "hoody", Price: 300, Available: true}, Price: 250, AddedAt: at},
+		{Product: model.Product{Title: "socks", Price: 10}, Price: 10, AddedAt: at},
+	}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindWishlist(gomock.Any(), user.ID).Return(wishlist, nil)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.GET("/api/wishlist", withUser(user), api.ApiWishlistGet)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/wishlist", nil)
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp openapi.WishlistResponse
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, int32(100), resp.Balance)
+	require.Len(t, resp.Items, 2)
+	require.Equal(t, "hoody", resp.Items[0].Product.Title)
+	require.Equal(t, int32(250), resp.Items[0].Price)
+	require.Equal(t, int32(150), resp.Items[0].CoinsNeeded)
+	require.Equal(t, int32(0), resp.Items[1].CoinsNeeded)
+}
+
+func TestWishlist_Post(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	product := model.Product{ID: uuid.New(), Title: "hoody"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindProductByTitle(gomock.Any(), "hoody").Return(product, nil)
+	repoMock.EXPECT().AddToWishlist(gomock.Any(), user.ID, product.ID).Return(nil)
+	repoMock.EXPECT().FindProductByTitle(gomock.Any(), "yacht").Return(model.Product{}, repo.ErrNotFound)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.POST("/api/wishlist", withUser(user), api.ApiWishlistPost)
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"product":"hoody"}`, http.StatusNoContent},
+		{`{"product":"yacht"}`, http.StatusNotFound},
+		{`{"product":"  "}`, http.StatusBadRequest},
+		{`{bad`, http.StatusBadRequest},
+	}
+	for i, cse := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/wishlist", bytes.NewBufferString(cse.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equalf(t, cse.want, w.Code, "case %d", i)
+	}
+}
+
+func TestWishlist_Delete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := model.User{ID: uuid.New(), Username: "u"}
+	product := model.Product{ID: uuid.New(), Title: "hoody"}
+
+	repoMock := mock_repo.NewMockMerchRepo(ctrl)
+	repoMock.EXPECT().FindProductByTitle(gomock.Any(), "hoody").Return(product, nil).Times(2)
+	gomock.InOrder(
+		repoMock.EXPECT().RemoveFromWishlist(gomock.Any(), user.ID, product.ID).Return(nil),
+		repoMock.EXPECT().RemoveFromWishlist(gomock.Any(), user.ID, product.ID).Return(repo.ErrNotFound),
+	)
+
+	api := NewAPI(repoMock, nil)
+	r := gin.New()
+	r.DELETE("/api/wishlist", withUser(user), api.ApiWishlistDelete)
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/wishlist?product=hoody", nil)
+		r.ServeHTTP(w, req)
+		require.Equal(t, want, w.Code)
+	}
+}
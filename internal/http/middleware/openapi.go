@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/6ermvH/MerchShop/gen/openapi"
+	"github.com/6ermvH/MerchShop/internal/apispec"
+	"github.com/gin-gonic/gin"
+)
+
+// maxValidatedResponse is how much of a response body ValidateResponse keeps;
+// larger bodies are not checked.
+const maxValidatedResponse = 1 << 20
+
+// ValidateRequest rejects with 400 requests whose parameters or JSON body do
+// not match the operation spec documents for the route. Routes missing from
+// spec pass through.
+func ValidateRequest(spec *apispec.Spec) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := spec.Operation(c.Request.Method, apispec.PathFromGin(c.FullPath()))
+		if !ok {
+			c.Next()
+
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+
+		if err := op.ValidateRequest(c.Request, params); err != nil {
+			msg := "bad request"
+			if errors.Is(err, apispec.ErrInvalid) {
+				msg = err.Error()
+			}
+
+			c.AbortWithStatusJSON(http.StatusBadRequest, openapi.ErrorResponse{Errors: msg})
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ValidateResponse checks every answer against spec after the handler ran and
+// passes mismatches to report; the response itself goes out unchanged. It
+// keeps a copy of JSON bodies, so it is meant for tests and staging.
+func ValidateResponse(spec *apispec.Spec, report func(*gin.Context, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method, path := c.Request.Method, apispec.PathFromGin(c.FullPath())
+
+		op, ok := spec.Operation(method, path)
+		if !ok {
+			c.Next()
+
+			return
+		}
+
+		w := &teeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		if w.truncated {
+			return
+		}
+
+		err := op.ValidateResponse(w.Status(), w.Header().Get("Content-Type"), w.body.Bytes())
+		if err != nil {
+			report(c, fmt.Errorf("%s %s: %w", method, path, err))
+		}
+	}
+}
+
+// teeWriter keeps a copy of a JSON response body.
+type teeWriter struct {
+	gin.ResponseWriter
+
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	w.keep(b)
+
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck
+}
+
+func (w *teeWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+
+	return w.ResponseWriter.WriteString(s) //nolint:wrapcheck
+}
+
+func (w *teeWriter) keep(b []byte) {
+	if w.truncated || !strings.Contains(w.Header().Get("Content-Type"), "json") {
+		return
+	}
+
+	if w.body.Len()+len(b) > maxValidatedResponse {
+		w.truncated = true
+		w.body.Reset()
+
+		return
+	}
+
+	w.body.Write(b)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/apispec"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+paths:
+  /items/{id}:
+    post:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+              required: [name]
+      responses:
+        '200':
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  id:
+                    type: integer
+                required: [id]
+        '400':
+          content:
+            application/json:
+              schema:
+                type: object
+`
+
+func TestValidateRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec, err := apispec.Load([]byte(testSpec))
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.POST("/items/:id", ValidateRequest(spec), func(c *gin.Context) {
+		var body struct{ Name string }
+		require.NoError(t, c.ShouldBindJSON(&body))
+		c.String(http.StatusOK, body.Name)
+	})
+	r.POST("/other", ValidateRequest(spec), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		name, path, body string
+		want             int
+	}{
+		{name: "valid", path: "/items/1", body: `{"name":"mug"}`, want: http.StatusOK},
+		{name: "bad path param", path: "/items/x", body: `{"name":"mug"}`, want: http.StatusBadRequest},
+		{name: "bad body", path: "/items/1", body: `{}`, want: http.StatusBadRequest},
+		{name: "not in spec", path: "/other", body: `{}`, want: http.StatusOK},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, cse.path, strings.NewReader(cse.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec, err := apispec.Load([]byte(testSpec))
+	require.NoError(t, err)
+
+	var reported []error
+
+	r := gin.New()
+	r.Use(ValidateResponse(spec, func(_ *gin.Context, err error) { reported = append(reported, err) }))
+	r.POST("/items/:id", func(c *gin.Context) {
+		switch c.Param("id") {
+		case "1":
+			c.JSON(http.StatusOK, gin.H{"id": 1})
+		case "2":
+			c.JSON(http.StatusOK, gin.H{"name": "mug"})
+		default:
+			c.Status(http.StatusNotFound)
+		}
+	})
+
+	for _, path := range []string{"/items/1", "/items/2", "/items/3"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	require.Len(t, reported, 2)
+	require.ErrorContains(t, reported[0], "response.id is required")
+	require.ErrorContains(t, reported[1], "status 404 is not documented")
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole must be chained after Auth; it rejects users whose role is not listed.
+func RequireRole(roles ...model.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRaw, ok := c.Get(CtxUserKey)
+		if !ok {
+			unauth(c, "no user in context")
+
+			return
+		}
+
+		user, _ := userRaw.(model.User)
+		if !slices.Contains(roles, user.Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+
+			return
+		}
+
+		c.Next()
+	}
+}
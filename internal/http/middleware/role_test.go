@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		user *model.User
+		want int
+	}{
+		{name: "no user", user: nil, want: http.StatusUnauthorized},
+		{name: "plain user", user: &model.User{Role: model.RoleUser}, want: http.StatusForbidden},
+		{name: "admin", user: &model.User{Role: model.RoleAdmin}, want: http.StatusOK},
+	}
+
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/x", func(c *gin.Context) {
+				if cse.user != nil {
+					c.Set(CtxUserKey, *cse.user)
+				}
+
+				c.Next()
+			}, RequireRole(model.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/x", nil)
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, cse.want, w.Code)
+		})
+	}
+}
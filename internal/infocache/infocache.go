@@ -0,0 +1,137 @@
+// Package infocache keeps each user's /api/info summary for a short while.
+// Entries are dropped whenever the user's balance, transfers or orders
+// change: events.Broker hands every event to Invalidate, so changes made
+// through other instances or by background jobs are seen too.
+package infocache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+// DefaultMaxEntries bounds the cache when New is given no size.
+const DefaultMaxEntries = 10_000
+
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	seq     uint64
+	entries map[uuid.UUID]entry
+}
+
+// entry is either a cached summary or, when ok is false, a marker that the
+// user's data changed at seq, so a load started before that is not stored.
+type entry struct {
+	info    model.UserInfo
+	ok      bool
+	seq     uint64
+	expires time.Time
+}
+
+// New keeps summaries for ttl and at most maxEntries users; maxEntries 0
+// means DefaultMaxEntries.
+func New(ttl time.Duration, maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[uuid.UUID]entry),
+	}
+}
+
+// Load returns the user's cached summary, or calls load and caches what it
+// returns unless the user's data changed while it ran.
+func (c *Cache) Load(
+	ctx context.Context,
+	userId uuid.UUID,
+	load func(ctx context.Context) (model.UserInfo, error),
+) (model.UserInfo, error) {
+	c.mu.Lock()
+	e, found := c.entries[userId]
+	now := c.now()
+
+	if found && e.ok && now.Before(e.expires) {
+		c.mu.Unlock()
+
+		return e.info, nil
+	}
+
+	started := c.seq
+	c.mu.Unlock()
+
+	info, err := load(ctx)
+	if err != nil {
+		return model.UserInfo{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.entries[userId]; found && e.seq > started {
+		return info, nil
+	}
+
+	c.makeRoom(now)
+	c.entries[userId] = entry{info: info, ok: true, seq: started, expires: now.Add(c.ttl)}
+
+	return info, nil
+}
+
+// Forget drops the summaries of the given users.
+func (c *Cache) Forget(userIds ...uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for _, id := range userIds {
+		c.seq++
+
+		if _, found := c.entries[id]; !found {
+			c.makeRoom(now)
+		}
+
+		c.entries[id] = entry{seq: c.seq, expires: now.Add(c.ttl)}
+	}
+}
+
+// Invalidate forgets the user an event is about; it is meant to be passed
+// to events.Broker.Watch.
+func (c *Cache) Invalidate(e model.Event) {
+	c.Forget(e.UserID)
+}
+
+// makeRoom drops expired entries once the cache is full and, if that was
+// not enough, an arbitrary one. A marker dropped early lets a load it
+// guarded cache data from before the change, which expires within ttl like
+// any entry.
+func (c *Cache) makeRoom(now time.Time) {
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+
+	for id, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+
+	for id := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+
+		delete(c.entries, id)
+	}
+}
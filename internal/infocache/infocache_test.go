@@ -0,0 +1,110 @@
+package infocache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// counter is a load func that returns its call count as the balance.
+type counter struct{ calls int64 }
+
+func (c *counter) load(context.Context) (model.UserInfo, error) {
+	c.calls++
+
+	return model.UserInfo{Balance: c.calls}, nil
+}
+
+func TestCache_LoadKeepsUntilTTL(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(time.Minute, 0)
+	c.now = func() time.Time { return now }
+
+	user := uuid.New()
+	src := &counter{}
+	ctx := context.Background()
+
+	for range 3 {
+		info, err := c.Load(ctx, user, src.load)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, info.Balance)
+	}
+
+	now = now.Add(time.Minute)
+
+	info, err := c.Load(ctx, user, src.load)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, info.Balance)
+}
+
+func TestCache_Forget(t *testing.T) {
+	c := New(time.Minute, 0)
+	alice, bob := uuid.New(), uuid.New()
+	src := &counter{}
+	ctx := context.Background()
+
+	_, err := c.Load(ctx, alice, src.load)
+	require.NoError(t, err)
+
+	_, err = c.Load(ctx, bob, src.load)
+	require.NoError(t, err)
+
+	c.Invalidate(model.Event{UserID: alice})
+
+	info, err := c.Load(ctx, alice, src.load)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, info.Balance)
+
+	info, err = c.Load(ctx, bob, src.load)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, info.Balance)
+}
+
+func TestCache_ChangeDuringLoadIsNotCached(t *testing.T) {
+	c := New(time.Minute, 0)
+	user := uuid.New()
+	ctx := context.Background()
+
+	info, err := c.Load(ctx, user, func(context.Context) (model.UserInfo, error) {
+		c.Forget(user)
+
+		return model.UserInfo{Balance: 1}, nil
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, info.Balance)
+
+	src := &counter{calls: 1}
+
+	info, err = c.Load(ctx, user, src.load)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, info.Balance)
+}
+
+func TestCache_LoadError(t *testing.T) {
+	c := New(time.Minute, 0)
+	user := uuid.New()
+	boom := errors.New("db")
+
+	_, err := c.Load(context.Background(), user, func(context.Context) (model.UserInfo, error) {
+		return model.UserInfo{}, boom
+	})
+	require.ErrorIs(t, err, boom)
+	require.Empty(t, c.entries)
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	c := New(time.Minute, 2)
+	src := &counter{}
+
+	for range 5 {
+		_, err := c.Load(context.Background(), uuid.New(), src.load)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, c.entries, 2)
+}
@@ -0,0 +1,39 @@
+// Package jobs runs the background work of an API instance. Jobs must be
+// safe to run on every replica at once; they lock what they work on.
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/logx"
+)
+
+// Job is one run of a background task; it reports how many items it handled.
+type Job func(ctx context.Context) (int64, error)
+
+// Every runs job right away and then every interval until ctx is done.
+// Failed runs are logged and retried on the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, job Job) {
+	lg := logx.FromContext(ctx).With("job", name)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := job(ctx)
+
+		switch {
+		case err != nil && ctx.Err() == nil:
+			lg.Warn(ctx, "job failed", "error", err.Error())
+		case n > 0:
+			lg.Info(ctx, "job done", "items", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvery_RunsUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs atomic.Int64
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		Every(ctx, "test", time.Millisecond, func(context.Context) (int64, error) {
+			if runs.Add(1) == 3 { //nolint:mnd
+				cancel()
+			}
+
+			return 0, errors.New("keeps going after errors")
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Every did not stop after cancel")
+	}
+
+	require.Equal(t, int64(3), runs.Load())
+}
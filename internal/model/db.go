@@ -6,11 +6,20 @@ import (
 	"github.com/google/uuid"
 )
 
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleStaff Role = "staff"
+	RoleAdmin Role = "admin"
+)
+
 type User struct {
 	ID           uuid.UUID
 	Username     string
 	Balance      int64
 	PasswordHash string
+	Role         Role
 	CreatedAt    time.Time
 }
 
@@ -21,21 +30,463 @@ type Transfer struct {
 	ToUserID     uuid.UUID
 	ToUserName   string
 	Amount       int64
-	CreatedAt    time.Time
+	Memo         string
+	Category     string
+	Status       TransferStatus
+	// ExpiresAt is set for transfers that wait for the recipient to accept.
+	ExpiresAt  *time.Time
+	ResolvedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type TransferStatus string
+
+// A transfer sent with acceptance required starts pending, with the coins
+// held from the sender, and ends accepted, declined or expired; any other
+// transfer is accepted right away.
+const (
+	TransferPending  TransferStatus = "pending"
+	TransferAccepted TransferStatus = "accepted"
+	TransferDeclined TransferStatus = "declined"
+	TransferExpired  TransferStatus = "expired"
+)
+
+type TransferNote struct {
+	Memo     string
+	Category string
+}
+
+type TransferDirection string
+
+const (
+	TransferDirectionAny      TransferDirection = ""
+	TransferDirectionSent     TransferDirection = "sent"
+	TransferDirectionReceived TransferDirection = "received"
+)
+
+type TransferFilter struct {
+	Direction TransferDirection
+	Category  string
+	Limit     int
+	Offset    int
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPlaced         OrderStatus = "placed"
+	OrderStatusPacked         OrderStatus = "packed"
+	OrderStatusReadyForPickup OrderStatus = "ready_for_pickup"
+	OrderStatusDelivered      OrderStatus = "delivered"
+	OrderStatusCancelled      OrderStatus = "cancelled"
+	OrderStatusRefunded       OrderStatus = "refunded"
+)
+
+// orderFlow is the fulfilment state machine the merch desk walks an order through.
+var orderFlow = map[OrderStatus]OrderStatus{
+	OrderStatusPlaced:         OrderStatusPacked,
+	OrderStatusPacked:         OrderStatusReadyForPickup,
+	OrderStatusReadyForPickup: OrderStatusDelivered,
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPlaced, OrderStatusPacked, OrderStatusReadyForPickup,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanAdvanceTo reports whether fulfilment may move an order from s to next.
+func (s OrderStatus) CanAdvanceTo(next OrderStatus) bool {
+	want, ok := orderFlow[s]
+
+	return ok && want == next
+}
+
+// Returned reports whether the order was undone and its coins went back to the buyer.
+func (s OrderStatus) Returned() bool {
+	return s == OrderStatusCancelled || s == OrderStatusRefunded
+}
+
+// OrderTimeline holds the time an order entered each status after placed;
+// nil means the order has not been there.
+type OrderTimeline struct {
+	PackedAt         *time.Time
+	ReadyForPickupAt *time.Time
+	DeliveredAt      *time.Time
+	CancelledAt      *time.Time
+	RefundedAt       *time.Time
 }
 
+// Order keeps the product title, variant SKU and unit price as they were at
+// purchase time, so later catalog changes do not rewrite order history.
 type Order struct {
-	ID           uuid.UUID
-	Count        int32
-	UserID       uuid.UUID
+	ID     uuid.UUID
+	Count  int32
+	UserID uuid.UUID
+	// ProductID and VariantID still point at the catalog; the fields below are
+	// the purchase-time snapshot.
 	ProductID    uuid.UUID
 	ProductTitle string
 	ProductPrice int64
-	CreatedAt    time.Time
+	VariantID    *uuid.UUID
+	VariantSKU   string
+	// PricePaid is what the buyer was charged for all Count items, after
+	// promotions and promo codes.
+	PricePaid int64
+	PromoCode string
+	UserName  string
+	Status    OrderStatus
+	Timeline  OrderTimeline
+	CreatedAt time.Time
+}
+
+type OrderFilter struct {
+	Status  OrderStatus
+	Product string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
 }
 
 type Product struct {
-	ID    uuid.UUID
-	Title string
-	Price int64
+	ID          uuid.UUID
+	Title       string
+	Price       int64
+	Description string
+	ImageURL    string
+	// Stock is nil for products that are not stock-tracked.
+	Stock *int64
+	// Available is false when the product, or every one of its variants, is sold out.
+	Available bool
+}
+
+type ProductSort string
+
+const (
+	ProductSortName      ProductSort = "name"
+	ProductSortNameDesc  ProductSort = "-name"
+	ProductSortPrice     ProductSort = "price"
+	ProductSortPriceDesc ProductSort = "-price"
+)
+
+type ProductFilter struct {
+	// Query matches titles by substring or trigram similarity.
+	Query    string
+	MinPrice *int64
+	MaxPrice *int64
+	Sort     ProductSort
+	Limit    int
+	Offset   int
+}
+
+// ProductVariant is a purchasable flavour of a product, e.g. a t-shirt size.
+type ProductVariant struct {
+	ID         uuid.UUID
+	ProductID  uuid.UUID
+	SKU        string
+	Attributes map[string]string
+	// Price overrides Product.Price when set.
+	Price *int64
+	// Stock is nil for variants that are not stock-tracked.
+	Stock *int64
+	// Default is bought when a purchase names no variant.
+	Default bool
+}
+
+func (v ProductVariant) InStock() bool {
+	return v.Stock == nil || *v.Stock > 0
+}
+
+func (v ProductVariant) PriceOr(def int64) int64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+
+	return def
+}
+
+// Purchase describes what a user asked to buy.
+type Purchase struct {
+	Product   string
+	Variant   string
+	PromoCode string
+}
+
+// Promotion overrides the price of a product, or of one of its variants,
+// between StartsAt and EndsAt.
+type Promotion struct {
+	ID        uuid.UUID
+	ProductID uuid.UUID
+	VariantID *uuid.UUID
+	Price     int64
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedAt time.Time
+}
+
+type PromoCodeKind string
+
+const (
+	PromoCodePercent PromoCodeKind = "percent"
+	PromoCodeFixed   PromoCodeKind = "fixed"
+)
+
+type PromoCode struct {
+	Code  string
+	Kind  PromoCodeKind
+	Value int64
+	// MaxUses, PerUserLimit and ExpiresAt are not enforced when nil.
+	MaxUses      *int64
+	PerUserLimit *int64
+	ExpiresAt    *time.Time
+	UsedCount    int64
+	CreatedAt    time.Time
+}
+
+// Apply returns price after the discount; it never goes below zero.
+func (c PromoCode) Apply(price int64) int64 {
+	switch c.Kind {
+	case PromoCodePercent:
+		price -= price * c.Value / 100 //nolint:mnd
+	case PromoCodeFixed:
+		price -= c.Value
+	}
+
+	return max(price, 0)
+}
+
+// WishlistItem is a product a user wants, with its price as of now.
+type WishlistItem struct {
+	Product Product
+	// Price is the product price with any running promotion applied.
+	Price   int64
+	AddedAt time.Time
+}
+
+// ProductUpdate is an admin change to a product; nil and zero fields are left as is.
+type ProductUpdate struct {
+	Price *int64
+	// Restock is added to the stock of the variant, or of the product when
+	// VariantID is nil.
+	Restock   int64
+	VariantID *uuid.UUID
+}
+
+type NotificationKind string
+
+const (
+	NotificationCoinsReceived   NotificationKind = "coins_received"
+	NotificationOrderStatus     NotificationKind = "order_status"
+	NotificationBalanceAdjusted NotificationKind = "balance_adjusted"
+	NotificationBackInStock     NotificationKind = "back_in_stock"
+	NotificationPriceDrop       NotificationKind = "price_drop"
+	NotificationTransferPending NotificationKind = "transfer_pending"
+	// NotificationTransferReturned tells the sender a pending transfer was
+	// declined or expired and the coins are back.
+	NotificationTransferReturned NotificationKind = "transfer_returned"
+	NotificationCoinsExpired     NotificationKind = "coins_expired"
+)
+
+var notificationKinds = map[NotificationKind]struct{}{
+	NotificationCoinsReceived:    {},
+	NotificationOrderStatus:      {},
+	NotificationBalanceAdjusted:  {},
+	NotificationBackInStock:      {},
+	NotificationPriceDrop:        {},
+	NotificationTransferPending:  {},
+	NotificationTransferReturned: {},
+	NotificationCoinsExpired:     {},
+}
+
+func (k NotificationKind) Valid() bool {
+	_, ok := notificationKinds[k]
+
+	return ok
+}
+
+type Notification struct {
+	ID      uuid.UUID
+	UserID  uuid.UUID
+	Kind    NotificationKind
+	Message string
+	// Data holds ids and values the client may need to link the notification
+	// to, e.g. the product.
+	Data      map[string]string
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
+
+type NotificationFilter struct {
+	UnreadOnly bool
+	Limit      int
+	Offset     int
+}
+
+type EventType string
+
+const (
+	EventBalance  EventType = "balance"
+	EventTransfer EventType = "transfer"
+	EventOrder    EventType = "order"
+)
+
+// Event is a change pushed to the user's live stream. IDs grow over time,
+// so a client can resume after the last one it saw.
+type Event struct {
+	ID        int64
+	UserID    uuid.UUID
+	Type      EventType
+	Data      map[string]any
+	CreatedAt time.Time
+}
+
+type LeaderboardWindow string
+
+const (
+	LeaderboardWeek  LeaderboardWindow = "week"
+	LeaderboardMonth LeaderboardWindow = "month"
+	LeaderboardAll   LeaderboardWindow = "all"
+)
+
+// Valid reports whether w is one of the windows above.
+func (w LeaderboardWindow) Valid() bool {
+	switch w {
+	case LeaderboardWeek, LeaderboardMonth, LeaderboardAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// Since returns the start of the window counted back from now; zero means
+// all time.
+func (w LeaderboardWindow) Since(now time.Time) time.Time {
+	switch w {
+	case LeaderboardWeek:
+		return now.AddDate(0, 0, -7)
+	case LeaderboardMonth:
+		return now.AddDate(0, -1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+type LeaderboardEntry struct {
+	UserName string
+	// Amount is coins sent or received; for the most generous board it is the
+	// number of distinct recipients.
+	Amount int64
+	Count  int64
+}
+
+// Leaderboard leaves out users who opted out of public ranking.
+type Leaderboard struct {
+	TopReceivers []LeaderboardEntry
+	TopSenders   []LeaderboardEntry
+	MostGenerous []LeaderboardEntry
+}
+
+type UserStats struct {
+	UserName       string
+	Sent           int64
+	SentCount      int64
+	Received       int64
+	ReceivedCount  int64
+	Counterparties int64
+	// FavouriteProduct is the product the user bought most, empty if none.
+	FavouriteProduct  string
+	LeaderboardOptOut bool
+}
+
+// InventoryItem is how many of a product, in one variant, the user holds
+// across orders that were not cancelled or refunded.
+type InventoryItem struct {
+	ProductTitle string
+	VariantSKU   string
+	Count        int64
+	// AcquiredAt is when the latest of them was bought.
+	AcquiredAt time.Time
+}
+
+// UserInfo is the /api/info summary. Orders, Sent and Received hold only the
+// most recent entries, newest first; Inventory covers every order and is
+// sorted by title, then variant.
+type UserInfo struct {
+	Balance     int64
+	Inventory   []InventoryItem
+	Orders      []Order
+	Sent        []Transfer
+	Received    []Transfer
+	Expirations []CoinExpiration
+}
+
+type ScheduleStatus string
+
+const (
+	ScheduleActive    ScheduleStatus = "active"
+	SchedulePaused    ScheduleStatus = "paused"
+	ScheduleCancelled ScheduleStatus = "cancelled"
+	// ScheduleCompleted is where a one-off schedule ends after its run.
+	ScheduleCompleted ScheduleStatus = "completed"
+)
+
+// CanChangeTo reports whether the owner may move a schedule from s to next:
+// pause and resume it, or cancel it while it has runs left.
+func (s ScheduleStatus) CanChangeTo(next ScheduleStatus) bool {
+	switch next {
+	case SchedulePaused:
+		return s == ScheduleActive
+	case ScheduleActive:
+		return s == SchedulePaused
+	case ScheduleCancelled:
+		return s == ScheduleActive || s == SchedulePaused
+	default:
+		return false
+	}
+}
+
+// ScheduledTransfer sends Amount coins to ToUserID at NextRunAt, once or
+// on every match of the Recurrence cron expression.
+type ScheduledTransfer struct {
+	ID         uuid.UUID
+	FromUserID uuid.UUID
+	ToUserID   uuid.UUID
+	ToUserName string
+	Amount     int64
+	Note       TransferNote
+	// Recurrence is empty for a one-off transfer.
+	Recurrence string
+	Status     ScheduleStatus
+	// NextRunAt is nil once the schedule is cancelled or completed.
+	NextRunAt *time.Time
+	// LastRun is nil until the schedule has run.
+	LastRun   *ScheduledRun
+	CreatedAt time.Time
+}
+
+type ScheduledRunStatus string
+
+const (
+	ScheduledRunSucceeded ScheduledRunStatus = "succeeded"
+	// ScheduledRunSkipped means the sender lacked the coins; nothing was sent.
+	ScheduledRunSkipped ScheduledRunStatus = "skipped"
+	ScheduledRunFailed  ScheduledRunStatus = "failed"
+)
+
+type ScheduledRun struct {
+	ScheduledFor time.Time
+	Status       ScheduledRunStatus
+	Error        string
+	CreatedAt    time.Time
+}
+
+// CoinExpiration is how many of a user's coins expire on a day.
+type CoinExpiration struct {
+	Amount    int64
+	ExpiresAt time.Time
 }
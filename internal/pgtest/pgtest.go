@@ -0,0 +1,282 @@
+// Package pgtest gives tests their own freshly migrated Postgres database.
+//
+// It uses the server in TEST_DATABASE_URL, which needs the right to create
+// databases, or else starts a throwaway one with the initdb and pg_ctl found
+// on PATH or through pg_config. Without either the tests are skipped.
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var errNoPostgres = errors.New("no TEST_DATABASE_URL and no local Postgres binaries")
+
+var (
+	startOnce sync.Once
+	server    *Server
+	errStart  error
+)
+
+// Server is a Postgres server the tests create their databases in.
+type Server struct {
+	url *url.URL
+	// dataDir and pgCtl are set when the server was started by Start.
+	dataDir string
+	pgCtl   string
+}
+
+// Run runs the tests and then stops the server they started, if any.
+// Call it from TestMain.
+func Run(m *testing.M) int {
+	code := m.Run()
+
+	if server != nil {
+		if err := server.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "pgtest:", err)
+		}
+	}
+
+	return code
+}
+
+// DB connects to a database of its own for tb, see DSN.
+func DB(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+
+	pool, err := pgxpool.New(context.Background(), DSN(tb))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(pool.Close)
+
+	return pool
+}
+
+// DSN creates a database with every migration applied and returns its URL.
+// The database is dropped when tb ends.
+func DSN(tb testing.TB) string {
+	tb.Helper()
+
+	ctx := context.Background()
+
+	startOnce.Do(func() {
+		server, errStart = Start(ctx)
+	})
+
+	if errors.Is(errStart, errNoPostgres) {
+		tb.Skip(errStart)
+	}
+
+	if errStart != nil {
+		tb.Fatal(errStart)
+	}
+
+	dsn, drop, err := server.CreateDatabase(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() {
+		if err := drop(); err != nil {
+			tb.Error(err)
+		}
+	})
+
+	return dsn
+}
+
+// Start returns the server in TEST_DATABASE_URL or starts a new one.
+func Start(ctx context.Context) (*Server, error) {
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("parse TEST_DATABASE_URL: %w", err)
+		}
+
+		return &Server{url: u}, nil
+	}
+
+	bin, err := binDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest-")
+	if err != nil {
+		return nil, fmt.Errorf("make data dir: %w", err)
+	}
+
+	s := &Server{dataDir: filepath.Join(dir, "data"), pgCtl: filepath.Join(bin, "pg_ctl")}
+
+	if err := run(ctx, filepath.Join(bin, "initdb"),
+		"-D", s.dataDir, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync",
+	); err != nil {
+		return nil, errors.Join(err, os.RemoveAll(dir))
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, errors.Join(err, os.RemoveAll(dir))
+	}
+
+	if err := run(ctx, s.pgCtl, "start", "-w", "-D", s.dataDir, "-l", filepath.Join(dir, "log"),
+		"-o", fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -F", port, dir),
+	); err != nil {
+		return nil, errors.Join(err, os.RemoveAll(dir))
+	}
+
+	s.url = &url.URL{
+		Scheme:   "postgres",
+		User:     url.User("postgres"),
+		Host:     net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		Path:     "/postgres",
+		RawQuery: "sslmode=disable",
+	}
+
+	return s, nil
+}
+
+// Stop shuts down and removes a server started by Start.
+func (s *Server) Stop() error {
+	if s.dataDir == "" {
+		return nil
+	}
+
+	err := run(context.Background(), s.pgCtl, "stop", "-D", s.dataDir, "-m", "immediate")
+
+	return errors.Join(err, os.RemoveAll(filepath.Dir(s.dataDir)))
+}
+
+// CreateDatabase creates a database with every migration applied and
+// returns its URL and a func that drops it.
+func (s *Server) CreateDatabase(ctx context.Context) (string, func() error, error) {
+	name := "merch_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	if err := s.admin(ctx, "CREATE DATABASE "+name); err != nil {
+		return "", nil, err
+	}
+
+	drop := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) //nolint:mnd
+		defer cancel()
+
+		return s.admin(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+	}
+
+	u := *s.url
+	u.Path = "/" + name
+
+	if err := Migrate(ctx, u.String()); err != nil {
+		return "", nil, errors.Join(err, drop())
+	}
+
+	return u.String(), drop, nil
+}
+
+func (s *Server) admin(ctx context.Context, sql string) error {
+	conn, err := pgx.Connect(ctx, s.url.String())
+	if err != nil {
+		return fmt.Errorf("connect to test server: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+// Migrate applies the up migrations in migrations/ to the database in dsn.
+func Migrate(ctx context.Context, dsn string) error {
+	files, err := filepath.Glob(filepath.Join(migrationsDir(), "*.up.sql"))
+	if err != nil || len(files) == 0 {
+		return fmt.Errorf("find migrations in %s: %w", migrationsDir(), err)
+	}
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("connect to test database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read migration: %w", err)
+		}
+
+		// Without arguments pgx sends the file as one simple query, so
+		// it may hold several statements.
+		if _, err := conn.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("apply %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return nil
+}
+
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}
+
+func binDir(ctx context.Context) (string, error) {
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(initdb), nil
+	}
+
+	// pg_config comes with libpq too, so the server may not be installed.
+	out, err := exec.CommandContext(ctx, "pg_config", "--bindir").Output()
+	if err != nil {
+		return "", errNoPostgres
+	}
+
+	bin := strings.TrimSpace(string(out))
+	if _, err := os.Stat(filepath.Join(bin, "initdb")); err != nil {
+		return "", errNoPostgres
+	}
+
+	return bin, nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(name), err, out)
+	}
+
+	return nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("find free port: %w", err)
+	}
+
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil //nolint:forcetypeassert
+}
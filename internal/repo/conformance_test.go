@@ -0,0 +1,48 @@
+//go:build integration
+
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/6ermvH/MerchShop/internal/repo/repotest"
+	"github.com/google/uuid"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	repotest.Run(t, func(t *testing.T) repotest.Harness {
+		pool := pgtest.DB(t)
+
+		return repotest.Harness{
+			Repo: repo.NewRepo(pool),
+			SetStock: func(tb testing.TB, productId uuid.UUID, stock int64) {
+				tb.Helper()
+
+				if _, err := pool.Exec(context.Background(), `
+					UPDATE merch_shop.products SET stock = $2 WHERE id = $1
+				`, productId, stock); err != nil {
+					tb.Fatal(err)
+				}
+			},
+			SetVariantPrice: func(tb testing.TB, variantId uuid.UUID, price int64) {
+				tb.Helper()
+
+				if _, err := pool.Exec(context.Background(), `
+					UPDATE merch_shop.product_variants SET price = $2 WHERE id = $1
+				`, variantId, price); err != nil {
+					tb.Fatal(err)
+				}
+			},
+			CheckCoins: func(tb testing.TB, users []uuid.UUID, want int64) {
+				tb.Helper()
+
+				repo.CheckConserved(tb, pool, users, want)
+			},
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+// EventsChannel is the LISTEN/NOTIFY channel every stored event is announced on.
+const EventsChannel = "merch_events"
+
+// publishEvent stores an event for the user and announces it on
+// EventsChannel. Postgres delivers the notification only when the
+// surrounding transaction commits, so listeners never see rolled back changes.
+func (r *Repo) publishEvent(
+	ctx context.Context,
+	userId uuid.UUID,
+	typ model.EventType,
+	data map[string]any,
+) error {
+	q := r.runner(ctx)
+
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	if _, err := q.Exec(ctx, `
+		WITH e AS (
+			INSERT INTO merch_shop.events (user_id, type, data)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, type, data
+		)
+		SELECT pg_notify($4, json_build_object(
+			'id', e.id, 'userId', e.user_id, 'type', e.type, 'data', e.data
+		)::text)
+		FROM e
+	`, userId, string(typ), data, EventsChannel); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+// FindEventsSince returns up to limit events of the user with ids above afterId, oldest first.
+func (r *Repo) FindEventsSince(
+	ctx context.Context,
+	userId uuid.UUID,
+	afterId int64,
+	limit int,
+) ([]model.Event, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT id, user_id, type, data, created_at
+		FROM merch_shop.events
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, userId, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var events []model.Event
+
+	for rows.Next() {
+		var e model.Event
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &e.Data, &e.CreatedAt); err != nil {
+			return events, fmt.Errorf("scan row: %w", err)
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return events, nil
+}
+
+// DeleteEventsBefore drops events that are too old to be worth replaying.
+func (r *Repo) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	q := r.runner(ctx)
+
+	tag, err := q.Exec(ctx, `
+		DELETE FROM merch_shop.events WHERE created_at < $1
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("exec sql: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,6 @@
+//go:build integration
+
+package repo
+
+// CheckConserved lets the conformance suite check the coin lots too.
+var CheckConserved = checkConserved
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// FindUserInfo gathers everything /api/info shows in a single round trip:
+// the queries go out as one batch. limit bounds each of the order, sent and
+// received histories; the inventory is aggregated over all orders.
+//
+// It reads from the primary even with a replica: the answer is cached until
+// the user's next change, so a lagging read would be served for the whole TTL.
+func (r *Repo) FindUserInfo(
+	ctx context.Context,
+	userId uuid.UUID,
+	limit int,
+) (model.UserInfo, error) {
+	q := r.runner(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(`SELECT balance FROM merch_shop.users WHERE id = $1`, userId)
+	batch.Queue(`
+		SELECT product_title, variant_sku, sum(quantity), max(created_at)
+		FROM merch_shop.orders
+		WHERE user_id = $1 AND status NOT IN ('cancelled', 'refunded')
+		GROUP BY product_title, variant_sku
+		ORDER BY product_title, variant_sku
+	`, userId)
+	batch.Queue(`
+		SELECT `+orderColumns+`
+		FROM merch_shop.orders AS o`+orderJoins+`
+		WHERE o.user_id = $1
+		ORDER BY o.created_at DESC, o.id
+		LIMIT $2
+	`, userId, limit)
+	batch.Queue(`
+		SELECT t.id, t.from_user_id, t.to_user_id, u.username, t.amount, t.memo, t.category, t.created_at
+		FROM merch_shop.transfers AS t
+		JOIN merch_shop.users AS u ON t.to_user_id = u.id
+		WHERE t.from_user_id = $1 AND t.status = 'accepted'
+		ORDER BY t.created_at DESC, t.id
+		LIMIT $2
+	`, userId, limit)
+	batch.Queue(`
+		SELECT t.id, t.from_user_id, u.username, t.to_user_id, t.amount, t.memo, t.category, t.created_at
+		FROM merch_shop.transfers AS t
+		JOIN merch_shop.users AS u ON t.from_user_id = u.id
+		WHERE t.to_user_id = $1 AND t.status = 'accepted'
+		ORDER BY t.created_at DESC, t.id
+		LIMIT $2
+	`, userId, limit)
+	batch.Queue(`
+		SELECT sum(remaining), min(expires_at)
+		FROM merch_shop.coin_lots
+		WHERE user_id = $1 AND remaining > 0 AND expires_at > now()
+		GROUP BY date_trunc('day', expires_at)
+		ORDER BY 2
+		LIMIT $2
+	`, userId, upcomingExpirations)
+
+	results := q.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var info model.UserInfo
+	if err := results.QueryRow().Scan(&info.Balance); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.UserInfo{}, ErrNotFound
+		}
+
+		return model.UserInfo{}, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	var err error
+	if info.Inventory, err = collectBatch(results, func(row pgx.Row, i *model.InventoryItem) error {
+		return row.Scan(&i.ProductTitle, &i.VariantSKU, &i.Count, &i.AcquiredAt) //nolint:wrapcheck
+	}); err != nil {
+		return model.UserInfo{}, err
+	}
+
+	if info.Orders, err = collectBatch(results, scanOrder); err != nil {
+		return model.UserInfo{}, err
+	}
+
+	if info.Sent, err = collectBatch(results, func(row pgx.Row, t *model.Transfer) error {
+		return row.Scan( //nolint:wrapcheck
+			&t.ID, &t.FromUserID, &t.ToUserID, &t.ToUserName, &t.Amount, &t.Memo, &t.Category, &t.CreatedAt,
+		)
+	}); err != nil {
+		return model.UserInfo{}, err
+	}
+
+	if info.Received, err = collectBatch(results, func(row pgx.Row, t *model.Transfer) error {
+		return row.Scan( //nolint:wrapcheck
+			&t.ID, &t.FromUserID, &t.FromUserName, &t.ToUserID, &t.Amount, &t.Memo, &t.Category, &t.CreatedAt,
+		)
+	}); err != nil {
+		return model.UserInfo{}, err
+	}
+
+	if info.Expirations, err = collectBatch(results, func(row pgx.Row, e *model.CoinExpiration) error {
+		return row.Scan(&e.Amount, &e.ExpiresAt) //nolint:wrapcheck
+	}); err != nil {
+		return model.UserInfo{}, err
+	}
+
+	if err := results.Close(); err != nil {
+		return model.UserInfo{}, fmt.Errorf("close batch: %w", err)
+	}
+
+	return info, nil
+}
+
+// collectBatch reads the rows of the next query in a batch.
+func collectBatch[T any](results pgx.BatchResults, scan func(pgx.Row, *T) error) ([]T, error) {
+	rows, err := results.Query()
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var items []T
+
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return items, nil
+}
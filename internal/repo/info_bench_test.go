@@ -0,0 +1,107 @@
+//go:build integration
+
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// heavyHistory is how many transfers each way and how many orders the
+// benchmark user has.
+const heavyHistory = 10_000
+
+// seedHistory gives user n orders of a few products and n transfers to and
+// from peer, spread over the last n minutes.
+func seedHistory(tb testing.TB, pool *pgxpool.Pool, user, peer uuid.UUID, n int) {
+	tb.Helper()
+
+	ctx := context.Background()
+
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO merch_shop.orders (
+			user_id, product_id, product_title, unit_price, quantity, price_paid, status, created_at
+		)
+		SELECT $1, p.id, p.title, p.price, 1, p.price,
+			CASE WHEN i % 10 = 0 THEN 'cancelled' ELSE 'delivered' END,
+			now() - i * interval '1 minute'
+		FROM generate_series(1, $2) AS i
+		JOIN merch_shop.products AS p ON p.title = (ARRAY['pen', 'cup', 'socks', 'book'])[i % 4 + 1]
+	`, user, n); err != nil {
+		tb.Fatal(err)
+	}
+
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO merch_shop.transfers (from_user_id, to_user_id, amount, memo, created_at)
+		SELECT
+			CASE WHEN i % 2 = 0 THEN $1 ELSE $2 END::uuid,
+			CASE WHEN i % 2 = 0 THEN $2 ELSE $1 END::uuid,
+			i % 50 + 1, 'bench', now() - i * interval '30 seconds'
+		FROM generate_series(1, $3 * 2) AS i
+	`, user, peer, n); err != nil {
+		tb.Fatal(err)
+	}
+
+	if _, err := pool.Exec(ctx, `ANALYZE merch_shop.orders, merch_shop.transfers`); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func newHeavyUser(b *testing.B) (*Repo, uuid.UUID) {
+	b.Helper()
+
+	pool := pgtest.DB(b)
+	r := NewRepo(pool)
+	users := seedUsers(b, r, 2, 1000)
+	seedHistory(b, pool, users[0], users[1], heavyHistory)
+
+	return r, users[0]
+}
+
+func BenchmarkFindUserInfo(b *testing.B) {
+	r, user := newHeavyUser(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := r.FindUserInfo(ctx, user, 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkInfoPerQuery is how /api/info used to load: every order and
+// transfer, one query after another.
+func BenchmarkInfoPerQuery(b *testing.B) {
+	r, user := newHeavyUser(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := r.FindUserByID(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := r.FindOrdersByUserID(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := r.FindTransfersFromID(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := r.FindTransfersToID(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := r.FindCoinExpirations(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+//go:build integration
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRepo(t *testing.T, opts ...Option) (*Repo, *pgxpool.Pool) {
+	t.Helper()
+
+	pool := pgtest.DB(t)
+
+	return NewRepo(pool, opts...), pool
+}
+
+func TestExpireCoinLots(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t, WithCoinTTL(time.Hour))
+	ctx := context.Background()
+	user := seedUsers(t, r, 1, 100)[0]
+
+	_, err := r.AdjustBalance(ctx, user, 50, "bonus")
+	require.NoError(t, err)
+
+	_, err = r.AddToBalance(ctx, user, -30)
+	require.NoError(t, err)
+
+	// The oldest lot, 100 coins less the 30 spent, expires.
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.coin_lots SET expires_at = now() - interval '1 minute'
+		WHERE user_id = $1 AND amount = 100
+	`, user)
+	require.NoError(t, err)
+
+	n, err := r.ExpireCoinLots(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	requireBalance(t, r, user, 50)
+
+	expirations, err := r.FindCoinExpirations(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, expirations, 1)
+	require.EqualValues(t, 50, expirations[0].Amount)
+}
+
+func TestRefundKeepsCoinExpiry(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t, WithCoinTTL(time.Hour))
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+	seedProduct(t, pool, 20, 1)
+
+	_, err := r.AdjustBalance(ctx, users[0], 50, "bonus")
+	require.NoError(t, err)
+
+	// Both take coins from the oldest lot, and get them back there.
+	order, err := r.BuyProduct(ctx, users[0], model.Purchase{Product: "test-product"})
+	require.NoError(t, err)
+	transfer, err := r.SendPendingCoins(ctx, users[0], users[1], 10, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+
+	_, err = r.RefundOrder(ctx, order.ID)
+	require.NoError(t, err)
+	_, err = r.DeclineTransfer(ctx, users[1], transfer.ID)
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.coin_lots SET expires_at = now() - interval '1 minute'
+		WHERE user_id = $1 AND amount = 100
+	`, users[0])
+	require.NoError(t, err)
+
+	n, err := r.ExpireCoinLots(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	requireBalance(t, r, users[0], 50)
+
+	// Refunding again gives nothing back twice.
+	_, err = r.RefundOrder(ctx, order.ID)
+	require.ErrorIs(t, err, ErrOrderNotRefundable)
+}
+
+func TestBackfillCoinLots(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t)
+	ctx := context.Background()
+	user := seedUsers(t, r, 1, 100)[0]
+
+	// A balance from before lots were tracked.
+	_, err := pool.Exec(ctx, `UPDATE merch_shop.users SET balance = balance + 40 WHERE id = $1`, user)
+	require.NoError(t, err)
+
+	n, err := r.BackfillCoinLots(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	n, err = r.BackfillCoinLots(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	var lots int64
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT sum(remaining) FROM merch_shop.coin_lots WHERE user_id = $1 AND expires_at IS NULL
+	`, user).Scan(&lots))
+	require.EqualValues(t, 140, lots)
+}
+
+func TestBackfillCoinLots_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	const instances = 4
+
+	r, pool := newTestRepo(t)
+	ctx := context.Background()
+	users := seedUsers(t, r, 3, 100)
+
+	_, err := pool.Exec(ctx, `UPDATE merch_shop.users SET balance = balance + 40 WHERE id = ANY($1)`, users)
+	require.NoError(t, err)
+
+	// Instances starting together credit every gap once between them.
+	var (
+		wg    sync.WaitGroup
+		total atomic.Int64
+	)
+
+	errs := make(chan error, instances)
+
+	for range instances {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			n, err := NewRepo(pool).BackfillCoinLots(ctx)
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			total.Add(n)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, len(users), total.Load())
+	checkConserved(t, pool, users, int64(len(users))*140)
+}
+
+func TestTransferWindowsFollowDatabaseClock(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t, WithTransferRules(DailySendCap(50), MinAccountAge{Age: time.Hour}))
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+
+	err := r.SendCoins(ctx, users[0], users[1], 10, model.TransferNote{})
+	require.Equal(t, TransferCodeAccountTooNew, policyCode(t, err))
+
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.users SET created_at = now() - interval '2 hours' WHERE id = $1
+	`, users[0])
+	require.NoError(t, err)
+
+	require.NoError(t, r.SendCoins(ctx, users[0], users[1], 40, model.TransferNote{}))
+
+	err = r.SendCoins(ctx, users[0], users[1], 20, model.TransferNote{})
+	require.Equal(t, TransferCodeDailyCap, policyCode(t, err))
+
+	// Two days later the transfer no longer counts towards the cap.
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.transfers SET created_at = now() - interval '2 days' WHERE from_user_id = $1
+	`, users[0])
+	require.NoError(t, err)
+
+	require.NoError(t, r.SendCoins(ctx, users[0], users[1], 20, model.TransferNote{}))
+}
+
+func TestPendingTransferExpiresByDatabaseClock(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t)
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+
+	transfer, err := r.SendPendingCoins(ctx, users[0], users[1], 10, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+
+	// Expired by the database clock, before ExpireTransfers has refunded it.
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.transfers SET expires_at = now() - interval '1 second' WHERE id = $1
+	`, transfer.ID)
+	require.NoError(t, err)
+
+	_, err = r.AcceptTransfer(ctx, users[1], transfer.ID)
+	require.ErrorIs(t, err, ErrTransferNotPending)
+
+	n, err := r.ExpireTransfers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func TestLeaderboardWindowFollowsDatabaseClock(t *testing.T) {
+	t.Parallel()
+
+	r, pool := newTestRepo(t)
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+
+	require.NoError(t, r.SendCoins(ctx, users[0], users[1], 40, model.TransferNote{}))
+
+	_, err := pool.Exec(ctx, `
+		UPDATE merch_shop.transfers SET created_at = now() - interval '8 days' WHERE from_user_id = $1
+	`, users[0])
+	require.NoError(t, err)
+
+	board, err := r.FindLeaderboard(ctx, model.LeaderboardWeek, 10)
+	require.NoError(t, err)
+	require.Empty(t, board.TopSenders)
+
+	require.NoError(t, r.SendCoins(ctx, users[0], users[1], 20, model.TransferNote{}))
+
+	board, err = r.FindLeaderboard(ctx, model.LeaderboardWeek, 10)
+	require.NoError(t, err)
+	require.Len(t, board.TopSenders, 1)
+	require.EqualValues(t, 20, board.TopSenders[0].Amount)
+
+	board, err = r.FindLeaderboard(ctx, model.LeaderboardMonth, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 60, board.TopSenders[0].Amount)
+}
+
+// brokenRule fails with an error no run status stands for.
+type brokenRule struct {
+	from uuid.UUID
+}
+
+func (b *brokenRule) Check(_ context.Context, _ TransferHistory, t TransferAttempt) error {
+	if t.From.ID == b.from {
+		return errors.New("rule backend unavailable")
+	}
+
+	return nil
+}
+
+func TestScheduledTransferErrorDoesNotStallOthers(t *testing.T) {
+	t.Parallel()
+
+	rule := &brokenRule{}
+	r, pool := newTestRepo(t, WithTransferRules(rule))
+	ctx := context.Background()
+	users := seedUsers(t, r, 3, 100)
+	rule.from = users[0]
+
+	// The broken schedule is due first.
+	var broken uuid.UUID
+
+	for i, from := range users[:2] {
+		due := time.Now().Add(-time.Duration(2-i) * time.Minute)
+
+		s, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+			FromUserID: from, ToUserID: users[2], Amount: 10, NextRunAt: &due,
+		})
+		require.NoError(t, err)
+
+		if i == 0 {
+			broken = s.ID
+		}
+	}
+
+	n, err := r.RunDueScheduledTransfers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	requireBalance(t, r, users[2], 110)
+
+	var retryIn float64
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT EXTRACT(EPOCH FROM next_run_at - now())::float8
+		FROM merch_shop.scheduled_transfers WHERE id = $1
+	`, broken).Scan(&retryIn))
+	require.InDelta(t, ScheduleRetryAfter.Seconds(), retryIn, 5)
+
+	_, err = pool.Exec(ctx, `
+		UPDATE merch_shop.scheduled_transfers
+		SET attempts = $2, next_run_at = now() - interval '1 second'
+		WHERE id = $1
+	`, broken, ScheduleMaxAttempts-1)
+	require.NoError(t, err)
+
+	_, err = r.RunDueScheduledTransfers(ctx)
+	require.NoError(t, err)
+
+	schedules, err := r.FindScheduledTransfers(ctx, users[0])
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduleCompleted, schedules[0].Status)
+	require.Equal(t, model.ScheduledRunFailed, schedules[0].LastRun.Status)
+}
+
+func TestReplicaReads(t *testing.T) {
+	t.Parallel()
+
+	// A server that is not a replica reports no lag, so reads go to it.
+	primary := pgtest.DB(t)
+	r := NewRepo(primary, WithReplica(primary, time.Second))
+	ctx := context.Background()
+
+	require.True(t, r.replica.lagWithin(ctx))
+
+	buyer := seedUsers(t, r, 1, 10)[0]
+	seedProduct(t, primary, 10, 1)
+
+	_, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "test-product"})
+	require.NoError(t, err)
+
+	orders, err := r.FindOrdersByUserID(ctx, buyer)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+}
+
+func requireBalance(t *testing.T, r *Repo, userId uuid.UUID, want int64) {
+	t.Helper()
+
+	u, err := r.FindUserByID(context.Background(), userId)
+	require.NoError(t, err)
+	require.Equal(t, want, u.Balance)
+}
+
+// seedProduct adds "test-product" to the catalog.
+func seedProduct(tb testing.TB, pool *pgxpool.Pool, price, stock int64) uuid.UUID {
+	tb.Helper()
+
+	var id uuid.UUID
+	if err := pool.QueryRow(context.Background(), `
+		INSERT INTO merch_shop.products (title, price, stock)
+		VALUES ('test-product', $1, $2)
+		RETURNING id
+	`, price, stock).Scan(&id); err != nil {
+		tb.Fatal(err)
+	}
+
+	return id
+}
+
+func seedUsers(tb testing.TB, r *Repo, n int, balance int64) []uuid.UUID {
+	tb.Helper()
+
+	ctx := context.Background()
+	ids := make([]uuid.UUID, n)
+
+	for i := range ids {
+		u, err := r.CreateUser(ctx, fmt.Sprintf("test-%s", uuid.NewString()), "x")
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		if _, err := r.AdjustBalance(ctx, u.ID, balance, "test"); err != nil {
+			tb.Fatal(err)
+		}
+
+		ids[i] = u.ID
+	}
+
+	return ids
+}
+
+// checkConserved fails unless the users hold want coins between them, none
+// has a negative balance and every balance matches the user's coin lots.
+func checkConserved(tb testing.TB, pool *pgxpool.Pool, users []uuid.UUID, want int64) {
+	tb.Helper()
+
+	rows, err := pool.Query(context.Background(), `
+		SELECT u.id, u.balance, COALESCE(sum(l.remaining), 0)
+		FROM merch_shop.users u
+		LEFT JOIN merch_shop.coin_lots l ON l.user_id = u.id
+		WHERE u.id = ANY($1)
+		GROUP BY u.id, u.balance
+	`, users)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var total int64
+
+	for rows.Next() {
+		var (
+			id             uuid.UUID
+			balance, inLot int64
+		)
+		if err := rows.Scan(&id, &balance, &inLot); err != nil {
+			tb.Fatal(err)
+		}
+
+		if balance < 0 {
+			tb.Errorf("user %s has balance %d", id, balance)
+		}
+
+		if balance != inLot {
+			tb.Errorf("user %s has balance %d but %d coins in lots", id, balance, inLot)
+		}
+
+		total += balance
+	}
+
+	if err := rows.Err(); err != nil {
+		tb.Fatal(err)
+	}
+
+	if total != want {
+		tb.Errorf("users hold %d coins in total, want %d", total, want)
+	}
+}
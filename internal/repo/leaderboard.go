@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// FindLeaderboard ranks users by accepted transfers made within the window,
+// limit entries per board.
+func (r *Repo) FindLeaderboard(
+	ctx context.Context,
+	window model.LeaderboardWindow,
+	limit int,
+) (model.Leaderboard, error) {
+	var (
+		board model.Leaderboard
+		err   error
+	)
+
+	since := windowInterval(window)
+
+	board.TopReceivers, err = r.rankTransfers(ctx, "to_user_id", "sum(t.amount)", since, limit)
+	if err != nil {
+		return board, err
+	}
+
+	board.TopSenders, err = r.rankTransfers(ctx, "from_user_id", "sum(t.amount)", since, limit)
+	if err != nil {
+		return board, err
+	}
+
+	board.MostGenerous, err = r.rankTransfers(
+		ctx, "from_user_id", "count(DISTINCT t.to_user_id)", since, limit,
+	)
+
+	return board, err
+}
+
+// windowInterval is how far back the window reaches as an SQL interval, nil
+// for all time. It is counted back from now() in SQL, so that the cut-off
+// follows the same clock as the transfers' created_at.
+func windowInterval(window model.LeaderboardWindow) *string {
+	var interval string
+
+	switch window {
+	case model.LeaderboardWeek:
+		interval = "7 days"
+	case model.LeaderboardMonth:
+		interval = "1 month"
+	default:
+		return nil
+	}
+
+	return &interval
+}
+
+// rankTransfers groups transfers by userColumn and orders the users by score.
+// Both arguments are fixed SQL fragments chosen by FindLeaderboard.
+func (r *Repo) rankTransfers(
+	ctx context.Context,
+	userColumn, score string,
+	since *string,
+	limit int,
+) ([]model.LeaderboardEntry, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT u.username, s.score, s.cnt
+		FROM (
+			SELECT t.`+userColumn+` AS user_id, `+score+` AS score, count(*) AS cnt
+			FROM merch_shop.transfers AS t
+			WHERE t.status = 'accepted' AND ($1::interval IS NULL OR t.created_at >= now() - $1::interval)
+			GROUP BY t.`+userColumn+`
+		) AS s
+		JOIN merch_shop.users AS u ON u.id = s.user_id
+		WHERE NOT u.leaderboard_opt_out
+		ORDER BY s.score DESC, u.username
+		LIMIT $2
+	`, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var entries []model.LeaderboardEntry
+
+	for rows.Next() {
+		var e model.LeaderboardEntry
+		if err := rows.Scan(&e.UserName, &e.Amount, &e.Count); err != nil {
+			return entries, fmt.Errorf("scan row: %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *Repo) FindUserStats(ctx context.Context, userId uuid.UUID) (model.UserStats, error) {
+	q := r.runner(ctx)
+
+	var s model.UserStats
+
+	err := q.QueryRow(ctx, `
+		WITH accepted AS (
+			SELECT from_user_id, to_user_id, amount
+			FROM merch_shop.transfers
+			WHERE status = 'accepted' AND (from_user_id = $1 OR to_user_id = $1)
+		)
+		SELECT u.username, u.leaderboard_opt_out,
+		       COALESCE((SELECT sum(amount) FROM accepted WHERE from_user_id = u.id), 0),
+		       (SELECT count(*) FROM accepted WHERE from_user_id = u.id),
+		       COALESCE((SELECT sum(amount) FROM accepted WHERE to_user_id = u.id), 0),
+		       (SELECT count(*) FROM accepted WHERE to_user_id = u.id),
+		       (SELECT count(*) FROM (
+		           SELECT to_user_id FROM accepted WHERE from_user_id = u.id
+		           UNION
+		           SELECT from_user_id FROM accepted WHERE to_user_id = u.id
+		       ) AS c),
+		       COALESCE((
+		           SELECT o.product_title
+		           FROM merch_shop.orders AS o
+		           WHERE o.user_id = u.id AND o.status NOT IN ('cancelled', 'refunded')
+		           GROUP BY o.product_title
+		           ORDER BY sum(o.quantity) DESC, o.product_title
+		           LIMIT 1
+		       ), '')
+		FROM merch_shop.users AS u
+		WHERE u.id = $1
+	`, userId).Scan(
+		&s.UserName, &s.LeaderboardOptOut, &s.Sent, &s.SentCount,
+		&s.Received, &s.ReceivedCount, &s.Counterparties, &s.FavouriteProduct,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, ErrNotFound
+		}
+
+		return s, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *Repo) SetLeaderboardOptOut(ctx context.Context, userId uuid.UUID, optOut bool) error {
+	q := r.runner(ctx)
+
+	tag, err := q.Exec(ctx, `
+		UPDATE merch_shop.users SET leaderboard_opt_out = $2 WHERE id = $1
+	`, userId, optOut)
+	if err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
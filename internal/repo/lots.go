@@ -0,0 +1,334 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// expireUsersBatch is how many users ExpireCoinLots looks up at a time.
+	expireUsersBatch = 100
+	// upcomingExpirations is how many days of expiring coins /api/info lists.
+	upcomingExpirations = 10
+	// backfillLotsLock is the advisory lock BackfillCoinLots holds.
+	backfillLotsLock = 7_160_016
+)
+
+// moveCoinLots mirrors a balance change in the user's lots: a credit opens
+// a lot, a debit drains the oldest lots first and, with a ref, books what it
+// took from each lot in the ledger. The caller holds lockBalance.
+func (r *Repo) moveCoinLots(ctx context.Context, userId uuid.UUID, delta int64, ref *uuid.UUID) error {
+	q := r.runner(ctx)
+
+	switch {
+	case delta > 0:
+		if _, err := q.Exec(ctx, `
+			INSERT INTO merch_shop.coin_lots (user_id, amount, remaining, expires_at)
+			VALUES ($1, $2, $2, now() + make_interval(secs => $3))
+		`, userId, delta, r.coinTTLSeconds()); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+	case delta < 0:
+		// Each lot gives what is left of the debit after the older lots,
+		// up to its remaining coins.
+		if _, err := q.Exec(ctx, `
+			WITH taken AS (
+				UPDATE merch_shop.coin_lots AS l
+				SET remaining = l.remaining - LEAST(l.remaining, $2 - o.before)
+				FROM (
+					SELECT id, remaining, sum(remaining) OVER (ORDER BY granted_at, id) - remaining AS before
+					FROM merch_shop.coin_lots
+					WHERE user_id = $1 AND remaining > 0
+				) AS o
+				WHERE l.id = o.id AND o.before < $2
+				RETURNING l.id, LEAST(o.remaining, $2 - o.before) AS coins
+			)
+			INSERT INTO merch_shop.coin_ledger (user_id, lot_id, delta, reason, ref_id)
+			SELECT $1, id, -coins, 'spent', $3
+			FROM taken
+			WHERE $3::uuid IS NOT NULL
+		`, userId, -delta, ref); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// coinTTLSeconds is the lifetime of a new lot for make_interval, nil for
+// coins that never expire.
+func (r *Repo) coinTTLSeconds() *float64 {
+	if r.coinTTL <= 0 {
+		return nil
+	}
+
+	secs := r.coinTTL.Seconds()
+
+	return &secs
+}
+
+// spendCoins debits amount for ref, an order or a held transfer, so that
+// refundCoins can later give the coins back.
+func (r *Repo) spendCoins(
+	ctx context.Context,
+	userId uuid.UUID,
+	amount int64,
+	ref uuid.UUID,
+) (model.User, error) {
+	return r.changeBalance(ctx, userId, -amount, &ref)
+}
+
+// refundCoins gives amount spent for ref back to the user. The coins go back
+// to the lots spendCoins took them from and keep their expiry, so coins that
+// expired in the meantime are written off by the next ExpireCoinLots. What
+// the ledger has no lots for, like spending from before lots were booked, is
+// credited as a new lot.
+func (r *Repo) refundCoins(
+	ctx context.Context,
+	userId uuid.UUID,
+	amount int64,
+	ref uuid.UUID,
+) (model.User, error) {
+	cur, err := r.lockBalance(ctx, userId)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	q := r.runner(ctx)
+
+	// Refunds are booked against ref too, so the same coins are never
+	// returned twice.
+	var returned int64
+	if err := q.QueryRow(ctx, `
+		WITH spent AS (
+			SELECT lot_id, -sum(delta) AS coins
+			FROM merch_shop.coin_ledger
+			WHERE ref_id = $2 AND user_id = $1 AND lot_id IS NOT NULL
+			  AND reason IN ('spent', 'refunded')
+			GROUP BY lot_id
+		), returned AS (
+			UPDATE merch_shop.coin_lots AS l
+			SET remaining = l.remaining + s.coins
+			FROM spent AS s
+			WHERE l.id = s.lot_id AND s.coins > 0
+			RETURNING l.id, s.coins
+		), booked AS (
+			INSERT INTO merch_shop.coin_ledger (user_id, lot_id, delta, reason, ref_id)
+			SELECT $1, id, coins, 'refunded', $2
+			FROM returned
+		)
+		SELECT COALESCE(sum(coins), 0) FROM returned
+	`, userId, ref).Scan(&returned); err != nil {
+		return model.User{}, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	returned = min(returned, amount)
+	if err := r.moveCoinLots(ctx, userId, amount-returned, nil); err != nil {
+		return model.User{}, err
+	}
+
+	return r.setBalance(ctx, userId, cur+amount, amount)
+}
+
+// BackfillCoinLots credits the part of each balance no lot accounts for, as
+// left by the time before coins were tracked in lots, as a lot that lasts the
+// coin TTL from now. It returns how many users got one. Every instance runs it
+// at startup; they take turns on an advisory lock, so those after the first
+// find nothing left to credit.
+func (r *Repo) BackfillCoinLots(ctx context.Context) (int64, error) {
+	var n int64
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		n = 0
+		q := r.runner(txCtx)
+
+		if _, err := q.Exec(txCtx, `SELECT pg_advisory_xact_lock($1)`, backfillLotsLock); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		// A statement of its own, so that its snapshot, taken after the
+		// lock, has the lots an instance before this one added.
+		tag, err := q.Exec(txCtx, `
+			INSERT INTO merch_shop.coin_lots (user_id, amount, remaining, expires_at)
+			SELECT u.id, u.balance - l.coins, u.balance - l.coins, now() + make_interval(secs => $1)
+			FROM merch_shop.users AS u
+			CROSS JOIN LATERAL (
+				SELECT COALESCE(sum(remaining), 0) AS coins
+				FROM merch_shop.coin_lots
+				WHERE user_id = u.id
+			) AS l
+			WHERE u.balance > l.coins
+			FOR UPDATE OF u
+		`, r.coinTTLSeconds())
+		if err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		n = tag.RowsAffected()
+
+		return nil
+	}, nil)
+
+	return n, err
+}
+
+// ExpireCoinLots writes off the coins left in lots past their expiry and
+// returns how many lots expired. Every write-off gets a ledger entry and
+// the user is notified.
+func (r *Repo) ExpireCoinLots(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		users, err := r.usersWithExpiredLots(ctx)
+		if err != nil {
+			return total, err
+		}
+
+		for _, userId := range users {
+			n, err := r.expireUserCoins(ctx, userId)
+			if err != nil {
+				return total, err
+			}
+
+			total += n
+		}
+
+		if len(users) < expireUsersBatch {
+			return total, nil
+		}
+	}
+}
+
+func (r *Repo) usersWithExpiredLots(ctx context.Context) ([]uuid.UUID, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT DISTINCT user_id
+		FROM merch_shop.coin_lots
+		WHERE remaining > 0 AND expires_at <= now()
+		LIMIT $1
+	`, expireUsersBatch)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var users []uuid.UUID
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return users, fmt.Errorf("scan row: %w", err)
+		}
+
+		users = append(users, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return users, nil
+}
+
+func (r *Repo) expireUserCoins(ctx context.Context, userId uuid.UUID) (int64, error) {
+	var lots int64
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		lots = 0
+		q := r.runner(txCtx)
+
+		cur, err := r.lockBalance(txCtx, userId)
+		if err != nil {
+			return err
+		}
+
+		// The lots are zeroed and their coins booked in the ledger in one go.
+		var expired int64
+		if err := q.QueryRow(txCtx, `
+			WITH expired AS (
+				UPDATE merch_shop.coin_lots AS l
+				SET remaining = 0, expired_at = now()
+				FROM (
+					SELECT id, remaining
+					FROM merch_shop.coin_lots
+					WHERE user_id = $1 AND remaining > 0 AND expires_at <= now()
+				) AS old
+				WHERE l.id = old.id
+				RETURNING l.id, old.remaining
+			), booked AS (
+				INSERT INTO merch_shop.coin_ledger (user_id, lot_id, delta, reason)
+				SELECT $1, id, -remaining, 'expired'
+				FROM expired
+			)
+			SELECT count(*), COALESCE(sum(remaining), 0) FROM expired
+		`, userId).Scan(&lots, &expired); err != nil {
+			return fmt.Errorf("get query row sql: %w", err)
+		}
+
+		if expired == 0 {
+			return nil
+		}
+
+		newBal := max(cur-expired, 0)
+		if _, err := r.setBalance(txCtx, userId, newBal, newBal-cur); err != nil {
+			return err
+		}
+
+		return r.notify(txCtx, model.Notification{
+			UserID:  userId,
+			Kind:    model.NotificationCoinsExpired,
+			Message: fmt.Sprintf("%d of your coins expired", cur-newBal),
+			Data: map[string]string{
+				"amount": strconv.FormatInt(cur-newBal, 10),
+			},
+		})
+	}, nil)
+
+	return lots, err
+}
+
+// FindCoinExpirations sums the user's coins by the day they expire, soonest
+// first; ExpiresAt is when the first of them goes.
+func (r *Repo) FindCoinExpirations(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.CoinExpiration, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT sum(remaining), min(expires_at)
+		FROM merch_shop.coin_lots
+		WHERE user_id = $1 AND remaining > 0 AND expires_at > now()
+		GROUP BY date_trunc('day', expires_at)
+		ORDER BY 2
+		LIMIT $2
+	`, userId, upcomingExpirations)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var expirations []model.CoinExpiration
+
+	for rows.Next() {
+		var e model.CoinExpiration
+		if err := rows.Scan(&e.Amount, &e.ExpiresAt); err != nil {
+			return expirations, fmt.Errorf("scan row: %w", err)
+		}
+
+		expirations = append(expirations, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return expirations, nil
+}
@@ -0,0 +1,14 @@
+//go:build integration
+
+package repo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Run(m))
+}
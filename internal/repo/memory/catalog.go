@@ -0,0 +1,579 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+type product struct {
+	model.Product
+}
+
+type wishKey struct {
+	userId, productId uuid.UUID
+}
+
+// seedCatalog adds the products and variants the migrations insert.
+func (r *Repo) seedCatalog() {
+	for _, p := range []struct {
+		title string
+		price int64
+	}{
+		{"t-shirt", 80}, {"cup", 20}, {"book", 50}, {"pen", 10}, {"powerbank", 200},
+		{"hoody", 300}, {"umbrella", 200}, {"socks", 10}, {"wallet", 50}, {"pink-hoody", 500},
+	} {
+		id := uuid.New()
+		r.products[id] = &product{Product: model.Product{ID: id, Title: p.title, Price: p.price}}
+
+		if p.title != "t-shirt" && p.title != "hoody" && p.title != "pink-hoody" {
+			continue
+		}
+
+		for _, size := range []string{"S", "M", "L", "XL"} {
+			v := &model.ProductVariant{
+				ID:         uuid.New(),
+				ProductID:  id,
+				SKU:        p.title + "-" + strings.ToLower(size),
+				Attributes: map[string]string{"size": size},
+				Default:    size == "M",
+			}
+			r.variants[v.ID] = v
+		}
+	}
+}
+
+// productView is the product with Available worked out.
+func (r *Repo) productView(p *product) model.Product {
+	v := p.Product
+	v.Available = p.Stock == nil || *p.Stock > 0
+
+	if variants := r.productVariants(p.ID); len(variants) > 0 {
+		v.Available = slices.ContainsFunc(variants, func(v model.ProductVariant) bool {
+			return v.InStock()
+		})
+	}
+
+	if p.Stock != nil {
+		stock := *p.Stock
+		v.Stock = &stock
+	}
+
+	return v
+}
+
+func (r *Repo) productByTitle(title string) (*product, error) {
+	for _, p := range r.products {
+		if strings.EqualFold(p.Title, title) {
+			return p, nil
+		}
+	}
+
+	return nil, repo.ErrNotFound
+}
+
+func (r *Repo) FindProductByTitle(ctx context.Context, title string) (model.Product, error) {
+	var found model.Product
+
+	err := r.tx(ctx, func() error {
+		p, err := r.productByTitle(title)
+		if err != nil {
+			return err
+		}
+
+		found = r.productView(p)
+
+		return nil
+	})
+
+	return found, err
+}
+
+func (r *Repo) FindProductByID(ctx context.Context, id uuid.UUID) (model.Product, error) {
+	var found model.Product
+
+	err := r.tx(ctx, func() error {
+		p, ok := r.products[id]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		found = r.productView(p)
+
+		return nil
+	})
+
+	return found, err
+}
+
+// FindProducts lists the catalog; Query matches titles by substring only,
+// there is no trigram similarity here.
+func (r *Repo) FindProducts(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	var products []model.Product
+
+	err := r.tx(ctx, func() error {
+		query := strings.ToLower(filter.Query)
+
+		for _, p := range r.products {
+			switch {
+			case !strings.Contains(strings.ToLower(p.Title), query),
+				filter.MinPrice != nil && p.Price < *filter.MinPrice,
+				filter.MaxPrice != nil && p.Price > *filter.MaxPrice:
+				continue
+			}
+
+			products = append(products, r.productView(p))
+		}
+
+		slices.SortFunc(products, productOrder(filter.Sort))
+		products = page(products, filter.Limit, filter.Offset)
+
+		return nil
+	})
+
+	return products, err
+}
+
+func productOrder(sort model.ProductSort) func(a, b model.Product) int {
+	byTitle := func(a, b model.Product) int {
+		return strings.Compare(a.Title, b.Title)
+	}
+
+	switch sort {
+	case model.ProductSortNameDesc:
+		return func(a, b model.Product) int { return byTitle(b, a) }
+	case model.ProductSortPrice:
+		return func(a, b model.Product) int {
+			if a.Price != b.Price {
+				return int(a.Price - b.Price)
+			}
+
+			return byTitle(a, b)
+		}
+	case model.ProductSortPriceDesc:
+		return func(a, b model.Product) int {
+			if a.Price != b.Price {
+				return int(b.Price - a.Price)
+			}
+
+			return byTitle(a, b)
+		}
+	default:
+		return byTitle
+	}
+}
+
+func (r *Repo) AddToStock(ctx context.Context, productId uuid.UUID, delta int64) error {
+	return r.tx(ctx, func() error {
+		return r.addToStock(productId, delta)
+	})
+}
+
+func (r *Repo) addToStock(productId uuid.UUID, delta int64) error {
+	p, ok := r.products[productId]
+	if !ok || p.Stock != nil && *p.Stock+delta < 0 {
+		return fmt.Errorf("add to stock: %w", repo.ErrOutOfStock)
+	}
+
+	if p.Stock == nil {
+		return nil
+	}
+
+	before := *p.Stock
+	stock := before + delta
+
+	save(r, p)
+	p.Stock = &stock
+
+	if before <= 0 && stock > 0 {
+		r.notifyWishlisters(p, model.NotificationBackInStock, "%s is back in stock", nil)
+	}
+
+	return nil
+}
+
+// SetStock makes a product stock-tracked with stock items left, or not
+// tracked when stock is nil. It stands in for editing the catalog in SQL.
+func (r *Repo) SetStock(ctx context.Context, productId uuid.UUID, stock *int64) error {
+	return r.tx(ctx, func() error {
+		p, ok := r.products[productId]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		save(r, p)
+		p.Stock = stock
+
+		return nil
+	})
+}
+
+// SetVariantPrice sets the price a variant sells at, or falls back to the
+// product price when price is nil. It stands in for editing the catalog in SQL.
+func (r *Repo) SetVariantPrice(ctx context.Context, variantId uuid.UUID, price *int64) error {
+	return r.tx(ctx, func() error {
+		v, ok := r.variants[variantId]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		save(r, v)
+		v.Price = price
+
+		return nil
+	})
+}
+
+func (r *Repo) FindVariantsByProductID(
+	ctx context.Context,
+	productId uuid.UUID,
+) ([]model.ProductVariant, error) {
+	var variants []model.ProductVariant
+
+	err := r.tx(ctx, func() error {
+		variants = r.productVariants(productId)
+
+		return nil
+	})
+
+	return variants, err
+}
+
+func (r *Repo) productVariants(productId uuid.UUID) []model.ProductVariant {
+	var variants []model.ProductVariant
+
+	for _, v := range r.variants {
+		if v.ProductID == productId {
+			variants = append(variants, *v)
+		}
+	}
+
+	slices.SortFunc(variants, func(a, b model.ProductVariant) int {
+		return strings.Compare(a.SKU, b.SKU)
+	})
+
+	return variants
+}
+
+func (r *Repo) AddToVariantStock(ctx context.Context, variantId uuid.UUID, delta int64) error {
+	return r.tx(ctx, func() error {
+		return r.addToVariantStock(variantId, delta)
+	})
+}
+
+func (r *Repo) addToVariantStock(variantId uuid.UUID, delta int64) error {
+	v, ok := r.variants[variantId]
+	if !ok || v.Stock != nil && *v.Stock+delta < 0 {
+		return fmt.Errorf("add to variant stock: %w", repo.ErrOutOfStock)
+	}
+
+	if v.Stock == nil {
+		return nil
+	}
+
+	before := *v.Stock
+	stock := before + delta
+
+	save(r, v)
+	v.Stock = &stock
+
+	if before <= 0 && stock > 0 {
+		r.notifyWishlisters(
+			r.products[v.ProductID], model.NotificationBackInStock, "%s is back in stock", nil,
+		)
+	}
+
+	return nil
+}
+
+// SetProductPrice changes the list price; lowering it notifies everyone who
+// wishlisted the product.
+func (r *Repo) SetProductPrice(ctx context.Context, productId uuid.UUID, price int64) error {
+	return r.tx(ctx, func() error {
+		return r.setProductPrice(productId, price)
+	})
+}
+
+func (r *Repo) setProductPrice(productId uuid.UUID, price int64) error {
+	p, ok := r.products[productId]
+	if !ok {
+		return repo.ErrNotFound
+	}
+
+	before := p.Price
+
+	save(r, p)
+	p.Price = price
+
+	if price < before {
+		r.notifyPriceDrop(p, price, before)
+	}
+
+	return nil
+}
+
+// UpdateProduct applies an admin price change and restock at once.
+func (r *Repo) UpdateProduct(
+	ctx context.Context,
+	productId uuid.UUID,
+	update model.ProductUpdate,
+) (model.Product, error) {
+	var updated model.Product
+
+	err := r.tx(ctx, func() error {
+		if update.Price != nil {
+			if err := r.setProductPrice(productId, *update.Price); err != nil {
+				return err
+			}
+		}
+
+		if update.Restock != 0 {
+			var err error
+			if update.VariantID != nil {
+				err = r.addToVariantStock(*update.VariantID, update.Restock)
+			} else {
+				err = r.addToStock(productId, update.Restock)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		p, ok := r.products[productId]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		updated = r.productView(p)
+
+		return nil
+	})
+
+	return updated, err
+}
+
+// FindWishlist lists the user's wishlist, newest first, with each product's
+// current price including promotions that cover all its variants.
+func (r *Repo) FindWishlist(ctx context.Context, userId uuid.UUID) ([]model.WishlistItem, error) {
+	var items []model.WishlistItem
+
+	err := r.tx(ctx, func() error {
+		now := r.now()
+
+		for key, addedAt := range r.wishlist {
+			if key.userId != userId {
+				continue
+			}
+
+			p := r.products[key.productId]
+
+			items = append(items, model.WishlistItem{
+				Product: r.productView(p),
+				Price:   r.wishlistPrice(p, now),
+				AddedAt: addedAt,
+			})
+		}
+
+		slices.SortFunc(items, func(a, b model.WishlistItem) int {
+			if c := b.AddedAt.Compare(a.AddedAt); c != 0 {
+				return c
+			}
+
+			return strings.Compare(a.Product.Title, b.Product.Title)
+		})
+
+		return nil
+	})
+
+	return items, err
+}
+
+// wishlistPrice is the product price less the promotions running at now
+// that cover all its variants.
+func (r *Repo) wishlistPrice(p *product, now time.Time) int64 {
+	price := p.Price
+
+	for _, pr := range r.promotions {
+		if pr.ProductID == p.ID && pr.VariantID == nil && pr.running(now) {
+			price = min(price, pr.Price)
+		}
+	}
+
+	return price
+}
+
+// AddToWishlist is a no-op when the product is already on the wishlist.
+func (r *Repo) AddToWishlist(ctx context.Context, userId, productId uuid.UUID) error {
+	return r.tx(ctx, func() error {
+		if _, ok := r.users[userId]; !ok {
+			return repo.ErrNotFound
+		}
+
+		if _, ok := r.products[productId]; !ok {
+			return repo.ErrNotFound
+		}
+
+		key := wishKey{userId, productId}
+		if _, ok := r.wishlist[key]; ok {
+			return nil
+		}
+
+		r.wishlist[key] = r.now()
+		r.onRollback(func() { delete(r.wishlist, key) })
+
+		return nil
+	})
+}
+
+func (r *Repo) RemoveFromWishlist(ctx context.Context, userId, productId uuid.UUID) error {
+	return r.tx(ctx, func() error {
+		key := wishKey{userId, productId}
+
+		addedAt, ok := r.wishlist[key]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		delete(r.wishlist, key)
+		r.onRollback(func() { r.wishlist[key] = addedAt })
+
+		return nil
+	})
+}
+
+type promotion struct {
+	model.Promotion
+}
+
+func (p *promotion) running(now time.Time) bool {
+	return !p.StartsAt.After(now) && now.Before(p.EndsAt)
+}
+
+// CreatePromotion is repo's CreatePromotion: a running promotion for the
+// whole product that undercuts its wishlist price notifies the wishlisters.
+func (r *Repo) CreatePromotion(ctx context.Context, p model.Promotion) (model.Promotion, error) {
+	err := r.tx(ctx, func() error {
+		product, ok := r.products[p.ProductID]
+		if !ok {
+			return fmt.Errorf("create promotion: %w", repo.ErrNotFound)
+		}
+
+		now := r.now()
+		before := r.wishlistPrice(product, now)
+
+		p.ID = uuid.New()
+		p.CreatedAt = now
+
+		save(r, &r.promotions)
+		pr := &promotion{Promotion: p}
+		r.promotions = append(r.promotions, pr)
+
+		if p.VariantID == nil && pr.running(now) && p.Price < before {
+			r.notifyPriceDrop(product, p.Price, before)
+		}
+
+		return nil
+	})
+
+	return p, err
+}
+
+// promotionPrice returns the price of the promotion running right now for the
+// product or variant, preferring one set for the exact variant.
+func (r *Repo) promotionPrice(productId uuid.UUID, variantId *uuid.UUID) (int64, bool) {
+	var best *promotion
+
+	now := r.now()
+
+	for _, p := range r.promotions {
+		if p.ProductID != productId || !p.running(now) {
+			continue
+		}
+
+		exact := p.VariantID != nil && variantId != nil && *p.VariantID == *variantId
+		if p.VariantID != nil && !exact {
+			continue
+		}
+
+		switch {
+		case best == nil,
+			exact && best.VariantID == nil,
+			(p.VariantID == nil) == (best.VariantID == nil) && p.Price < best.Price:
+			best = p
+		}
+	}
+
+	if best == nil {
+		return 0, false
+	}
+
+	return best.Price, true
+}
+
+func (r *Repo) CreatePromoCode(ctx context.Context, c model.PromoCode) (model.PromoCode, error) {
+	c.Code = strings.ToUpper(c.Code)
+
+	err := r.tx(ctx, func() error {
+		if _, ok := r.promoCodes[c.Code]; ok {
+			return repo.ErrPromoCodeExists
+		}
+
+		c.UsedCount = 0
+		c.CreatedAt = r.now()
+
+		code := c
+		r.promoCodes[c.Code] = &code
+		r.onRollback(func() { delete(r.promoCodes, code.Code) })
+
+		return nil
+	})
+
+	return c, err
+}
+
+// usePromoCode checks expiry and both usage caps for the user and counts
+// one more use.
+func (r *Repo) usePromoCode(code string, userId uuid.UUID) (model.PromoCode, error) {
+	c, ok := r.promoCodes[strings.ToUpper(code)]
+
+	switch {
+	case !ok, c.ExpiresAt != nil && !c.ExpiresAt.After(r.now()):
+		return model.PromoCode{}, repo.ErrPromoCodeInvalid
+	case c.MaxUses != nil && c.UsedCount >= *c.MaxUses:
+		return *c, repo.ErrPromoCodeExhausted
+	}
+
+	if c.PerUserLimit != nil {
+		var used int64
+
+		for _, o := range r.orders {
+			if o.PromoCode == c.Code && o.UserID == userId && !o.Status.Returned() {
+				used++
+			}
+		}
+
+		if used >= *c.PerUserLimit {
+			return *c, repo.ErrPromoCodeUserLimit
+		}
+	}
+
+	save(r, c)
+	c.UsedCount++
+
+	return *c, nil
+}
+
+// releasePromoCode gives back the use taken by an order that was returned.
+func (r *Repo) releasePromoCode(code string) {
+	if c, ok := r.promoCodes[code]; ok && c.UsedCount > 0 {
+		save(r, c)
+		c.UsedCount--
+	}
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+func (r *Repo) FindUserInfo(
+	ctx context.Context,
+	userId uuid.UUID,
+	limit int,
+) (model.UserInfo, error) {
+	var info model.UserInfo
+
+	err := r.tx(ctx, func() error {
+		u, err := r.user(userId)
+		if err != nil {
+			return err
+		}
+
+		orders := r.ordersOf(userId)
+
+		info = model.UserInfo{
+			Balance:     u.Balance,
+			Inventory:   inventory(orders),
+			Orders:      page(orders, limit, 0),
+			Sent:        page(r.sentBy(userId), limit, 0),
+			Received:    page(r.receivedBy(userId), limit, 0),
+			Expirations: r.expirationsOf(u),
+		}
+
+		return nil
+	})
+
+	return info, err
+}
+
+// inventory sums the orders that were not returned by product and variant.
+func inventory(orders []model.Order) []model.InventoryItem {
+	var items []model.InventoryItem
+
+	for _, o := range orders {
+		if o.Status.Returned() {
+			continue
+		}
+
+		i := slices.IndexFunc(items, func(item model.InventoryItem) bool {
+			return item.ProductTitle == o.ProductTitle && item.VariantSKU == o.VariantSKU
+		})
+		if i < 0 {
+			i = len(items)
+			items = append(items, model.InventoryItem{ProductTitle: o.ProductTitle, VariantSKU: o.VariantSKU})
+		}
+
+		items[i].Count += int64(o.Count)
+		if o.CreatedAt.After(items[i].AcquiredAt) {
+			items[i].AcquiredAt = o.CreatedAt
+		}
+	}
+
+	slices.SortFunc(items, func(a, b model.InventoryItem) int {
+		return cmp.Or(cmp.Compare(a.ProductTitle, b.ProductTitle), cmp.Compare(a.VariantSKU, b.VariantSKU))
+	})
+
+	return items
+}
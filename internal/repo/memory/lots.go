@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+// upcomingExpirations is how many days of expiring coins FindCoinExpirations lists.
+const upcomingExpirations = 10
+
+type lot struct {
+	remaining int64
+	grantedAt time.Time
+	// expiresAt is nil for coins that never expire.
+	expiresAt *time.Time
+}
+
+// sameLot reports whether a and b are parts of one credit.
+func sameLot(a, b lot) bool {
+	return a.grantedAt.Equal(b.grantedAt) &&
+		(a.expiresAt == nil) == (b.expiresAt == nil) &&
+		(a.expiresAt == nil || a.expiresAt.Equal(*b.expiresAt))
+}
+
+// moveCoinLots is repo's moveCoinLots: a credit opens a lot, a debit drains
+// the oldest lots first and returns what it took from each. It must follow a
+// save of u.
+func (r *Repo) moveCoinLots(u *user, delta int64) []lot {
+	switch {
+	case delta > 0:
+		l := lot{remaining: delta, grantedAt: r.now()}
+		if r.coinTTL > 0 {
+			expiresAt := l.grantedAt.Add(r.coinTTL)
+			l.expiresAt = &expiresAt
+		}
+
+		u.lots = append(slices.Clip(u.lots), l)
+	case delta < 0:
+		lots := make([]lot, 0, len(u.lots))
+		debit := -delta
+
+		var taken []lot
+
+		for _, l := range u.lots {
+			take := min(l.remaining, debit)
+			debit -= take
+			l.remaining -= take
+
+			if take > 0 {
+				taken = append(taken, lot{remaining: take, grantedAt: l.grantedAt, expiresAt: l.expiresAt})
+			}
+
+			if l.remaining > 0 {
+				lots = append(lots, l)
+			}
+		}
+
+		u.lots = lots
+
+		return taken
+	}
+
+	return nil
+}
+
+// spendCoins is addToBalance for a debit that refundCoins may give back; it
+// returns what it took from each lot.
+func (r *Repo) spendCoins(userId uuid.UUID, amount int64) (model.User, []lot, error) {
+	return r.changeBalance(userId, -amount)
+}
+
+// refundCoins is repo's refundCoins: amount goes back into the lots spent
+// came from, which keep their expiry, and what spent does not cover opens a
+// new lot.
+func (r *Repo) refundCoins(userId uuid.UUID, amount int64, spent []lot) (model.User, error) {
+	u, err := r.user(userId)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	save(r, u)
+
+	lots := slices.Clone(u.lots)
+	rest := amount
+
+	for _, s := range spent {
+		s.remaining = min(s.remaining, rest)
+		if s.remaining == 0 {
+			break
+		}
+
+		rest -= s.remaining
+
+		if i := slices.IndexFunc(lots, func(l lot) bool { return sameLot(l, s) }); i >= 0 {
+			lots[i].remaining += s.remaining
+
+			continue
+		}
+
+		i, _ := slices.BinarySearchFunc(lots, s, func(l, s lot) int {
+			return cmp.Or(l.grantedAt.Compare(s.grantedAt), -1)
+		})
+		lots = slices.Insert(lots, i, s)
+	}
+
+	u.lots = lots
+	r.moveCoinLots(u, rest)
+	r.setBalance(u, u.Balance+amount, amount)
+
+	return u.User, nil
+}
+
+// ExpireCoinLots writes off the coins left in lots past their expiry and
+// returns how many lots expired.
+func (r *Repo) ExpireCoinLots(ctx context.Context) (int64, error) {
+	var total int64
+
+	err := r.tx(ctx, func() error {
+		total = 0
+		now := r.now()
+
+		for _, u := range r.users {
+			var expired, n int64
+
+			lots := make([]lot, 0, len(u.lots))
+
+			for _, l := range u.lots {
+				if l.expiresAt != nil && !l.expiresAt.After(now) {
+					expired += l.remaining
+					n++
+
+					continue
+				}
+
+				lots = append(lots, l)
+			}
+
+			if n == 0 {
+				continue
+			}
+
+			save(r, u)
+			u.lots = lots
+			total += n
+
+			newBal := max(u.Balance-expired, 0)
+			lost := u.Balance - newBal
+			r.setBalance(u, newBal, -lost)
+			r.notify(model.Notification{
+				UserID:  u.ID,
+				Kind:    model.NotificationCoinsExpired,
+				Message: fmt.Sprintf("%d of your coins expired", lost),
+				Data: map[string]string{
+					"amount": strconv.FormatInt(lost, 10),
+				},
+			})
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// FindCoinExpirations sums the user's coins by the day they expire, soonest first.
+func (r *Repo) FindCoinExpirations(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.CoinExpiration, error) {
+	var expirations []model.CoinExpiration
+
+	err := r.tx(ctx, func() error {
+		if u, ok := r.users[userId]; ok {
+			expirations = r.expirationsOf(u)
+		}
+
+		return nil
+	})
+
+	return expirations, err
+}
+
+func (r *Repo) expirationsOf(u *user) []model.CoinExpiration {
+	now := r.now()
+	byDay := map[time.Time]*model.CoinExpiration{}
+
+	for _, l := range u.lots {
+		if l.expiresAt == nil || !l.expiresAt.After(now) {
+			continue
+		}
+
+		day := l.expiresAt.Truncate(24 * time.Hour) //nolint:mnd
+		if e, ok := byDay[day]; ok {
+			e.Amount += l.remaining
+			if l.expiresAt.Before(e.ExpiresAt) {
+				e.ExpiresAt = *l.expiresAt
+			}
+
+			continue
+		}
+
+		byDay[day] = &model.CoinExpiration{Amount: l.remaining, ExpiresAt: *l.expiresAt}
+	}
+
+	var expirations []model.CoinExpiration
+	for _, e := range byDay {
+		expirations = append(expirations, *e)
+	}
+
+	slices.SortFunc(expirations, func(a, b model.CoinExpiration) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+
+	return page(expirations, upcomingExpirations, 0)
+}
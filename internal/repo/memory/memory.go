@@ -0,0 +1,172 @@
+// Package memory is a repo.MerchRepo that keeps everything in process
+// memory, for running the API without Postgres (DATABASE_URL=memory://) and
+// for tests. It starts with the catalog the migrations seed.
+//
+// Every method runs as one transaction under a single mutex: changes are
+// logged with undo steps and rolled back if the method fails, and events
+// reach the sink only once the method succeeded.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+var _ repo.MerchRepo = (*Repo)(nil)
+
+type Repo struct {
+	now           func() time.Time
+	transferRules []repo.TransferRule
+	coinTTL       time.Duration
+	sink          func(model.Event)
+
+	mu sync.Mutex
+	// undo holds the steps that revert the running transaction, oldest first.
+	undo []func()
+	// published holds the events of the running transaction.
+	published []model.Event
+	seq       int64
+
+	users         map[uuid.UUID]*user
+	usernames     map[string]uuid.UUID
+	products      map[uuid.UUID]*product
+	variants      map[uuid.UUID]*model.ProductVariant
+	promotions    []*promotion
+	promoCodes    map[string]*model.PromoCode
+	wishlist      map[wishKey]time.Time
+	orders        []*order
+	transfers     []*transfer
+	schedules     []*schedule
+	notifications []*notification
+	events        []model.Event
+}
+
+type Option func(*Repo)
+
+// WithTransferRules is repo.WithTransferRules.
+func WithTransferRules(rules ...repo.TransferRule) Option {
+	return func(r *Repo) {
+		r.transferRules = append(r.transferRules, rules...)
+	}
+}
+
+// WithCoinTTL is repo.WithCoinTTL.
+func WithCoinTTL(ttl time.Duration) Option {
+	return func(r *Repo) {
+		r.coinTTL = ttl
+	}
+}
+
+// WithEventSink hands every committed event to sink, the way Postgres
+// announces them to events.Broker. sink is called with the repo locked.
+func WithEventSink(sink func(model.Event)) Option {
+	return func(r *Repo) {
+		r.sink = sink
+	}
+}
+
+// WithClock replaces time.Now, e.g. to make coins or transfers expire in tests.
+func WithClock(now func() time.Time) Option {
+	return func(r *Repo) {
+		r.now = now
+	}
+}
+
+func New(opts ...Option) *Repo {
+	r := &Repo{
+		now:        time.Now,
+		users:      make(map[uuid.UUID]*user),
+		usernames:  make(map[string]uuid.UUID),
+		products:   make(map[uuid.UUID]*product),
+		variants:   make(map[uuid.UUID]*model.ProductVariant),
+		promoCodes: make(map[string]*model.PromoCode),
+		wishlist:   make(map[wishKey]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.seedCatalog()
+
+	return r
+}
+
+// tx runs fn as a transaction: if fn fails, everything it changed is undone.
+func (r *Repo) tx(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.undo, r.published = r.undo[:0], r.published[:0]
+
+	if err := fn(); err != nil {
+		r.rollbackTo(0)
+
+		return err
+	}
+
+	if r.sink != nil {
+		for _, e := range r.published {
+			r.sink(e)
+		}
+	}
+
+	return nil
+}
+
+// savepoint runs fn and undoes only what fn changed if it fails.
+func (r *Repo) savepoint(fn func() error) error {
+	mark, events := len(r.undo), len(r.published)
+
+	if err := fn(); err != nil {
+		r.rollbackTo(mark)
+		r.published = r.published[:events]
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repo) rollbackTo(mark int) {
+	for i := len(r.undo) - 1; i >= mark; i-- {
+		r.undo[i]()
+	}
+
+	r.undo = r.undo[:mark]
+}
+
+// onRollback adds an undo step to the running transaction.
+func (r *Repo) onRollback(step func()) {
+	r.undo = append(r.undo, step)
+}
+
+// save makes the running transaction restore *p if it is rolled back.
+func save[T any](r *Repo, p *T) {
+	old := *p
+	r.onRollback(func() { *p = old })
+}
+
+func (r *Repo) nextSeq() int64 {
+	save(r, &r.seq)
+	r.seq++
+
+	return r.seq
+}
+
+// page applies LIMIT and OFFSET the way Postgres does.
+func page[T any](items []T, limit, offset int) []T {
+	offset = min(max(offset, 0), len(items))
+	items = items[offset:]
+
+	return items[:min(max(limit, 0), len(items))]
+}
@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/6ermvH/MerchShop/internal/repo/repotest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	repotest.Run(t, func(*testing.T) repotest.Harness {
+		r := New()
+
+		return repotest.Harness{
+			Repo: r,
+			SetStock: func(tb testing.TB, productId uuid.UUID, stock int64) {
+				tb.Helper()
+
+				if err := r.SetStock(context.Background(), productId, &stock); err != nil {
+					tb.Fatal(err)
+				}
+			},
+			SetVariantPrice: func(tb testing.TB, variantId uuid.UUID, price int64) {
+				tb.Helper()
+
+				if err := r.SetVariantPrice(context.Background(), variantId, &price); err != nil {
+					tb.Fatal(err)
+				}
+			},
+		}
+	})
+}
+
+func TestFailedPurchaseIsUndone(t *testing.T) {
+	t.Parallel()
+
+	var published []model.Event
+
+	r := New(WithEventSink(func(e model.Event) { published = append(published, e) }))
+	ctx := context.Background()
+
+	u, err := r.CreateUser(ctx, "alice", "x")
+	require.NoError(t, err)
+
+	_, err = r.AdjustBalance(ctx, u.ID, 30, "")
+	require.NoError(t, err)
+
+	cup, err := r.FindProductByTitle(ctx, "cup")
+	require.NoError(t, err)
+	require.NoError(t, r.SetStock(ctx, cup.ID, new(int64)))
+
+	// The buyer is charged before the stock runs out.
+	_, err = r.BuyProduct(ctx, u.ID, model.Purchase{Product: "cup"})
+	require.ErrorIs(t, err, repo.ErrOutOfStock)
+
+	u, err = r.FindUserByID(ctx, u.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 30, u.Balance)
+
+	events, err := r.FindEventsSince(ctx, u.ID, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, published, events)
+	require.Len(t, events, 1)
+
+	expirations, err := r.FindCoinExpirations(ctx, u.ID)
+	require.NoError(t, err)
+	require.Empty(t, expirations)
+}
+
+func TestExpireCoinLots(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	r := New(WithCoinTTL(time.Hour), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	u, err := r.CreateUser(ctx, "alice", "x")
+	require.NoError(t, err)
+
+	_, err = r.AdjustBalance(ctx, u.ID, 100, "")
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+
+	_, err = r.AdjustBalance(ctx, u.ID, 50, "bonus")
+	require.NoError(t, err)
+
+	_, err = r.AddToBalance(ctx, u.ID, -30)
+	require.NoError(t, err)
+
+	// The oldest lot, 100 coins less the 30 spent, expires.
+	now = now.Add(45 * time.Minute)
+
+	n, err := r.ExpireCoinLots(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	u, err = r.FindUserByID(ctx, u.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 50, u.Balance)
+
+	expirations, err := r.FindCoinExpirations(ctx, u.ID)
+	require.NoError(t, err)
+	require.Len(t, expirations, 1)
+	require.EqualValues(t, 50, expirations[0].Amount)
+}
+
+func TestRefundKeepsCoinExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	r := New(WithCoinTTL(time.Hour), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	u, err := r.CreateUser(ctx, "alice", "x")
+	require.NoError(t, err)
+	bob, err := r.CreateUser(ctx, "bob", "x")
+	require.NoError(t, err)
+
+	_, err = r.AdjustBalance(ctx, u.ID, 100, "")
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+
+	_, err = r.AdjustBalance(ctx, u.ID, 50, "bonus")
+	require.NoError(t, err)
+
+	// Both take coins from the oldest lot, and get them back there.
+	order, err := r.BuyProduct(ctx, u.ID, model.Purchase{Product: "cup"})
+	require.NoError(t, err)
+	transfer, err := r.SendPendingCoins(ctx, u.ID, bob.ID, 10, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+
+	_, err = r.CancelOrder(ctx, u.ID, order.ID, time.Hour)
+	require.NoError(t, err)
+	_, err = r.DeclineTransfer(ctx, bob.ID, transfer.ID)
+	require.NoError(t, err)
+
+	now = now.Add(45 * time.Minute)
+
+	n, err := r.ExpireCoinLots(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	u, err = r.FindUserByID(ctx, u.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 50, u.Balance)
+}
+
+// brokenRule fails with an error no run status stands for, as a rule that
+// looks something up elsewhere might.
+type brokenRule struct {
+	from uuid.UUID
+}
+
+func (b *brokenRule) Check(_ context.Context, _ repo.TransferHistory, t repo.TransferAttempt) error {
+	if t.From.ID == b.from {
+		return errors.New("rule backend unavailable")
+	}
+
+	return nil
+}
+
+func TestScheduledTransferErrorDoesNotStallOthers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	rule := &brokenRule{}
+	r := New(WithTransferRules(rule), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	var ids [3]uuid.UUID
+
+	for i := range ids {
+		u, err := r.CreateUser(ctx, fmt.Sprint("user", i), "x")
+		require.NoError(t, err)
+
+		_, err = r.AdjustBalance(ctx, u.ID, 100, "")
+		require.NoError(t, err)
+
+		ids[i] = u.ID
+	}
+
+	rule.from = ids[0]
+	due := now.Add(-time.Minute)
+
+	// The broken schedule is due first.
+	for _, from := range ids[:2] {
+		_, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+			FromUserID: from, ToUserID: ids[2], Amount: 10, NextRunAt: &due,
+		})
+		require.NoError(t, err)
+
+		due = due.Add(time.Second)
+	}
+
+	n, err := r.RunDueScheduledTransfers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	broken, err := r.FindScheduledTransfers(ctx, ids[0])
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduleActive, broken[0].Status)
+	require.Nil(t, broken[0].LastRun)
+	require.Equal(t, now.Add(repo.ScheduleRetryAfter), *broken[0].NextRunAt)
+
+	for range repo.ScheduleMaxAttempts - 1 {
+		now = now.Add(repo.ScheduleRetryAfter)
+
+		_, err = r.RunDueScheduledTransfers(ctx)
+		require.NoError(t, err)
+	}
+
+	broken, err = r.FindScheduledTransfers(ctx, ids[0])
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduleCompleted, broken[0].Status)
+	require.Equal(t, model.ScheduledRunFailed, broken[0].LastRun.Status)
+	require.Contains(t, broken[0].LastRun.Error, "rule backend unavailable")
+}
+
+func BenchmarkFindUserInfo(b *testing.B) {
+	r := New()
+	ctx := context.Background()
+
+	var users [2]uuid.UUID
+
+	for i := range users {
+		u, err := r.CreateUser(ctx, uuid.NewString(), "x")
+		require.NoError(b, err)
+
+		_, err = r.AdjustBalance(ctx, u.ID, 1_000_000, "bench")
+		require.NoError(b, err)
+
+		users[i] = u.ID
+	}
+
+	for i := range 10_000 {
+		require.NoError(b, r.SendCoins(ctx, users[i%2], users[1-i%2], 1, model.TransferNote{}))
+
+		_, err := r.BuyProduct(ctx, users[0], model.Purchase{Product: "pen"})
+		require.NoError(b, err)
+	}
+
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := r.FindUserInfo(ctx, users[0], 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+type notification struct {
+	model.Notification
+}
+
+// notify stores n for n.UserID unless the user muted n.Kind.
+func (r *Repo) notify(n model.Notification) {
+	if u, ok := r.users[n.UserID]; ok && slices.Contains(u.muted, n.Kind) {
+		return
+	}
+
+	if n.Data == nil {
+		n.Data = map[string]string{}
+	}
+
+	n.ID = uuid.New()
+	n.CreatedAt = r.now()
+
+	save(r, &r.notifications)
+	r.notifications = append(r.notifications, &notification{Notification: n})
+}
+
+// notifyWishlisters is repo's notifyWishlisters; message is a fmt pattern
+// taking the product title.
+func (r *Repo) notifyWishlisters(
+	p *product,
+	kind model.NotificationKind,
+	message string,
+	data map[string]string,
+) {
+	for key := range r.wishlist {
+		if key.productId != p.ID {
+			continue
+		}
+
+		d := maps.Clone(data)
+		if d == nil {
+			d = map[string]string{}
+		}
+
+		d["productId"] = p.ID.String()
+		d["product"] = p.Title
+
+		r.notify(model.Notification{
+			UserID:  key.userId,
+			Kind:    kind,
+			Message: fmt.Sprintf(message, p.Title),
+			Data:    d,
+		})
+	}
+}
+
+// notifyPriceDrop is repo's notifyPriceDrop.
+func (r *Repo) notifyPriceDrop(p *product, price, before int64) {
+	r.notifyWishlisters(
+		p,
+		model.NotificationPriceDrop,
+		fmt.Sprintf("%%s is now %d coins, was %d", price, before),
+		map[string]string{
+			"price":    strconv.FormatInt(price, 10),
+			"oldPrice": strconv.FormatInt(before, 10),
+		},
+	)
+}
+
+// userNotifications returns the user's notifications, newest first.
+func (r *Repo) userNotifications(userId uuid.UUID, unreadOnly bool) []*notification {
+	var found []*notification
+
+	for i := len(r.notifications) - 1; i >= 0; i-- {
+		n := r.notifications[i]
+		if n.UserID == userId && (!unreadOnly || n.ReadAt == nil) {
+			found = append(found, n)
+		}
+	}
+
+	return found
+}
+
+func (r *Repo) FindNotifications(
+	ctx context.Context,
+	userId uuid.UUID,
+	filter model.NotificationFilter,
+) ([]model.Notification, error) {
+	var notifications []model.Notification
+
+	err := r.tx(ctx, func() error {
+		found := r.userNotifications(userId, filter.UnreadOnly)
+		for _, n := range page(found, filter.Limit, filter.Offset) {
+			c := n.Notification
+			c.Data = maps.Clone(n.Data)
+			notifications = append(notifications, c)
+		}
+
+		return nil
+	})
+
+	return notifications, err
+}
+
+func (r *Repo) CountUnreadNotifications(ctx context.Context, userId uuid.UUID) (int64, error) {
+	var count int64
+
+	err := r.tx(ctx, func() error {
+		count = int64(len(r.userNotifications(userId, true)))
+
+		return nil
+	})
+
+	return count, err
+}
+
+// MarkNotificationsRead marks the given notifications of the user as read, or
+// all of them when ids is empty, and returns how many changed.
+func (r *Repo) MarkNotificationsRead(
+	ctx context.Context,
+	userId uuid.UUID,
+	ids []uuid.UUID,
+) (int64, error) {
+	var changed int64
+
+	err := r.tx(ctx, func() error {
+		changed = 0
+		now := r.now()
+
+		for _, n := range r.userNotifications(userId, true) {
+			if len(ids) > 0 && !slices.Contains(ids, n.ID) {
+				continue
+			}
+
+			save(r, n)
+			n.ReadAt = &now
+			changed++
+		}
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// publishEvent stores an event for the user; it reaches the sink when the
+// transaction commits.
+func (r *Repo) publishEvent(userId uuid.UUID, typ model.EventType, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	e := model.Event{
+		ID:        r.nextSeq(),
+		UserID:    userId,
+		Type:      typ,
+		Data:      data,
+		CreatedAt: r.now(),
+	}
+
+	save(r, &r.events)
+	r.events = append(r.events, e)
+	r.published = append(r.published, e)
+}
+
+// FindEventsSince returns up to limit events of the user with ids above afterId, oldest first.
+func (r *Repo) FindEventsSince(
+	ctx context.Context,
+	userId uuid.UUID,
+	afterId int64,
+	limit int,
+) ([]model.Event, error) {
+	var events []model.Event
+
+	err := r.tx(ctx, func() error {
+		for _, e := range r.events {
+			if e.UserID == userId && e.ID > afterId {
+				events = append(events, e)
+			}
+		}
+
+		events = page(events, limit, 0)
+
+		return nil
+	})
+
+	return events, err
+}
+
+// DeleteEventsBefore drops events that are too old to be worth replaying.
+func (r *Repo) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+
+	err := r.tx(ctx, func() error {
+		kept := slices.DeleteFunc(slices.Clone(r.events), func(e model.Event) bool {
+			return e.CreatedAt.Before(before)
+		})
+		deleted = int64(len(r.events) - len(kept))
+
+		save(r, &r.events)
+		r.events = kept
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -0,0 +1,368 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+type order struct {
+	model.Order
+	// spent is what the order took from the buyer's lots.
+	spent []lot
+}
+
+// orderView is the order with the buyer's current username.
+func (r *Repo) orderView(o *order) model.Order {
+	v := o.Order
+	v.UserName = r.users[o.UserID].Username
+
+	return v
+}
+
+func (r *Repo) CreateOrder(ctx context.Context, o model.Order) (model.Order, error) {
+	err := r.tx(ctx, func() error {
+		var err error
+		o, err = r.createOrder(o, nil)
+
+		return err
+	})
+
+	return o, err
+}
+
+func (r *Repo) createOrder(o model.Order, spent []lot) (model.Order, error) {
+	if _, err := r.user(o.UserID); err != nil {
+		return model.Order{}, fmt.Errorf("create order: %w", err)
+	}
+
+	if o.Count == 0 {
+		o.Count = 1
+	}
+
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+
+	o.Status = model.OrderStatusPlaced
+	o.Timeline = model.OrderTimeline{}
+	o.CreatedAt = r.now()
+
+	stored := &order{Order: o, spent: spent}
+
+	save(r, &r.orders)
+	r.orders = append(r.orders, stored)
+
+	o = r.orderView(stored)
+	r.publishOrderEvent(o)
+
+	return o, nil
+}
+
+func (r *Repo) publishOrderEvent(o model.Order) {
+	r.publishEvent(o.UserID, model.EventOrder, map[string]any{
+		"orderId": o.ID.String(),
+		"product": o.ProductTitle,
+		"variant": o.VariantSKU,
+		"status":  string(o.Status),
+	})
+}
+
+func (r *Repo) FindOrdersByUserID(ctx context.Context, userId uuid.UUID) ([]model.Order, error) {
+	var orders []model.Order
+
+	err := r.tx(ctx, func() error {
+		orders = r.ordersOf(userId)
+
+		return nil
+	})
+
+	return orders, err
+}
+
+// ordersOf lists the user's orders, newest first.
+func (r *Repo) ordersOf(userId uuid.UUID) []model.Order {
+	var orders []model.Order
+
+	for i := len(r.orders) - 1; i >= 0; i-- {
+		if o := r.orders[i]; o.UserID == userId {
+			orders = append(orders, r.orderView(o))
+		}
+	}
+
+	return orders
+}
+
+// FindOrders lists orders of all users for the merch desk; zero filter
+// fields are not applied.
+func (r *Repo) FindOrders(ctx context.Context, filter model.OrderFilter) ([]model.Order, error) {
+	var orders []model.Order
+
+	err := r.tx(ctx, func() error {
+		for _, o := range r.orders {
+			switch {
+			case filter.Status != "" && o.Status != filter.Status,
+				filter.Product != "" && !strings.EqualFold(o.ProductTitle, filter.Product),
+				!filter.From.IsZero() && o.CreatedAt.Before(filter.From),
+				!filter.To.IsZero() && !o.CreatedAt.Before(filter.To):
+				continue
+			}
+
+			orders = append(orders, r.orderView(o))
+		}
+
+		orders = page(orders, filter.Limit, filter.Offset)
+
+		return nil
+	})
+
+	return orders, err
+}
+
+func (r *Repo) order(orderId uuid.UUID) (*order, error) {
+	for _, o := range r.orders {
+		if o.ID == orderId {
+			return o, nil
+		}
+	}
+
+	return nil, repo.ErrNotFound
+}
+
+// AdvanceOrder moves an order one step along the fulfilment flow; next must
+// be the status that directly follows the current one.
+func (r *Repo) AdvanceOrder(
+	ctx context.Context,
+	orderId uuid.UUID,
+	next model.OrderStatus,
+) (model.Order, error) {
+	var advanced model.Order
+
+	err := r.tx(ctx, func() error {
+		o, err := r.order(orderId)
+		if err != nil {
+			return err
+		}
+
+		if !o.Status.CanAdvanceTo(next) {
+			return repo.ErrBadOrderTransition
+		}
+
+		advanced = r.setOrderStatus(o, next)
+
+		return nil
+	})
+
+	return advanced, err
+}
+
+// CancelOrder lets the buyer undo a placed order within window of its creation.
+func (r *Repo) CancelOrder(
+	ctx context.Context,
+	userId, orderId uuid.UUID,
+	window time.Duration,
+) (model.Order, error) {
+	var cancelled model.Order
+
+	err := r.tx(ctx, func() error {
+		o, err := r.order(orderId)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case o.UserID != userId:
+			return repo.ErrNotFound
+		case o.Status != model.OrderStatusPlaced:
+			return repo.ErrOrderNotCancellable
+		case !o.CreatedAt.After(r.now().Add(-window)):
+			return repo.ErrCancelWindowExpired
+		}
+
+		cancelled, err = r.returnOrder(o, model.OrderStatusCancelled)
+
+		return err
+	})
+
+	return cancelled, err
+}
+
+// RefundOrder undoes any order that has not been returned yet, regardless of
+// its age. A delivered item stays with the buyer, so it is not restocked.
+func (r *Repo) RefundOrder(ctx context.Context, orderId uuid.UUID) (model.Order, error) {
+	var refunded model.Order
+
+	err := r.tx(ctx, func() error {
+		o, err := r.order(orderId)
+		if err != nil {
+			return err
+		}
+
+		if o.Status.Returned() {
+			return repo.ErrOrderNotRefundable
+		}
+
+		refunded, err = r.returnOrder(o, model.OrderStatusRefunded)
+
+		return err
+	})
+
+	return refunded, err
+}
+
+// setOrderStatus stores the new status together with the time it was reached
+// and lets the buyer know.
+func (r *Repo) setOrderStatus(o *order, status model.OrderStatus) model.Order {
+	now := r.now()
+
+	save(r, o)
+	o.Status = status
+
+	switch status {
+	case model.OrderStatusPacked:
+		o.Timeline.PackedAt = &now
+	case model.OrderStatusReadyForPickup:
+		o.Timeline.ReadyForPickupAt = &now
+	case model.OrderStatusDelivered:
+		o.Timeline.DeliveredAt = &now
+	case model.OrderStatusCancelled:
+		o.Timeline.CancelledAt = &now
+	case model.OrderStatusRefunded:
+		o.Timeline.RefundedAt = &now
+	}
+
+	updated := r.orderView(o)
+	r.publishOrderEvent(updated)
+	r.notify(model.Notification{
+		UserID: o.UserID,
+		Kind:   model.NotificationOrderStatus,
+		Message: fmt.Sprintf(
+			"Your %s order is %s", o.ProductTitle, strings.ReplaceAll(string(status), "_", " "),
+		),
+		Data: map[string]string{
+			"orderId": o.ID.String(),
+			"status":  string(status),
+		},
+	})
+
+	return updated
+}
+
+// returnOrder moves the order to status, gives the price paid back to the
+// buyer, frees its promo code use and puts the item back in stock unless it
+// was delivered.
+func (r *Repo) returnOrder(o *order, status model.OrderStatus) (model.Order, error) {
+	delivered := o.Status == model.OrderStatusDelivered
+	updated := r.setOrderStatus(o, status)
+
+	if _, err := r.refundCoins(o.UserID, o.PricePaid, o.spent); err != nil {
+		return model.Order{}, err
+	}
+
+	if o.PromoCode != "" {
+		r.releasePromoCode(o.PromoCode)
+	}
+
+	var err error
+
+	switch {
+	case delivered:
+	case o.VariantID != nil:
+		err = r.addToVariantStock(*o.VariantID, int64(o.Count))
+	default:
+		err = r.addToStock(o.ProductID, int64(o.Count))
+	}
+
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return updated, nil
+}
+
+// BuyProduct is repo's BuyProduct: the charge, the stock change and the
+// order happen together or not at all.
+func (r *Repo) BuyProduct(
+	ctx context.Context,
+	userId uuid.UUID,
+	purchase model.Purchase,
+) (model.Order, error) {
+	var bought model.Order
+
+	err := r.tx(ctx, func() error {
+		p, err := r.productByTitle(purchase.Product)
+		if err != nil {
+			return err
+		}
+
+		chosen, err := repo.PickVariant(r.productVariants(p.ID), purchase.Variant)
+		if err != nil {
+			return err
+		}
+
+		o := model.Order{
+			UserID:       userId,
+			ProductID:    p.ID,
+			ProductTitle: p.Title,
+			ProductPrice: p.Price,
+			Count:        1,
+		}
+		if chosen != nil {
+			o.VariantID = &chosen.ID
+			o.VariantSKU = chosen.SKU
+			o.ProductPrice = chosen.PriceOr(p.Price)
+		}
+
+		o.PricePaid = o.ProductPrice
+
+		if err := r.applyDiscounts(&o, purchase.PromoCode); err != nil {
+			return err
+		}
+
+		_, spent, err := r.spendCoins(userId, o.PricePaid)
+		if err != nil {
+			return err
+		}
+
+		if chosen != nil {
+			err = r.addToVariantStock(chosen.ID, -1)
+		} else {
+			err = r.addToStock(p.ID, -1)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		bought, err = r.createOrder(o, spent)
+
+		return err
+	})
+
+	return bought, err
+}
+
+func (r *Repo) applyDiscounts(o *model.Order, promoCode string) error {
+	if price, ok := r.promotionPrice(o.ProductID, o.VariantID); ok {
+		o.PricePaid = min(o.PricePaid, price)
+	}
+
+	if promoCode = strings.TrimSpace(promoCode); promoCode == "" {
+		return nil
+	}
+
+	code, err := r.usePromoCode(promoCode, o.UserID)
+	if err != nil {
+		return err
+	}
+
+	o.PricePaid = code.Apply(o.PricePaid)
+	o.PromoCode = code.Code
+
+	return nil
+}
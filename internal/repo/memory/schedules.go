@@ -0,0 +1,244 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/cron"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+type schedule struct {
+	model.ScheduledTransfer
+	runs []model.ScheduledRun
+	// attempts counts the passes in a row that hit an unexpected error.
+	attempts int
+}
+
+// scheduleView is the schedule with the recipient's username and last run.
+func (r *Repo) scheduleView(s *schedule) model.ScheduledTransfer {
+	v := s.ScheduledTransfer
+	v.ToUserName = r.users[s.ToUserID].Username
+
+	if len(s.runs) > 0 {
+		run := s.runs[len(s.runs)-1]
+		v.LastRun = &run
+	}
+
+	return v
+}
+
+// CreateScheduledTransfer stores a schedule that first runs at s.NextRunAt.
+func (r *Repo) CreateScheduledTransfer(
+	ctx context.Context,
+	s model.ScheduledTransfer,
+) (model.ScheduledTransfer, error) {
+	if err := repo.CheckTransfer(s.FromUserID, s.ToUserID, s.Amount); err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+
+	var created model.ScheduledTransfer
+
+	err := r.tx(ctx, func() error {
+		for _, id := range []uuid.UUID{s.FromUserID, s.ToUserID} {
+			if _, err := r.user(id); err != nil {
+				return fmt.Errorf("create scheduled transfer: %w", err)
+			}
+		}
+
+		s.ID = uuid.New()
+		s.Status = model.ScheduleActive
+		s.LastRun = nil
+		s.CreatedAt = r.now()
+
+		stored := &schedule{ScheduledTransfer: s}
+
+		save(r, &r.schedules)
+		r.schedules = append(r.schedules, stored)
+
+		created = r.scheduleView(stored)
+
+		return nil
+	})
+
+	return created, err
+}
+
+// FindScheduledTransfers lists the schedules the user set up, newest first.
+func (r *Repo) FindScheduledTransfers(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.ScheduledTransfer, error) {
+	var schedules []model.ScheduledTransfer
+
+	err := r.tx(ctx, func() error {
+		for i := len(r.schedules) - 1; i >= 0; i-- {
+			if s := r.schedules[i]; s.FromUserID == userId {
+				schedules = append(schedules, r.scheduleView(s))
+			}
+		}
+
+		return nil
+	})
+
+	return schedules, err
+}
+
+// SetScheduledTransferStatus pauses, resumes or cancels a schedule of the
+// user. A resumed recurring schedule skips the runs it missed while paused.
+func (r *Repo) SetScheduledTransferStatus(
+	ctx context.Context,
+	userId, scheduleId uuid.UUID,
+	status model.ScheduleStatus,
+) (model.ScheduledTransfer, error) {
+	var updated model.ScheduledTransfer
+
+	err := r.tx(ctx, func() error {
+		i := slices.IndexFunc(r.schedules, func(s *schedule) bool {
+			return s.ID == scheduleId && s.FromUserID == userId
+		})
+		if i < 0 {
+			return repo.ErrNotFound
+		}
+
+		s := r.schedules[i]
+		if !s.Status.CanChangeTo(status) {
+			return fmt.Errorf("set schedule status: %w", repo.ErrScheduleTransition)
+		}
+
+		next := s.NextRunAt
+		now := r.now()
+
+		switch {
+		case status == model.ScheduleCancelled:
+			next = nil
+		case status == model.ScheduleActive && s.Recurrence != "" && next != nil && next.Before(now):
+			var err error
+			if next, err = nextRun(s.Recurrence, now); err != nil {
+				return err
+			}
+		}
+
+		save(r, s)
+		s.Status = status
+		s.NextRunAt = next
+
+		updated = r.scheduleView(s)
+
+		return nil
+	})
+
+	return updated, err
+}
+
+// RunDueScheduledTransfers makes every transfer that is due, earliest
+// first, and returns how many schedules ran. Unexpected errors put a
+// schedule off, and missed runs are dropped, as in
+// repo.RunDueScheduledTransfers.
+func (r *Repo) RunDueScheduledTransfers(ctx context.Context) (int64, error) {
+	var n int64
+
+	for {
+		claimed, ran, err := r.runDueScheduledTransfer(ctx)
+		if err != nil || !claimed {
+			return n, err
+		}
+
+		if ran {
+			n++
+		}
+	}
+}
+
+// runDueScheduledTransfer sends the coins of the schedule due first,
+// records the run and moves the schedule on to its next run.
+func (r *Repo) runDueScheduledTransfer(ctx context.Context) (bool, bool, error) {
+	var claimed, ran bool
+
+	err := r.tx(ctx, func() error {
+		claimed, ran = false, false
+		now := r.now()
+
+		var s *schedule
+
+		for _, c := range r.schedules {
+			if c.Status != model.ScheduleActive || c.NextRunAt == nil || c.NextRunAt.After(now) {
+				continue
+			}
+
+			if s == nil || c.NextRunAt.Before(*s.NextRunAt) {
+				s = c
+			}
+		}
+
+		if s == nil {
+			return nil
+		}
+
+		claimed = true
+
+		sendErr := r.savepoint(func() error {
+			return r.sendCoins(ctx, s.FromUserID, s.ToUserID, s.Amount, s.Note)
+		})
+
+		run, err := repo.ScheduledRunResult(sendErr)
+		if err != nil {
+			if s.attempts+1 < repo.ScheduleMaxAttempts {
+				retryAt := now.Add(repo.ScheduleRetryAfter)
+
+				save(r, s)
+				s.attempts++
+				s.NextRunAt = &retryAt
+
+				return nil
+			}
+
+			run = model.ScheduledRun{Status: model.ScheduledRunFailed, Error: err.Error()}
+		}
+
+		run.ScheduledFor = *s.NextRunAt
+		run.CreatedAt = now
+
+		status, next := model.ScheduleCompleted, (*time.Time)(nil)
+		if s.Recurrence != "" {
+			if next, err = nextRun(s.Recurrence, now); err != nil {
+				return err
+			}
+
+			if next != nil {
+				status = model.ScheduleActive
+			}
+		}
+
+		save(r, s)
+		s.runs = append(slices.Clip(s.runs), run)
+		s.Status = status
+		s.NextRunAt = next
+		s.attempts = 0
+
+		ran = true
+
+		return nil
+	})
+
+	return claimed, ran, err
+}
+
+// nextRun is the first match of recurrence after now, nil if there is none.
+func nextRun(recurrence string, now time.Time) (*time.Time, error) {
+	schedule, err := cron.Parse(recurrence)
+	if err != nil {
+		return nil, fmt.Errorf("next run: %w", err)
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &next, nil
+}
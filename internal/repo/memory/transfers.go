@@ -0,0 +1,620 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+type transfer struct {
+	model.Transfer
+	// spent is what a held transfer took from the sender's lots.
+	spent []lot
+}
+
+// transferView is the transfer with both users' current usernames.
+func (r *Repo) transferView(t *transfer) model.Transfer {
+	v := t.Transfer
+	v.FromUserName = r.users[t.FromUserID].Username
+	v.ToUserName = r.users[t.ToUserID].Username
+
+	return v
+}
+
+func (r *Repo) CreateTransfer(
+	ctx context.Context,
+	fromID, toID uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+) (model.Transfer, error) {
+	var created model.Transfer
+
+	err := r.tx(ctx, func() error {
+		t, err := r.createTransfer(fromID, toID, amount, note, model.TransferAccepted, nil)
+		if err != nil {
+			return err
+		}
+
+		created = t.Transfer
+
+		return nil
+	})
+
+	return created, err
+}
+
+func (r *Repo) createTransfer(
+	fromID, toID uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+	status model.TransferStatus,
+	expiresAt *time.Time,
+) (*transfer, error) {
+	for _, id := range []uuid.UUID{fromID, toID} {
+		if _, err := r.user(id); err != nil {
+			return nil, fmt.Errorf("create transfer: %w", err)
+		}
+	}
+
+	t := &transfer{
+		Transfer: model.Transfer{
+			ID:         uuid.New(),
+			FromUserID: fromID,
+			ToUserID:   toID,
+			Amount:     amount,
+			Memo:       note.Memo,
+			Category:   note.Category,
+			Status:     status,
+			ExpiresAt:  expiresAt,
+			CreatedAt:  r.now(),
+		},
+	}
+
+	save(r, &r.transfers)
+	r.transfers = append(r.transfers, t)
+
+	return t, nil
+}
+
+func (r *Repo) FindTransfersFromID(ctx context.Context, id uuid.UUID) ([]model.Transfer, error) {
+	var transfers []model.Transfer
+
+	err := r.tx(ctx, func() error {
+		transfers = r.sentBy(id)
+
+		return nil
+	})
+
+	return transfers, err
+}
+
+func (r *Repo) FindTransfersToID(ctx context.Context, id uuid.UUID) ([]model.Transfer, error) {
+	var transfers []model.Transfer
+
+	err := r.tx(ctx, func() error {
+		transfers = r.receivedBy(id)
+
+		return nil
+	})
+
+	return transfers, err
+}
+
+// sentBy lists the user's accepted outgoing transfers, newest first.
+func (r *Repo) sentBy(id uuid.UUID) []model.Transfer {
+	var transfers []model.Transfer
+
+	for i := len(r.transfers) - 1; i >= 0; i-- {
+		if t := r.transfers[i]; t.FromUserID == id && t.Status == model.TransferAccepted {
+			v := r.transferView(t)
+			v.FromUserName = ""
+			transfers = append(transfers, transferSummary(v))
+		}
+	}
+
+	return transfers
+}
+
+// receivedBy lists the user's accepted incoming transfers, newest first.
+func (r *Repo) receivedBy(id uuid.UUID) []model.Transfer {
+	var transfers []model.Transfer
+
+	for i := len(r.transfers) - 1; i >= 0; i-- {
+		if t := r.transfers[i]; t.ToUserID == id && t.Status == model.TransferAccepted {
+			v := r.transferView(t)
+			v.ToUserName = ""
+			transfers = append(transfers, transferSummary(v))
+		}
+	}
+
+	return transfers
+}
+
+// transferSummary keeps what FindTransfersFromID and FindTransfersToID select.
+func transferSummary(t model.Transfer) model.Transfer {
+	t.Status = ""
+	t.ExpiresAt = nil
+	t.ResolvedAt = nil
+
+	return t
+}
+
+func (r *Repo) FindTransfersByUserID(
+	ctx context.Context,
+	userId uuid.UUID,
+	filter model.TransferFilter,
+) ([]model.Transfer, error) {
+	var transfers []model.Transfer
+
+	err := r.tx(ctx, func() error {
+		var found []*transfer
+
+		for _, t := range r.transfers {
+			sent := t.FromUserID == userId && filter.Direction != model.TransferDirectionReceived
+			received := t.ToUserID == userId && filter.Direction != model.TransferDirectionSent
+
+			if (sent || received) && (filter.Category == "" || t.Category == filter.Category) {
+				found = append(found, t)
+			}
+		}
+
+		slices.SortStableFunc(found, func(a, b *transfer) int {
+			return b.CreatedAt.Compare(a.CreatedAt)
+		})
+
+		for _, t := range page(found, filter.Limit, filter.Offset) {
+			transfers = append(transfers, r.transferView(t))
+		}
+
+		return nil
+	})
+
+	return transfers, err
+}
+
+// SendCoins moves amount coins from one user to another at once.
+func (r *Repo) SendCoins(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+) error {
+	if err := repo.CheckTransfer(fromUserId, toUserId, amount); err != nil {
+		return err
+	}
+
+	return r.tx(ctx, func() error {
+		return r.sendCoins(ctx, fromUserId, toUserId, amount, note)
+	})
+}
+
+func (r *Repo) sendCoins(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+) error {
+	for _, id := range []uuid.UUID{fromUserId, toUserId} {
+		if _, err := r.user(id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.withdrawForTransfer(ctx, fromUserId, toUserId, amount); err != nil {
+		return err
+	}
+
+	t, err := r.createTransfer(fromUserId, toUserId, amount, note, model.TransferAccepted, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.deliverTransfer(t)
+
+	return err
+}
+
+// withdrawForTransfer takes amount from the sender and checks the transfer
+// rules; it returns what it took from each lot.
+func (r *Repo) withdrawForTransfer(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+) ([]lot, error) {
+	from, spent, err := r.spendCoins(fromUserId, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := repo.TransferAttempt{From: from, ToID: toUserId, Amount: amount}
+	for _, rule := range r.transferRules {
+		if err := rule.Check(ctx, history{r}, attempt); err != nil {
+			return nil, fmt.Errorf("send coins: %w", err)
+		}
+	}
+
+	return spent, nil
+}
+
+// history answers the transfer rules from inside a transaction, where the
+// repo is already locked.
+type history struct {
+	r *Repo
+}
+
+func (h history) SentWithin(
+	_ context.Context,
+	fromID uuid.UUID,
+	toID *uuid.UUID,
+	period time.Duration,
+) (repo.TransferTotals, error) {
+	var totals repo.TransferTotals
+
+	since := h.r.now().Add(-period)
+
+	for _, t := range h.r.transfers {
+		switch {
+		case t.FromUserID != fromID,
+			t.Status != model.TransferPending && t.Status != model.TransferAccepted,
+			toID != nil && t.ToUserID != *toID,
+			t.CreatedAt.Before(since):
+			continue
+		}
+
+		totals.Amount += t.Amount
+		totals.Count++
+	}
+
+	return totals, nil
+}
+
+func (h history) AccountAge(_ context.Context, userID uuid.UUID) (time.Duration, error) {
+	u, ok := h.r.users[userID]
+	if !ok {
+		return 0, repo.ErrNotFound
+	}
+
+	return h.r.now().Sub(u.CreatedAt), nil
+}
+
+// deliverTransfer credits the recipient with coins already taken from the
+// sender and tells the recipient about it.
+func (r *Repo) deliverTransfer(t *transfer) (model.Transfer, error) {
+	if _, err := r.addToBalance(t.ToUserID, +t.Amount); err != nil {
+		return model.Transfer{}, err
+	}
+
+	v := r.transferView(t)
+
+	r.publishEvent(t.ToUserID, model.EventTransfer, map[string]any{
+		"transferId": t.ID.String(),
+		"from":       v.FromUserName,
+		"amount":     t.Amount,
+		"memo":       t.Memo,
+		"category":   t.Category,
+	})
+	r.notify(model.Notification{
+		UserID:  t.ToUserID,
+		Kind:    model.NotificationCoinsReceived,
+		Message: fmt.Sprintf("%s sent you %d coins", v.FromUserName, t.Amount),
+		Data: map[string]string{
+			"transferId": t.ID.String(),
+			"from":       v.FromUserName,
+			"amount":     strconv.FormatInt(t.Amount, 10),
+		},
+	})
+
+	return v, nil
+}
+
+// SendPendingCoins holds amount from the sender until the recipient accepts
+// or declines the transfer, or ttl passes and it expires.
+func (r *Repo) SendPendingCoins(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+	ttl time.Duration,
+) (model.Transfer, error) {
+	if err := repo.CheckTransfer(fromUserId, toUserId, amount); err != nil {
+		return model.Transfer{}, err
+	}
+
+	var sent model.Transfer
+
+	err := r.tx(ctx, func() error {
+		spent, err := r.withdrawForTransfer(ctx, fromUserId, toUserId, amount)
+		if err != nil {
+			return err
+		}
+
+		expiresAt := r.now().Add(ttl)
+
+		t, err := r.createTransfer(fromUserId, toUserId, amount, note, model.TransferPending, &expiresAt)
+		if err != nil {
+			return err
+		}
+
+		t.spent = spent
+
+		sent = r.transferView(t)
+
+		r.notify(model.Notification{
+			UserID: toUserId,
+			Kind:   model.NotificationTransferPending,
+			Message: fmt.Sprintf(
+				"%s wants to send you %d coins, accept or decline the transfer",
+				sent.FromUserName, amount,
+			),
+			Data: map[string]string{
+				"transferId": t.ID.String(),
+				"from":       sent.FromUserName,
+				"amount":     strconv.FormatInt(amount, 10),
+				"expiresAt":  expiresAt.Format(time.RFC3339),
+			},
+		})
+
+		return nil
+	})
+
+	return sent, err
+}
+
+// AcceptTransfer hands the held coins of a pending transfer to the recipient.
+func (r *Repo) AcceptTransfer(
+	ctx context.Context,
+	userId, transferId uuid.UUID,
+) (model.Transfer, error) {
+	var accepted model.Transfer
+
+	err := r.tx(ctx, func() error {
+		t, err := r.pendingTransfer(userId, transferId)
+		if err != nil {
+			return err
+		}
+
+		r.resolveTransfer(t, model.TransferAccepted)
+		accepted, err = r.deliverTransfer(t)
+
+		return err
+	})
+
+	return accepted, err
+}
+
+// DeclineTransfer returns the held coins of a pending transfer to the sender.
+func (r *Repo) DeclineTransfer(
+	ctx context.Context,
+	userId, transferId uuid.UUID,
+) (model.Transfer, error) {
+	var declined model.Transfer
+
+	err := r.tx(ctx, func() error {
+		t, err := r.pendingTransfer(userId, transferId)
+		if err != nil {
+			return err
+		}
+
+		declined, err = r.returnTransfer(t, model.TransferDeclined)
+
+		return err
+	})
+
+	return declined, err
+}
+
+// ExpireTransfers refunds every pending transfer past its expiry and
+// returns how many there were.
+func (r *Repo) ExpireTransfers(ctx context.Context) (int64, error) {
+	var expired int64
+
+	err := r.tx(ctx, func() error {
+		expired = 0
+		now := r.now()
+
+		for _, t := range r.transfers {
+			if t.Status != model.TransferPending || t.ExpiresAt == nil || t.ExpiresAt.After(now) {
+				continue
+			}
+
+			if _, err := r.returnTransfer(t, model.TransferExpired); err != nil {
+				return err
+			}
+
+			expired++
+		}
+
+		return nil
+	})
+
+	return expired, err
+}
+
+// pendingTransfer finds a transfer sent to userId that can still be
+// accepted or declined.
+func (r *Repo) pendingTransfer(userId, transferId uuid.UUID) (*transfer, error) {
+	i := slices.IndexFunc(r.transfers, func(t *transfer) bool {
+		return t.ID == transferId && t.ToUserID == userId
+	})
+	if i < 0 {
+		return nil, repo.ErrNotFound
+	}
+
+	t := r.transfers[i]
+	if t.Status != model.TransferPending || t.ExpiresAt != nil && !t.ExpiresAt.After(r.now()) {
+		return nil, fmt.Errorf("lock transfer: %w", repo.ErrTransferNotPending)
+	}
+
+	return t, nil
+}
+
+func (r *Repo) resolveTransfer(t *transfer, status model.TransferStatus) {
+	now := r.now()
+
+	save(r, t)
+	t.Status = status
+	t.ResolvedAt = &now
+}
+
+// returnTransfer gives the held coins back to the sender of a pending
+// transfer that was declined or expired.
+func (r *Repo) returnTransfer(t *transfer, status model.TransferStatus) (model.Transfer, error) {
+	if _, err := r.refundCoins(t.FromUserID, t.Amount, t.spent); err != nil {
+		return model.Transfer{}, err
+	}
+
+	r.resolveTransfer(t, status)
+	v := r.transferView(t)
+
+	message := fmt.Sprintf("%s declined your transfer of %d coins", v.ToUserName, t.Amount)
+	if status == model.TransferExpired {
+		message = fmt.Sprintf(
+			"Your transfer of %d coins to %s expired unclaimed", t.Amount, v.ToUserName,
+		)
+	}
+
+	r.notify(model.Notification{
+		UserID:  t.FromUserID,
+		Kind:    model.NotificationTransferReturned,
+		Message: message + ", the coins are back on your balance",
+		Data: map[string]string{
+			"transferId": t.ID.String(),
+			"to":         v.ToUserName,
+			"amount":     strconv.FormatInt(t.Amount, 10),
+			"status":     string(status),
+		},
+	})
+
+	return v, nil
+}
+
+// FindLeaderboard ranks users by accepted transfers made within the window,
+// limit entries per board.
+func (r *Repo) FindLeaderboard(
+	ctx context.Context,
+	window model.LeaderboardWindow,
+	limit int,
+) (model.Leaderboard, error) {
+	var board model.Leaderboard
+
+	err := r.tx(ctx, func() error {
+		since := window.Since(r.now())
+
+		type score struct {
+			amount, count int64
+			recipients    map[uuid.UUID]bool
+		}
+
+		received := map[uuid.UUID]*score{}
+		sent := map[uuid.UUID]*score{}
+
+		add := func(scores map[uuid.UUID]*score, id uuid.UUID, t *transfer) {
+			s, ok := scores[id]
+			if !ok {
+				s = &score{recipients: map[uuid.UUID]bool{}}
+				scores[id] = s
+			}
+
+			s.amount += t.Amount
+			s.count++
+			s.recipients[t.ToUserID] = true
+		}
+
+		for _, t := range r.transfers {
+			if t.Status == model.TransferAccepted && !t.CreatedAt.Before(since) {
+				add(received, t.ToUserID, t)
+				add(sent, t.FromUserID, t)
+			}
+		}
+
+		rank := func(scores map[uuid.UUID]*score, amount func(*score) int64) []model.LeaderboardEntry {
+			var entries []model.LeaderboardEntry
+
+			for id, s := range scores {
+				if u := r.users[id]; !u.optOut {
+					entries = append(entries, model.LeaderboardEntry{
+						UserName: u.Username,
+						Amount:   amount(s),
+						Count:    s.count,
+					})
+				}
+			}
+
+			slices.SortFunc(entries, func(a, b model.LeaderboardEntry) int {
+				if a.Amount != b.Amount {
+					return int(b.Amount - a.Amount)
+				}
+
+				return strings.Compare(a.UserName, b.UserName)
+			})
+
+			return page(entries, limit, 0)
+		}
+
+		total := func(s *score) int64 { return s.amount }
+
+		board.TopReceivers = rank(received, total)
+		board.TopSenders = rank(sent, total)
+		board.MostGenerous = rank(sent, func(s *score) int64 { return int64(len(s.recipients)) })
+
+		return nil
+	})
+
+	return board, err
+}
+
+func (r *Repo) FindUserStats(ctx context.Context, userId uuid.UUID) (model.UserStats, error) {
+	var stats model.UserStats
+
+	err := r.tx(ctx, func() error {
+		u, err := r.user(userId)
+		if err != nil {
+			return err
+		}
+
+		stats = model.UserStats{UserName: u.Username, LeaderboardOptOut: u.optOut}
+		counterparties := map[uuid.UUID]bool{}
+
+		for _, t := range r.transfers {
+			switch {
+			case t.Status != model.TransferAccepted:
+			case t.FromUserID == userId:
+				stats.Sent += t.Amount
+				stats.SentCount++
+				counterparties[t.ToUserID] = true
+			case t.ToUserID == userId:
+				stats.Received += t.Amount
+				stats.ReceivedCount++
+				counterparties[t.FromUserID] = true
+			}
+		}
+
+		stats.Counterparties = int64(len(counterparties))
+
+		bought := map[string]int64{}
+
+		for _, o := range r.orders {
+			if o.UserID == userId && !o.Status.Returned() {
+				bought[o.ProductTitle] += int64(o.Count)
+			}
+		}
+
+		for title, n := range bought {
+			best := bought[stats.FavouriteProduct]
+			if stats.FavouriteProduct == "" || n > best || n == best && title < stats.FavouriteProduct {
+				stats.FavouriteProduct = title
+			}
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
@@ -0,0 +1,249 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+)
+
+type user struct {
+	model.User
+	optOut bool
+	muted  []model.NotificationKind
+	// lots are the user's credits, oldest first; see repo.WithCoinTTL.
+	lots []lot
+}
+
+func (r *Repo) user(id uuid.UUID) (*user, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, repo.ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (r *Repo) FindUserByID(ctx context.Context, id uuid.UUID) (model.User, error) {
+	var found model.User
+
+	err := r.tx(ctx, func() error {
+		u, err := r.user(id)
+		if err != nil {
+			return err
+		}
+
+		found = u.User
+
+		return nil
+	})
+
+	return found, err
+}
+
+func (r *Repo) FindUserByUsername(ctx context.Context, username string) (model.User, error) {
+	var found model.User
+
+	err := r.tx(ctx, func() error {
+		id, ok := r.usernames[username]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		found = r.users[id].User
+
+		return nil
+	})
+
+	return found, err
+}
+
+func (r *Repo) CreateUser(ctx context.Context, username, passwordHash string) (model.User, error) {
+	var created model.User
+
+	err := r.tx(ctx, func() error {
+		if _, ok := r.usernames[username]; ok {
+			return fmt.Errorf("create user: username %q is taken", username)
+		}
+
+		u := &user{User: model.User{
+			ID:           uuid.New(),
+			Username:     username,
+			PasswordHash: passwordHash,
+			Role:         model.RoleUser,
+			CreatedAt:    r.now(),
+		}}
+
+		r.users[u.ID] = u
+		r.usernames[username] = u.ID
+		r.onRollback(func() {
+			delete(r.users, u.ID)
+			delete(r.usernames, username)
+		})
+
+		created = u.User
+
+		return nil
+	})
+
+	return created, err
+}
+
+// SetRole gives the user a role; it stands in for the UPDATE the README
+// shows for Postgres.
+func (r *Repo) SetRole(ctx context.Context, username string, role model.Role) error {
+	return r.tx(ctx, func() error {
+		id, ok := r.usernames[username]
+		if !ok {
+			return repo.ErrNotFound
+		}
+
+		u := r.users[id]
+		save(r, u)
+		u.Role = role
+
+		return nil
+	})
+}
+
+func (r *Repo) AddToBalance(
+	ctx context.Context,
+	userId uuid.UUID,
+	delta int64,
+) (model.User, error) {
+	var updated model.User
+
+	err := r.tx(ctx, func() error {
+		var err error
+		updated, err = r.addToBalance(userId, delta)
+
+		return err
+	})
+
+	return updated, err
+}
+
+func (r *Repo) addToBalance(userId uuid.UUID, delta int64) (model.User, error) {
+	updated, _, err := r.changeBalance(userId, delta)
+
+	return updated, err
+}
+
+// changeBalance is addToBalance that also returns what a debit took from
+// each lot.
+func (r *Repo) changeBalance(userId uuid.UUID, delta int64) (model.User, []lot, error) {
+	u, err := r.user(userId)
+	if err != nil {
+		return model.User{}, nil, err
+	}
+
+	if u.Balance+delta < 0 {
+		return model.User{}, nil, fmt.Errorf("add to balance: %w", repo.ErrInsufficient)
+	}
+
+	save(r, u)
+	taken := r.moveCoinLots(u, delta)
+	r.setBalance(u, u.Balance+delta, delta)
+
+	return u.User, taken, nil
+}
+
+// setBalance must follow a save of u.
+func (r *Repo) setBalance(u *user, balance, delta int64) {
+	u.Balance = balance
+	r.publishEvent(u.ID, model.EventBalance, map[string]any{
+		"balance": balance,
+		"delta":   delta,
+	})
+}
+
+func (r *Repo) AdjustBalance(
+	ctx context.Context,
+	userId uuid.UUID,
+	delta int64,
+	reason string,
+) (model.User, error) {
+	var updated model.User
+
+	err := r.tx(ctx, func() error {
+		var err error
+		if updated, err = r.addToBalance(userId, delta); err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Your balance was adjusted by %+d coins", delta)
+		if reason != "" {
+			message += ": " + reason
+		}
+
+		r.notify(model.Notification{
+			UserID:  userId,
+			Kind:    model.NotificationBalanceAdjusted,
+			Message: message,
+			Data: map[string]string{
+				"delta":  strconv.FormatInt(delta, 10),
+				"reason": reason,
+			},
+		})
+
+		return nil
+	})
+
+	return updated, err
+}
+
+func (r *Repo) SetLeaderboardOptOut(ctx context.Context, userId uuid.UUID, optOut bool) error {
+	return r.tx(ctx, func() error {
+		u, err := r.user(userId)
+		if err != nil {
+			return err
+		}
+
+		save(r, u)
+		u.optOut = optOut
+
+		return nil
+	})
+}
+
+func (r *Repo) FindMutedNotificationKinds(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.NotificationKind, error) {
+	var kinds []model.NotificationKind
+
+	err := r.tx(ctx, func() error {
+		if u, ok := r.users[userId]; ok {
+			kinds = slices.Clone(u.muted)
+		}
+
+		return nil
+	})
+
+	return kinds, err
+}
+
+func (r *Repo) SetMutedNotificationKinds(
+	ctx context.Context,
+	userId uuid.UUID,
+	kinds []model.NotificationKind,
+) error {
+	return r.tx(ctx, func() error {
+		u, err := r.user(userId)
+		if err != nil {
+			return err
+		}
+
+		muted := slices.Clone(kinds)
+		slices.Sort(muted)
+
+		save(r, u)
+		u.muted = slices.Compact(muted)
+
+		return nil
+	})
+}
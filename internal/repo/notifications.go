@@ -0,0 +1,224 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+// notify stores n for n.UserID unless the user muted n.Kind. It runs on the
+// caller's transaction, so the notification exists only if the change that
+// caused it is committed.
+func (r *Repo) notify(ctx context.Context, n model.Notification) error {
+	q := r.runner(ctx)
+
+	if n.Data == nil {
+		n.Data = map[string]string{}
+	}
+
+	if _, err := q.Exec(ctx, `
+		INSERT INTO merch_shop.notifications (user_id, kind, message, data)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM merch_shop.notification_mutes WHERE user_id = $1 AND kind = $2
+		)
+	`, n.UserID, string(n.Kind), n.Message, n.Data); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+// notifyWishlisters adds a notification for everyone who has the product on
+// their wishlist and has not muted kind. message is a format() pattern taking
+// the product title; data is merged with the product id and title.
+func (r *Repo) notifyWishlisters(
+	ctx context.Context,
+	productId uuid.UUID,
+	kind model.NotificationKind,
+	message string,
+	data map[string]string,
+) error {
+	q := r.runner(ctx)
+
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	if _, err := q.Exec(ctx, `
+		INSERT INTO merch_shop.notifications (user_id, kind, message, data)
+		SELECT w.user_id, $2, format($3, p.title),
+		       $4::jsonb || jsonb_build_object('productId', p.id::text, 'product', p.title)
+		FROM merch_shop.wishlist_items AS w
+		JOIN merch_shop.products AS p ON p.id = w.product_id
+		WHERE w.product_id = $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM merch_shop.notification_mutes AS m
+		      WHERE m.user_id = w.user_id AND m.kind = $2
+		  )
+	`, productId, string(kind), message, data); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+// notifyPriceDrop tells everyone who wishlisted the product that its price
+// went down from before to price.
+func (r *Repo) notifyPriceDrop(ctx context.Context, productId uuid.UUID, price, before int64) error {
+	return r.notifyWishlisters(
+		ctx,
+		productId,
+		model.NotificationPriceDrop,
+		fmt.Sprintf("%%s is now %d coins, was %d", price, before),
+		map[string]string{
+			"price":    strconv.FormatInt(price, 10),
+			"oldPrice": strconv.FormatInt(before, 10),
+		},
+	)
+}
+
+func (r *Repo) FindNotifications(
+	ctx context.Context,
+	userId uuid.UUID,
+	filter model.NotificationFilter,
+) ([]model.Notification, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT id, user_id, kind, message, data, read_at, created_at
+		FROM merch_shop.notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, userId, filter.UnreadOnly, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var notifications []model.Notification
+
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(
+			&n.ID, &n.UserID, &n.Kind, &n.Message, &n.Data, &n.ReadAt, &n.CreatedAt,
+		); err != nil {
+			return notifications, fmt.Errorf("scan row: %w", err)
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (r *Repo) CountUnreadNotifications(ctx context.Context, userId uuid.UUID) (int64, error) {
+	q := r.runner(ctx)
+
+	var count int64
+	if err := q.QueryRow(ctx, `
+		SELECT count(*) FROM merch_shop.notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userId).Scan(&count); err != nil {
+		return 0, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead marks the given notifications of the user as read, or
+// all of them when ids is empty, and returns how many changed. pgx sends a
+// nil ids as NULL rather than an empty array, so both mean all.
+func (r *Repo) MarkNotificationsRead(
+	ctx context.Context,
+	userId uuid.UUID,
+	ids []uuid.UUID,
+) (int64, error) {
+	q := r.runner(ctx)
+
+	tag, err := q.Exec(ctx, `
+		UPDATE merch_shop.notifications
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL
+		  AND ($2::uuid[] IS NULL OR cardinality($2::uuid[]) = 0 OR id = ANY($2))
+	`, userId, ids)
+	if err != nil {
+		return 0, fmt.Errorf("exec sql: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *Repo) FindMutedNotificationKinds(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.NotificationKind, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT kind FROM merch_shop.notification_mutes WHERE user_id = $1 ORDER BY kind
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var kinds []model.NotificationKind
+
+	for rows.Next() {
+		var kind model.NotificationKind
+		if err := rows.Scan(&kind); err != nil {
+			return kinds, fmt.Errorf("scan row: %w", err)
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return kinds, nil
+}
+
+// SetMutedNotificationKinds replaces the set of kinds the user does not want
+// to be notified about.
+func (r *Repo) SetMutedNotificationKinds(
+	ctx context.Context,
+	userId uuid.UUID,
+	kinds []model.NotificationKind,
+) error {
+	names := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		names = append(names, string(kind))
+	}
+
+	return r.WithTx(ctx, func(txCtx context.Context) error {
+		q := r.runner(txCtx)
+
+		if _, err := q.Exec(txCtx, `
+			DELETE FROM merch_shop.notification_mutes WHERE user_id = $1
+		`, userId); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		if _, err := q.Exec(txCtx, `
+			INSERT INTO merch_shop.notification_mutes (user_id, kind)
+			SELECT $1, kind FROM unnest($2::text[]) AS kind
+			ON CONFLICT DO NOTHING
+		`, userId, names); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		return nil
+	}, nil)
+}
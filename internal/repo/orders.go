@@ -2,38 +2,102 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
-func (r *Repo) CreateOrder(
-	ctx context.Context,
-	userId, productId uuid.UUID,
-) (model.Order, error) {
+var (
+	ErrOrderNotCancellable = errors.New("order cannot be cancelled")
+	ErrCancelWindowExpired = errors.New("cancellation window expired")
+	ErrOrderNotRefundable  = errors.New("order cannot be refunded")
+	ErrBadOrderTransition  = errors.New("order status transition not allowed")
+)
+
+// orderColumns is the select list scanOrder expects; it must be used with
+// orderJoins, which aliases the buyer as u. Product data comes from the
+// snapshot stored on the order, never from the live catalog.
+const (
+	orderColumns = `
+	o.id, o.user_id, u.username, o.product_id, o.product_title, o.unit_price, o.quantity,
+	o.variant_id, o.variant_sku, o.price_paid, COALESCE(o.promo_code, ''),
+	o.status, o.created_at,
+	o.packed_at, o.ready_for_pickup_at, o.delivered_at, o.cancelled_at, o.refunded_at`
+	orderJoins = `
+	JOIN merch_shop.users AS u ON u.id = o.user_id`
+)
+
+func scanOrder(row pgx.Row, o *model.Order) error {
+	return row.Scan( //nolint:wrapcheck
+		&o.ID, &o.UserID, &o.UserName, &o.ProductID, &o.ProductTitle, &o.ProductPrice, &o.Count,
+		&o.VariantID, &o.VariantSKU, &o.PricePaid, &o.PromoCode, &o.Status, &o.CreatedAt,
+		&o.Timeline.PackedAt, &o.Timeline.ReadyForPickupAt, &o.Timeline.DeliveredAt,
+		&o.Timeline.CancelledAt, &o.Timeline.RefundedAt,
+	)
+}
+
+// CreateOrder stores a placed order together with its product snapshot:
+// o.ProductTitle, o.VariantSKU, o.ProductPrice per item and o.Count items,
+// charged o.PricePaid with o.PromoCode. o.ID is kept if set.
+func (r *Repo) CreateOrder(ctx context.Context, o model.Order) (model.Order, error) {
 	q := r.runner(ctx)
 
-	var o model.Order
+	if o.Count == 0 {
+		o.Count = 1
+	}
+
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+
+	var promoCode *string
+	if o.PromoCode != "" {
+		promoCode = &o.PromoCode
+	}
+
 	if err := q.QueryRow(ctx, `
-		INSERT INTO merch_shop.orders (user_id, product_id)
-		VALUES ($1, $2)
-		RETURNING id, user_id, product_id, created_at
-	`, userId, productId).Scan(&o.ID, &o.UserID, &o.ProductID, &o.CreatedAt); err != nil {
+		INSERT INTO merch_shop.orders (
+			id, user_id, product_id, variant_id, product_title, variant_sku,
+			unit_price, quantity, price_paid, promo_code
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING status, created_at
+	`,
+		o.ID, o.UserID, o.ProductID, o.VariantID, o.ProductTitle, o.VariantSKU,
+		o.ProductPrice, o.Count, o.PricePaid, promoCode,
+	).Scan(
+		&o.Status, &o.CreatedAt,
+	); err != nil {
 		return o, fmt.Errorf("get query row sql: %w", err)
 	}
 
+	if err := r.publishOrderEvent(ctx, o); err != nil {
+		return model.Order{}, err
+	}
+
 	return o, nil
 }
 
+func (r *Repo) publishOrderEvent(ctx context.Context, o model.Order) error {
+	return r.publishEvent(ctx, o.UserID, model.EventOrder, map[string]any{
+		"orderId": o.ID.String(),
+		"product": o.ProductTitle,
+		"variant": o.VariantSKU,
+		"status":  string(o.Status),
+	})
+}
+
 func (r *Repo) FindOrdersByUserID(ctx context.Context, userId uuid.UUID) ([]model.Order, error) {
-	q := r.runner(ctx)
+	q := r.reader(ctx)
 
 	rows, err := q.Query(ctx, `
-		SELECT o.id, o.user_id, o.product_id, o.created_at,
-		       p.title AS product_title, p.price AS product_price
-		FROM merch_shop.orders AS o
-		JOIN merch_shop.products AS p ON p.id = o.product_id
+		SELECT `+orderColumns+`
+		FROM merch_shop.orders AS o`+orderJoins+`
 		WHERE o.user_id = $1
 		ORDER BY o.created_at DESC
 	`, userId)
@@ -41,13 +105,48 @@ func (r *Repo) FindOrdersByUserID(ctx context.Context, userId uuid.UUID) ([]mode
 		return nil, fmt.Errorf("get query sql: %w", err)
 	}
 
+	return collectOrders(rows)
+}
+
+// FindOrders lists orders of all users for the merch desk; zero filter
+// fields are not applied.
+func (r *Repo) FindOrders(ctx context.Context, filter model.OrderFilter) ([]model.Order, error) {
+	q := r.runner(ctx)
+
+	var from, to *time.Time
+	if !filter.From.IsZero() {
+		from = &filter.From
+	}
+
+	if !filter.To.IsZero() {
+		to = &filter.To
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT `+orderColumns+`
+		FROM merch_shop.orders AS o`+orderJoins+`
+		WHERE ($1::text = '' OR o.status = $1)
+		  AND ($2::text = '' OR lower(o.product_title) = lower($2))
+		  AND ($3::timestamp IS NULL OR o.created_at >= $3)
+		  AND ($4::timestamp IS NULL OR o.created_at < $4)
+		ORDER BY o.created_at, o.id
+		LIMIT $5 OFFSET $6
+	`, string(filter.Status), filter.Product, from, to, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	return collectOrders(rows)
+}
+
+func collectOrders(rows pgx.Rows) ([]model.Order, error) {
 	defer rows.Close()
 
 	var orders []model.Order
 
 	for rows.Next() {
 		var o model.Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.ProductID, &o.CreatedAt, &o.ProductTitle, &o.ProductPrice); err != nil {
+		if err := scanOrder(rows, &o); err != nil {
 			return orders, fmt.Errorf("scan row: %w", err)
 		}
 
@@ -60,3 +159,211 @@ func (r *Repo) FindOrdersByUserID(ctx context.Context, userId uuid.UUID) ([]mode
 
 	return orders, nil
 }
+
+// AdvanceOrder moves an order one step along the fulfilment flow; next must
+// be the status that directly follows the current one.
+func (r *Repo) AdvanceOrder(
+	ctx context.Context,
+	orderId uuid.UUID,
+	next model.OrderStatus,
+) (model.Order, error) {
+	var order model.Order
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		o, _, err := r.lockOrder(txCtx, orderId, 0)
+		if err != nil {
+			return err
+		}
+
+		if !o.Status.CanAdvanceTo(next) {
+			return ErrBadOrderTransition
+		}
+
+		order, err = r.setOrderStatus(txCtx, o.ID, next)
+
+		return err
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return order, err
+}
+
+// CancelOrder lets the buyer undo a placed order within window of its creation.
+func (r *Repo) CancelOrder(
+	ctx context.Context,
+	userId, orderId uuid.UUID,
+	window time.Duration,
+) (model.Order, error) {
+	var order model.Order
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		o, inWindow, err := r.lockOrder(txCtx, orderId, window)
+		if err != nil {
+			return err
+		}
+
+		if o.UserID != userId {
+			return ErrNotFound
+		}
+
+		if o.Status != model.OrderStatusPlaced {
+			return ErrOrderNotCancellable
+		}
+
+		if !inWindow {
+			return ErrCancelWindowExpired
+		}
+
+		order, err = r.returnOrder(txCtx, o, model.OrderStatusCancelled)
+
+		return err
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return order, err
+}
+
+// RefundOrder undoes any order that has not been returned yet, regardless of
+// its age. A delivered item stays with the buyer, so it is not restocked.
+func (r *Repo) RefundOrder(ctx context.Context, orderId uuid.UUID) (model.Order, error) {
+	var order model.Order
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		o, _, err := r.lockOrder(txCtx, orderId, 0)
+		if err != nil {
+			return err
+		}
+
+		if o.Status.Returned() {
+			return ErrOrderNotRefundable
+		}
+
+		order, err = r.returnOrder(txCtx, o, model.OrderStatusRefunded)
+
+		return err
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return order, err
+}
+
+// lockOrder selects the order FOR UPDATE and reports whether it was created
+// less than window ago.
+func (r *Repo) lockOrder(
+	ctx context.Context,
+	orderId uuid.UUID,
+	window time.Duration,
+) (model.Order, bool, error) {
+	q := r.runner(ctx)
+
+	var (
+		o        model.Order
+		inWindow bool
+	)
+
+	err := q.QueryRow(ctx, `
+		SELECT id, user_id, product_id, variant_id, quantity, status, price_paid,
+		       COALESCE(promo_code, ''), created_at > now() - make_interval(secs => $2)
+		FROM merch_shop.orders
+		WHERE id = $1
+		FOR UPDATE
+	`, orderId, window.Seconds()).Scan(
+		&o.ID, &o.UserID, &o.ProductID, &o.VariantID, &o.Count, &o.Status, &o.PricePaid,
+		&o.PromoCode, &inWindow,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Order{}, false, ErrNotFound
+		}
+
+		return model.Order{}, false, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return o, inWindow, nil
+}
+
+// setOrderStatus stores the new status together with the time it was reached
+// and lets the buyer know.
+func (r *Repo) setOrderStatus(
+	ctx context.Context,
+	orderId uuid.UUID,
+	status model.OrderStatus,
+) (model.Order, error) {
+	q := r.runner(ctx)
+
+	var o model.Order
+
+	err := scanOrder(q.QueryRow(ctx, `
+		WITH o AS (
+			UPDATE merch_shop.orders
+			SET status = $2,
+			    packed_at = CASE WHEN $2 = 'packed' THEN now() ELSE packed_at END,
+			    ready_for_pickup_at = CASE WHEN $2 = 'ready_for_pickup' THEN now() ELSE ready_for_pickup_at END,
+			    delivered_at = CASE WHEN $2 = 'delivered' THEN now() ELSE delivered_at END,
+			    cancelled_at = CASE WHEN $2 = 'cancelled' THEN now() ELSE cancelled_at END,
+			    refunded_at = CASE WHEN $2 = 'refunded' THEN now() ELSE refunded_at END
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+orderColumns+`
+		FROM o`+orderJoins+`
+	`, orderId, string(status)), &o)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	if err := r.publishOrderEvent(ctx, o); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := r.notify(ctx, model.Notification{
+		UserID: o.UserID,
+		Kind:   model.NotificationOrderStatus,
+		Message: fmt.Sprintf(
+			"Your %s order is %s", o.ProductTitle, strings.ReplaceAll(string(status), "_", " "),
+		),
+		Data: map[string]string{
+			"orderId": o.ID.String(),
+			"status":  string(status),
+		},
+	}); err != nil {
+		return model.Order{}, err
+	}
+
+	return o, nil
+}
+
+// returnOrder moves a locked order to status, gives the price paid back to
+// the buyer's lots it came from, frees its promo code use and puts the item
+// back in stock unless it was delivered. Must run inside WithTx.
+func (r *Repo) returnOrder(
+	ctx context.Context,
+	o model.Order,
+	status model.OrderStatus,
+) (model.Order, error) {
+	order, err := r.setOrderStatus(ctx, o.ID, status)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if _, err := r.refundCoins(ctx, o.UserID, o.PricePaid, o.ID); err != nil {
+		return model.Order{}, err
+	}
+
+	if o.PromoCode != "" {
+		if err := r.releasePromoCode(ctx, o.PromoCode); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	switch {
+	case o.Status == model.OrderStatusDelivered:
+	case o.VariantID != nil:
+		err = r.AddToVariantStock(ctx, *o.VariantID, int64(o.Count))
+	default:
+		err = r.AddToStock(ctx, o.ProductID, int64(o.Count))
+	}
+
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return order, nil
+}
@@ -0,0 +1,284 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrTransferNotPending = errors.New("transfer is not pending")
+
+// expireBatch is how many pending transfers ExpireTransfers returns per transaction.
+const expireBatch = 100
+
+// SendPendingCoins holds amount from the sender until the recipient accepts
+// or declines the transfer, or ttl passes and it expires. Only the sender is
+// locked, so like SendCoins it runs at Read Committed.
+func (r *Repo) SendPendingCoins(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+	ttl time.Duration,
+) (model.Transfer, error) {
+	if err := CheckTransfer(fromUserId, toUserId, amount); err != nil {
+		return model.Transfer{}, err
+	}
+
+	var transfer model.Transfer
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		// The id is taken up front for the coins to be held against it.
+		id := uuid.New()
+
+		from, err := r.withdrawForTransfer(txCtx, fromUserId, toUserId, amount, &id)
+		if err != nil {
+			return err
+		}
+
+		q := r.runner(txCtx)
+
+		transfer = model.Transfer{FromUserName: from.Username}
+		if err := q.QueryRow(txCtx, `
+			INSERT INTO merch_shop.transfers
+				(id, from_user_id, to_user_id, amount, memo, category, status, expires_at)
+			VALUES ($7, $1, $2, $3, $4, $5, 'pending', now() + make_interval(secs => $6))
+			RETURNING id, from_user_id, to_user_id,
+			          (SELECT username FROM merch_shop.users WHERE id = $2),
+			          amount, memo, category, status, expires_at, created_at
+		`, fromUserId, toUserId, amount, note.Memo, note.Category, ttl.Seconds(), id).Scan(
+			&transfer.ID, &transfer.FromUserID, &transfer.ToUserID, &transfer.ToUserName,
+			&transfer.Amount, &transfer.Memo, &transfer.Category, &transfer.Status,
+			&transfer.ExpiresAt, &transfer.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("create transfer: %w", err)
+		}
+
+		return r.notify(txCtx, model.Notification{
+			UserID: toUserId,
+			Kind:   model.NotificationTransferPending,
+			Message: fmt.Sprintf(
+				"%s wants to send you %d coins, accept or decline the transfer",
+				from.Username, amount,
+			),
+			Data: map[string]string{
+				"transferId": transfer.ID.String(),
+				"from":       from.Username,
+				"amount":     strconv.FormatInt(amount, 10),
+				"expiresAt":  transfer.ExpiresAt.Format(time.RFC3339),
+			},
+		})
+	}, nil)
+
+	return transfer, err
+}
+
+// AcceptTransfer hands the held coins of a pending transfer to the recipient.
+func (r *Repo) AcceptTransfer(
+	ctx context.Context,
+	userId, transferId uuid.UUID,
+) (model.Transfer, error) {
+	var transfer model.Transfer
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		var err error
+		if transfer, err = r.lockPendingTransfer(txCtx, userId, transferId); err != nil {
+			return err
+		}
+
+		if err := r.resolveTransfer(txCtx, &transfer, model.TransferAccepted); err != nil {
+			return err
+		}
+
+		return r.deliverTransfer(txCtx, transfer)
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return transfer, err
+}
+
+// DeclineTransfer returns the held coins of a pending transfer to the sender.
+func (r *Repo) DeclineTransfer(
+	ctx context.Context,
+	userId, transferId uuid.UUID,
+) (model.Transfer, error) {
+	var transfer model.Transfer
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		var err error
+		if transfer, err = r.lockPendingTransfer(txCtx, userId, transferId); err != nil {
+			return err
+		}
+
+		return r.returnTransfer(txCtx, &transfer, model.TransferDeclined)
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return transfer, err
+}
+
+// ExpireTransfers refunds every pending transfer past its expiry and
+// returns how many there were. Transfers being accepted or declined at the
+// same time are left for the next run.
+func (r *Repo) ExpireTransfers(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		var expired int
+
+		err := r.WithTx(ctx, func(txCtx context.Context) error {
+			transfers, err := r.lockTransfers(txCtx, `
+				WHERE t.status = 'pending' AND t.expires_at <= now()
+				ORDER BY t.expires_at
+				LIMIT $1
+				FOR UPDATE OF t SKIP LOCKED
+			`, expireBatch)
+			if err != nil {
+				return err
+			}
+
+			for i := range transfers {
+				if err := r.returnTransfer(txCtx, &transfers[i].Transfer, model.TransferExpired); err != nil {
+					return err
+				}
+			}
+
+			expired = len(transfers)
+
+			return nil
+		}, nil)
+		if err != nil {
+			return total, err
+		}
+
+		total += int64(expired)
+
+		if expired < expireBatch {
+			return total, nil
+		}
+	}
+}
+
+// lockPendingTransfer locks a transfer sent to userId that can still be
+// accepted or declined.
+func (r *Repo) lockPendingTransfer(
+	ctx context.Context,
+	userId, transferId uuid.UUID,
+) (model.Transfer, error) {
+	transfers, err := r.lockTransfers(ctx, `
+		WHERE t.id = $1 AND t.to_user_id = $2
+		FOR UPDATE OF t
+	`, transferId, userId)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+
+	if len(transfers) == 0 {
+		return model.Transfer{}, ErrNotFound
+	}
+
+	t := transfers[0]
+	if t.Status != model.TransferPending || t.expired {
+		return t.Transfer, fmt.Errorf("lock transfer: %w", ErrTransferNotPending)
+	}
+
+	return t.Transfer, nil
+}
+
+// lockedTransfer is a transfer as lockTransfers found it.
+type lockedTransfer struct {
+	model.Transfer
+	// expired is whether expires_at has passed by the database clock.
+	expired bool
+}
+
+// lockTransfers selects transfers with both user names; tail is the WHERE
+// clause onwards and must lock the rows FOR UPDATE OF t.
+func (r *Repo) lockTransfers(ctx context.Context, tail string, args ...any) ([]lockedTransfer, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT t.id, t.from_user_id, fu.username, t.to_user_id, tu.username,
+		       t.amount, t.memo, t.category, t.status, t.expires_at, t.created_at,
+		       t.expires_at IS NOT NULL AND t.expires_at <= now()
+		FROM merch_shop.transfers AS t
+		JOIN merch_shop.users AS fu ON t.from_user_id = fu.id
+		JOIN merch_shop.users AS tu ON t.to_user_id = tu.id
+	`+tail, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var transfers []lockedTransfer
+
+	for rows.Next() {
+		var t lockedTransfer
+		if err := rows.Scan(
+			&t.ID, &t.FromUserID, &t.FromUserName, &t.ToUserID, &t.ToUserName,
+			&t.Amount, &t.Memo, &t.Category, &t.Status, &t.ExpiresAt, &t.CreatedAt,
+			&t.expired,
+		); err != nil {
+			return transfers, fmt.Errorf("scan row: %w", err)
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return transfers, nil
+}
+
+func (r *Repo) resolveTransfer(ctx context.Context, t *model.Transfer, status model.TransferStatus) error {
+	q := r.runner(ctx)
+
+	if err := q.QueryRow(ctx, `
+		UPDATE merch_shop.transfers
+		SET status = $2, resolved_at = now()
+		WHERE id = $1
+		RETURNING status, resolved_at
+	`, t.ID, status).Scan(&t.Status, &t.ResolvedAt); err != nil {
+		return fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return nil
+}
+
+// returnTransfer gives the held coins back to the sender of a pending
+// transfer that was declined or expired, into the lots they were taken from.
+func (r *Repo) returnTransfer(ctx context.Context, t *model.Transfer, status model.TransferStatus) error {
+	if _, err := r.refundCoins(ctx, t.FromUserID, t.Amount, t.ID); err != nil {
+		return err
+	}
+
+	if err := r.resolveTransfer(ctx, t, status); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("%s declined your transfer of %d coins", t.ToUserName, t.Amount)
+	if status == model.TransferExpired {
+		message = fmt.Sprintf(
+			"Your transfer of %d coins to %s expired unclaimed", t.Amount, t.ToUserName,
+		)
+	}
+
+	return r.notify(ctx, model.Notification{
+		UserID:  t.FromUserID,
+		Kind:    model.NotificationTransferReturned,
+		Message: message + ", the coins are back on your balance",
+		Data: map[string]string{
+			"transferId": t.ID.String(),
+			"to":         t.ToUserName,
+			"amount":     strconv.FormatInt(t.Amount, 10),
+			"status":     string(status),
+		},
+	})
+}
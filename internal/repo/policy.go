@@ -0,0 +1,227 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Codes returned in TransferPolicyError by the built-in rules.
+const (
+	TransferCodeAmountLimit    = "transfer_amount_limit"
+	TransferCodeDailyCap       = "daily_send_cap"
+	TransferCodeWeeklyCap      = "weekly_send_cap"
+	TransferCodeRecipientLimit = "recipient_limit"
+	TransferCodeAccountTooNew  = "account_too_new"
+)
+
+// TransferPolicyError is returned by SendCoins when a transfer rule rejects
+// the transfer; Code tells clients which rule it was.
+type TransferPolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *TransferPolicyError) Error() string {
+	return "transfer policy: " + e.Message
+}
+
+// TransferAttempt is a transfer about to be made. From is the sender as of
+// the transfer transaction, after its balance row was locked.
+type TransferAttempt struct {
+	From   model.User
+	ToID   uuid.UUID
+	Amount int64
+}
+
+// TransferTotals sums up transfers matching a TransferHistory query.
+type TransferTotals struct {
+	Amount int64
+	Count  int64
+}
+
+// TransferHistory is what rules may ask about past transfers; it reads
+// inside the transfer transaction. Pending transfers count, declined and
+// expired ones do not. Periods are measured by the database clock, the one
+// transfers and users are stamped with.
+type TransferHistory interface {
+	// SentWithin totals what fromID sent over the last period, only to toID
+	// when it is not nil.
+	SentWithin(
+		ctx context.Context,
+		fromID uuid.UUID,
+		toID *uuid.UUID,
+		period time.Duration,
+	) (TransferTotals, error)
+	// AccountAge is how long ago the user signed up.
+	AccountAge(ctx context.Context, userID uuid.UUID) (time.Duration, error)
+}
+
+// TransferRule vets a transfer. It returns a *TransferPolicyError to reject
+// it; any other error aborts the transfer as a failure.
+type TransferRule interface {
+	Check(ctx context.Context, history TransferHistory, t TransferAttempt) error
+}
+
+// MaxTransferAmount caps the amount of a single transfer.
+type MaxTransferAmount struct {
+	Max int64
+}
+
+func (rule MaxTransferAmount) Check(_ context.Context, _ TransferHistory, t TransferAttempt) error {
+	if t.Amount > rule.Max {
+		return &TransferPolicyError{
+			Code:    TransferCodeAmountLimit,
+			Message: fmt.Sprintf("at most %d coins per transfer", rule.Max),
+		}
+	}
+
+	return nil
+}
+
+// SendCap caps the coins a user sends over a sliding Period.
+type SendCap struct {
+	Period time.Duration
+	Max    int64
+	Code   string
+}
+
+func DailySendCap(limit int64) SendCap {
+	return SendCap{Period: 24 * time.Hour, Max: limit, Code: TransferCodeDailyCap} //nolint:mnd
+}
+
+func WeeklySendCap(limit int64) SendCap {
+	return SendCap{Period: 7 * 24 * time.Hour, Max: limit, Code: TransferCodeWeeklyCap} //nolint:mnd
+}
+
+func (rule SendCap) Check(ctx context.Context, history TransferHistory, t TransferAttempt) error {
+	sent, err := history.SentWithin(ctx, t.From.ID, nil, rule.Period)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if sent.Amount+t.Amount > rule.Max {
+		return &TransferPolicyError{
+			Code: rule.Code,
+			Message: fmt.Sprintf(
+				"at most %d coins per %s, %d left",
+				rule.Max, rule.Period, max(rule.Max-sent.Amount, 0),
+			),
+		}
+	}
+
+	return nil
+}
+
+// RecipientLimit caps how many transfers a user makes to the same recipient
+// over a sliding Period.
+type RecipientLimit struct {
+	Period time.Duration
+	Max    int64
+}
+
+func (rule RecipientLimit) Check(
+	ctx context.Context,
+	history TransferHistory,
+	t TransferAttempt,
+) error {
+	sent, err := history.SentWithin(ctx, t.From.ID, &t.ToID, rule.Period)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if sent.Count >= rule.Max {
+		return &TransferPolicyError{
+			Code: TransferCodeRecipientLimit,
+			Message: fmt.Sprintf(
+				"at most %d transfers to the same user per %s", rule.Max, rule.Period,
+			),
+		}
+	}
+
+	return nil
+}
+
+// MinAccountAge keeps accounts younger than Age from sending coins.
+type MinAccountAge struct {
+	Age time.Duration
+}
+
+func (rule MinAccountAge) Check(ctx context.Context, history TransferHistory, t TransferAttempt) error {
+	age, err := history.AccountAge(ctx, t.From.ID)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if age < rule.Age {
+		return &TransferPolicyError{
+			Code:    TransferCodeAccountTooNew,
+			Message: fmt.Sprintf("accounts can send coins %s after sign-up", rule.Age),
+		}
+	}
+
+	return nil
+}
+
+// SentWithin implements TransferHistory.
+func (r *Repo) SentWithin(
+	ctx context.Context,
+	fromID uuid.UUID,
+	toID *uuid.UUID,
+	period time.Duration,
+) (TransferTotals, error) {
+	q := r.runner(ctx)
+
+	var totals TransferTotals
+
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0), COUNT(*)
+		FROM merch_shop.transfers
+		WHERE from_user_id = $1
+		  AND status IN ('pending', 'accepted')
+		  AND ($2::uuid IS NULL OR to_user_id = $2)
+		  AND created_at >= now() - make_interval(secs => $3)
+	`, fromID, toID, period.Seconds()).Scan(&totals.Amount, &totals.Count)
+	if err != nil {
+		return TransferTotals{}, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return totals, nil
+}
+
+// AccountAge implements TransferHistory.
+func (r *Repo) AccountAge(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	q := r.runner(ctx)
+
+	var secs float64
+
+	err := q.QueryRow(ctx, `
+		SELECT EXTRACT(EPOCH FROM now() - created_at)::float8
+		FROM merch_shop.users
+		WHERE id = $1
+	`, userID).Scan(&secs)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+
+		return 0, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+func (r *Repo) checkTransferRules(ctx context.Context, t TransferAttempt) error {
+	for _, rule := range r.transferRules {
+		if err := rule.Check(ctx, r, t); err != nil {
+			return fmt.Errorf("send coins: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHistory struct {
+	total, toRecipient TransferTotals
+	age                time.Duration
+	periods            []time.Duration
+}
+
+func (h *fakeHistory) SentWithin(
+	_ context.Context,
+	_ uuid.UUID,
+	toID *uuid.UUID,
+	period time.Duration,
+) (TransferTotals, error) {
+	h.periods = append(h.periods, period)
+	if toID != nil {
+		return h.toRecipient, nil
+	}
+
+	return h.total, nil
+}
+
+func (h *fakeHistory) AccountAge(context.Context, uuid.UUID) (time.Duration, error) {
+	return h.age, nil
+}
+
+func policyCode(t *testing.T, err error) string {
+	t.Helper()
+
+	if err == nil {
+		return ""
+	}
+
+	var policyErr *TransferPolicyError
+	require.True(t, errors.As(err, &policyErr), err)
+
+	return policyErr.Code
+}
+
+func TestTransferRules(t *testing.T) {
+	attempt := TransferAttempt{
+		From:   model.User{ID: uuid.New()},
+		ToID:   uuid.New(),
+		Amount: 30,
+	}
+
+	cases := []struct {
+		name    string
+		rule    TransferRule
+		history fakeHistory
+		want    string
+	}{
+		{"amount ok", MaxTransferAmount{Max: 30}, fakeHistory{}, ""},
+		{"amount over", MaxTransferAmount{Max: 29}, fakeHistory{}, TransferCodeAmountLimit},
+		{
+			"daily ok", DailySendCap(100),
+			fakeHistory{total: TransferTotals{Amount: 70, Count: 3}}, "",
+		},
+		{
+			"daily over", DailySendCap(100),
+			fakeHistory{total: TransferTotals{Amount: 71, Count: 3}}, TransferCodeDailyCap,
+		},
+		{
+			"weekly over", WeeklySendCap(100),
+			fakeHistory{total: TransferTotals{Amount: 90, Count: 1}}, TransferCodeWeeklyCap,
+		},
+		{
+			"recipient ok", RecipientLimit{Period: time.Hour, Max: 3},
+			fakeHistory{toRecipient: TransferTotals{Count: 2}}, "",
+		},
+		{
+			"recipient over", RecipientLimit{Period: time.Hour, Max: 3},
+			fakeHistory{toRecipient: TransferTotals{Count: 3}}, TransferCodeRecipientLimit,
+		},
+		{"age ok", MinAccountAge{Age: 48 * time.Hour}, fakeHistory{age: 48 * time.Hour}, ""},
+		{
+			"age too new", MinAccountAge{Age: 49 * time.Hour},
+			fakeHistory{age: 48 * time.Hour}, TransferCodeAccountTooNew,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.Check(context.Background(), &tc.history, attempt)
+			require.Equal(t, tc.want, policyCode(t, err))
+		})
+	}
+}
+
+func TestSendCap_Window(t *testing.T) {
+	history := &fakeHistory{}
+
+	err := WeeklySendCap(100).
+		Check(context.Background(), history, TransferAttempt{Amount: 1})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{7 * 24 * time.Hour}, history.periods)
+}
+
+func TestCheckTransferRules_StopsAtFirstViolation(t *testing.T) {
+	r := NewRepo(nil, WithTransferRules(
+		MaxTransferAmount{Max: 10},
+		MinAccountAge{Age: time.Hour},
+	))
+
+	err := r.checkTransferRules(context.Background(), TransferAttempt{
+		Amount: 20,
+	})
+	require.Equal(t, TransferCodeAmountLimit, policyCode(t, err))
+}
@@ -4,6 +4,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/google/uuid"
@@ -14,20 +15,132 @@ type MerchRepo interface { //nolint:interfacebloat
 	FindUserByUsername(ctx context.Context, username string) (model.User, error)
 	CreateUser(ctx context.Context, username, passwordHash string) (model.User, error)
 	AddToBalance(ctx context.Context, userId uuid.UUID, delta int64) (model.User, error)
+	AdjustBalance(
+		ctx context.Context,
+		userId uuid.UUID,
+		delta int64,
+		reason string,
+	) (model.User, error)
+	FindCoinExpirations(ctx context.Context, userId uuid.UUID) ([]model.CoinExpiration, error)
+	ExpireCoinLots(ctx context.Context) (int64, error)
 
 	FindProductByTitle(ctx context.Context, title string) (model.Product, error)
+	FindProductByID(ctx context.Context, id uuid.UUID) (model.Product, error)
+	FindProducts(ctx context.Context, filter model.ProductFilter) ([]model.Product, error)
+	AddToStock(ctx context.Context, productId uuid.UUID, delta int64) error
+	FindVariantsByProductID(
+		ctx context.Context,
+		productId uuid.UUID,
+	) ([]model.ProductVariant, error)
+	AddToVariantStock(ctx context.Context, variantId uuid.UUID, delta int64) error
+	SetProductPrice(ctx context.Context, productId uuid.UUID, price int64) error
+	UpdateProduct(
+		ctx context.Context,
+		productId uuid.UUID,
+		update model.ProductUpdate,
+	) (model.Product, error)
+
+	FindWishlist(ctx context.Context, userId uuid.UUID) ([]model.WishlistItem, error)
+	AddToWishlist(ctx context.Context, userId, productId uuid.UUID) error
+	RemoveFromWishlist(ctx context.Context, userId, productId uuid.UUID) error
+
+	FindNotifications(
+		ctx context.Context,
+		userId uuid.UUID,
+		filter model.NotificationFilter,
+	) ([]model.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userId uuid.UUID) (int64, error)
+	MarkNotificationsRead(ctx context.Context, userId uuid.UUID, ids []uuid.UUID) (int64, error)
+	FindMutedNotificationKinds(
+		ctx context.Context,
+		userId uuid.UUID,
+	) ([]model.NotificationKind, error)
+	SetMutedNotificationKinds(
+		ctx context.Context,
+		userId uuid.UUID,
+		kinds []model.NotificationKind,
+	) error
+
+	FindEventsSince(
+		ctx context.Context,
+		userId uuid.UUID,
+		afterId int64,
+		limit int,
+	) ([]model.Event, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
 
-	CreateOrder(ctx context.Context, userId, productId uuid.UUID) (model.Order, error)
+	FindLeaderboard(
+		ctx context.Context,
+		window model.LeaderboardWindow,
+		limit int,
+	) (model.Leaderboard, error)
+	FindUserStats(ctx context.Context, userId uuid.UUID) (model.UserStats, error)
+	FindUserInfo(ctx context.Context, userId uuid.UUID, limit int) (model.UserInfo, error)
+	SetLeaderboardOptOut(ctx context.Context, userId uuid.UUID, optOut bool) error
+
+	CreateOrder(ctx context.Context, o model.Order) (model.Order, error)
 	FindOrdersByUserID(ctx context.Context, userId uuid.UUID) ([]model.Order, error)
+	FindOrders(ctx context.Context, filter model.OrderFilter) ([]model.Order, error)
+	AdvanceOrder(
+		ctx context.Context,
+		orderId uuid.UUID,
+		next model.OrderStatus,
+	) (model.Order, error)
+	CancelOrder(
+		ctx context.Context,
+		userId, orderId uuid.UUID,
+		window time.Duration,
+	) (model.Order, error)
+	RefundOrder(ctx context.Context, orderId uuid.UUID) (model.Order, error)
 
 	CreateTransfer(
 		ctx context.Context,
 		fromID, toID uuid.UUID,
 		amount int64,
+		note model.TransferNote,
 	) (model.Transfer, error)
 	FindTransfersFromID(ctx context.Context, fromID uuid.UUID) ([]model.Transfer, error)
 	FindTransfersToID(ctx context.Context, toID uuid.UUID) ([]model.Transfer, error)
+	FindTransfersByUserID(
+		ctx context.Context,
+		userId uuid.UUID,
+		filter model.TransferFilter,
+	) ([]model.Transfer, error)
+
+	SendCoins(
+		ctx context.Context,
+		fromID, toID uuid.UUID,
+		amount int64,
+		note model.TransferNote,
+	) error
+	SendPendingCoins(
+		ctx context.Context,
+		fromID, toID uuid.UUID,
+		amount int64,
+		note model.TransferNote,
+		ttl time.Duration,
+	) (model.Transfer, error)
+	AcceptTransfer(ctx context.Context, userId, transferId uuid.UUID) (model.Transfer, error)
+	DeclineTransfer(ctx context.Context, userId, transferId uuid.UUID) (model.Transfer, error)
+	ExpireTransfers(ctx context.Context) (int64, error)
+	BuyProduct(
+		ctx context.Context,
+		userId uuid.UUID,
+		purchase model.Purchase,
+	) (model.Order, error)
+
+	CreateScheduledTransfer(
+		ctx context.Context,
+		s model.ScheduledTransfer,
+	) (model.ScheduledTransfer, error)
+	FindScheduledTransfers(ctx context.Context, userId uuid.UUID) ([]model.ScheduledTransfer, error)
+	SetScheduledTransferStatus(
+		ctx context.Context,
+		userId, scheduleId uuid.UUID,
+		status model.ScheduleStatus,
+	) (model.ScheduledTransfer, error)
+	RunDueScheduledTransfers(ctx context.Context) (int64, error)
 
-	SendCoins(ctx context.Context, fromID, toID uuid.UUID, amount int64) error
-	BuyProduct(ctx context.Context, userId uuid.UUID, productTitle string) error
+	CreatePromotion(ctx context.Context, p model.Promotion) (model.Promotion, error)
+	CreatePromoCode(ctx context.Context, c model.PromoCode) (model.PromoCode, error)
 }
@@ -4,21 +4,54 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
+var ErrOutOfStock = errors.New("out of stock")
+
+// productColumns is the select list scanProduct expects for products aliased as p.
+const productColumns = `
+	p.id, p.title, p.price, p.description, p.image_url, p.stock,
+	CASE WHEN EXISTS (SELECT 1 FROM merch_shop.product_variants AS v WHERE v.product_id = p.id)
+	     THEN EXISTS (
+	         SELECT 1 FROM merch_shop.product_variants AS v
+	         WHERE v.product_id = p.id AND (v.stock IS NULL OR v.stock > 0))
+	     ELSE p.stock IS NULL OR p.stock > 0
+	END`
+
+// productOrder maps the supported sort keys onto ORDER BY clauses.
+var productOrder = map[model.ProductSort]string{
+	model.ProductSortName:      "p.title, p.id",
+	model.ProductSortNameDesc:  "p.title DESC, p.id",
+	model.ProductSortPrice:     "p.price, p.title, p.id",
+	model.ProductSortPriceDesc: "p.price DESC, p.title, p.id",
+}
+
+func scanProduct(row pgx.Row, p *model.Product) error {
+	return row.Scan( //nolint:wrapcheck
+		&p.ID, &p.Title, &p.Price, &p.Description, &p.ImageURL, &p.Stock, &p.Available,
+	)
+}
+
 func (r *Repo) FindProductByTitle(ctx context.Context, title string) (model.Product, error) {
-	q := r.runner(ctx)
+	return findProduct(ctx, r.reader(ctx), `lower(p.title) = lower($1)`, title)
+}
+
+func (r *Repo) FindProductByID(ctx context.Context, id uuid.UUID) (model.Product, error) {
+	return findProduct(ctx, r.runner(ctx), `p.id = $1`, id)
+}
 
+func findProduct(ctx context.Context, q Runner, where string, arg any) (model.Product, error) {
 	var p model.Product
 
-	err := q.QueryRow(ctx, `
-		SELECT id, title, price
-		FROM merch_shop.products
-		WHERE lower(title) = lower($1)
-	`, title).Scan(&p.ID, &p.Title, &p.Price)
+	err := scanProduct(q.QueryRow(ctx, `
+		SELECT `+productColumns+`
+		FROM merch_shop.products AS p
+		WHERE `+where, arg), &p)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return model.Product{}, ErrNotFound
@@ -29,3 +62,221 @@ func (r *Repo) FindProductByTitle(ctx context.Context, title string) (model.Prod
 
 	return p, nil
 }
+
+// FindProducts lists the catalog; an unknown or empty sort falls back to
+// sorting by title.
+func (r *Repo) FindProducts(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	q := r.runner(ctx)
+
+	order, ok := productOrder[filter.Sort]
+	if !ok {
+		order = productOrder[model.ProductSortName]
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT `+productColumns+`
+		FROM merch_shop.products AS p
+		WHERE ($1::text = '' OR p.title ILIKE '%' || $2::text || '%' OR p.title % $1)
+		  AND ($3::bigint IS NULL OR p.price >= $3)
+		  AND ($4::bigint IS NULL OR p.price <= $4)
+		ORDER BY `+order+`
+		LIMIT $5 OFFSET $6
+	`, filter.Query, escapeLike(filter.Query), filter.MinPrice, filter.MaxPrice, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var products []model.Product
+
+	for rows.Next() {
+		var p model.Product
+		if err := scanProduct(rows, &p); err != nil {
+			return products, fmt.Errorf("scan row: %w", err)
+		}
+
+		products = append(products, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return products, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// AddToStock changes the stock of a stock-tracked product; untracked
+// products (NULL stock) are left as is. Bringing a sold out product back in
+// stock notifies everyone who wishlisted it.
+func (r *Repo) AddToStock(ctx context.Context, productId uuid.UUID, delta int64) error {
+	q := r.runner(ctx)
+
+	var before *int64
+
+	err := q.QueryRow(ctx, `
+		UPDATE merch_shop.products
+		SET stock = stock + $2
+		WHERE id = $1 AND (stock IS NULL OR stock + $2 >= 0)
+		RETURNING stock - $2
+	`, productId, delta).Scan(&before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("add to stock: %w", ErrOutOfStock)
+		}
+
+		return fmt.Errorf("get query row sql: %w", err)
+	}
+
+	if restocked(before, delta) {
+		return r.notifyWishlisters(ctx, productId, model.NotificationBackInStock, "%s is back in stock", nil)
+	}
+
+	return nil
+}
+
+// restocked reports whether adding delta to a tracked stock of before takes
+// it from sold out to available.
+func restocked(before *int64, delta int64) bool {
+	return before != nil && *before <= 0 && *before+delta > 0
+}
+
+// SetProductPrice changes the list price; lowering it notifies everyone who
+// wishlisted the product.
+func (r *Repo) SetProductPrice(ctx context.Context, productId uuid.UUID, price int64) error {
+	q := r.runner(ctx)
+
+	var before int64
+
+	err := q.QueryRow(ctx, `
+		UPDATE merch_shop.products AS p
+		SET price = $2
+		FROM (SELECT id, price FROM merch_shop.products WHERE id = $1 FOR UPDATE) AS old
+		WHERE p.id = old.id
+		RETURNING old.price
+	`, productId, price).Scan(&before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+
+		return fmt.Errorf("get query row sql: %w", err)
+	}
+
+	if price < before {
+		return r.notifyPriceDrop(ctx, productId, price, before)
+	}
+
+	return nil
+}
+
+// UpdateProduct applies an admin price change and restock in one transaction
+// and returns the product as it is afterwards.
+func (r *Repo) UpdateProduct(
+	ctx context.Context,
+	productId uuid.UUID,
+	update model.ProductUpdate,
+) (model.Product, error) {
+	var product model.Product
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		if update.Price != nil {
+			if err := r.SetProductPrice(txCtx, productId, *update.Price); err != nil {
+				return err
+			}
+		}
+
+		if update.Restock != 0 {
+			var err error
+			if update.VariantID != nil {
+				err = r.AddToVariantStock(txCtx, *update.VariantID, update.Restock)
+			} else {
+				err = r.AddToStock(txCtx, productId, update.Restock)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		product, err = r.FindProductByID(txCtx, productId)
+
+		return err
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return product, err
+}
+
+func (r *Repo) FindVariantsByProductID(
+	ctx context.Context,
+	productId uuid.UUID,
+) ([]model.ProductVariant, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT id, product_id, sku, attributes, price, stock, is_default
+		FROM merch_shop.product_variants
+		WHERE product_id = $1
+		ORDER BY sku
+	`, productId)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var variants []model.ProductVariant
+
+	for rows.Next() {
+		var v model.ProductVariant
+		err := rows.Scan(&v.ID, &v.ProductID, &v.SKU, &v.Attributes, &v.Price, &v.Stock, &v.Default)
+		if err != nil {
+			return variants, fmt.Errorf("scan row: %w", err)
+		}
+
+		variants = append(variants, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return variants, nil
+}
+
+// AddToVariantStock is AddToStock for a single variant of a product.
+func (r *Repo) AddToVariantStock(ctx context.Context, variantId uuid.UUID, delta int64) error {
+	q := r.runner(ctx)
+
+	var (
+		productId uuid.UUID
+		before    *int64
+	)
+
+	err := q.QueryRow(ctx, `
+		UPDATE merch_shop.product_variants
+		SET stock = stock + $2
+		WHERE id = $1 AND (stock IS NULL OR stock + $2 >= 0)
+		RETURNING product_id, stock - $2
+	`, variantId, delta).Scan(&productId, &before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("add to variant stock: %w", ErrOutOfStock)
+		}
+
+		return fmt.Errorf("get query row sql: %w", err)
+	}
+
+	if restocked(before, delta) {
+		return r.notifyWishlisters(ctx, productId, model.NotificationBackInStock, "%s is back in stock", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPromoCodeInvalid   = errors.New("promo code is invalid or expired")
+	ErrPromoCodeExhausted = errors.New("promo code usage limit reached")
+	ErrPromoCodeUserLimit = errors.New("promo code already used by this user")
+	ErrPromoCodeExists    = errors.New("promo code already exists")
+)
+
+// CreatePromotion stores a promotion. When it covers the whole product, is
+// already running and undercuts the price wishlists show, everyone who
+// wishlisted the product gets a price drop notification. Promotions for a
+// single variant or that start later notify no one: wishlists show the
+// product price, and nothing runs when a promotion starts.
+func (r *Repo) CreatePromotion(ctx context.Context, p model.Promotion) (model.Promotion, error) {
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		q := r.runner(txCtx)
+
+		// The price FindWishlist shows before the promotion.
+		var before int64
+		if err := q.QueryRow(txCtx, `
+			SELECT COALESCE((
+			           SELECT min(pr.price)
+			           FROM merch_shop.promotions AS pr
+			           WHERE pr.product_id = p.id AND pr.variant_id IS NULL
+			             AND pr.starts_at <= now() AND now() < pr.ends_at
+			       ), p.price)
+			FROM merch_shop.products AS p
+			WHERE p.id = $1
+		`, p.ProductID).Scan(&before); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("create promotion: %w", ErrNotFound)
+			}
+
+			return fmt.Errorf("get query row sql: %w", err)
+		}
+
+		var running bool
+		if err := q.QueryRow(txCtx, `
+			INSERT INTO merch_shop.promotions (product_id, variant_id, price, starts_at, ends_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, starts_at <= now() AND now() < ends_at
+		`, p.ProductID, p.VariantID, p.Price, p.StartsAt, p.EndsAt,
+		).Scan(&p.ID, &p.CreatedAt, &running); err != nil {
+			return fmt.Errorf("get query row sql: %w", err)
+		}
+
+		if p.VariantID == nil && running && p.Price < before {
+			return r.notifyPriceDrop(txCtx, p.ProductID, p.Price, before)
+		}
+
+		return nil
+	}, nil)
+
+	return p, err
+}
+
+func (r *Repo) CreatePromoCode(ctx context.Context, c model.PromoCode) (model.PromoCode, error) {
+	q := r.runner(ctx)
+
+	c.Code = strings.ToUpper(c.Code)
+
+	err := q.QueryRow(ctx, `
+		INSERT INTO merch_shop.promo_codes (code, kind, value, max_uses, per_user_limit, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (code) DO NOTHING
+		RETURNING used_count, created_at
+	`, c.Code, c.Kind, c.Value, c.MaxUses, c.PerUserLimit, c.ExpiresAt).Scan(&c.UsedCount, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, ErrPromoCodeExists
+		}
+
+		return c, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return c, nil
+}
+
+// promotionPrice returns the price of the promotion running right now for the
+// product or variant, preferring one set for the exact variant.
+func (r *Repo) promotionPrice(
+	ctx context.Context,
+	productId uuid.UUID,
+	variantId *uuid.UUID,
+) (int64, bool, error) {
+	q := r.runner(ctx)
+
+	var price int64
+
+	err := q.QueryRow(ctx, `
+		SELECT price
+		FROM merch_shop.promotions
+		WHERE product_id = $1
+		  AND (variant_id IS NULL OR variant_id = $2)
+		  AND starts_at <= now() AND now() < ends_at
+		ORDER BY variant_id IS NULL, price
+		LIMIT 1
+	`, productId, variantId).Scan(&price)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return price, true, nil
+}
+
+// usePromoCode locks the code, checks expiry and both usage caps for the user
+// and counts one more use. Must run inside WithTx.
+func (r *Repo) usePromoCode(
+	ctx context.Context,
+	code string,
+	userId uuid.UUID,
+) (model.PromoCode, error) {
+	q := r.runner(ctx)
+
+	var (
+		c       model.PromoCode
+		expired bool
+	)
+
+	err := q.QueryRow(ctx, `
+		SELECT code, kind, value, max_uses, per_user_limit, expires_at, used_count, created_at,
+		       expires_at IS NOT NULL AND expires_at <= now()
+		FROM merch_shop.promo_codes
+		WHERE code = upper($1)
+		FOR UPDATE
+	`, code).Scan(
+		&c.Code, &c.Kind, &c.Value, &c.MaxUses, &c.PerUserLimit, &c.ExpiresAt, &c.UsedCount,
+		&c.CreatedAt, &expired,
+	)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return c, ErrPromoCodeInvalid
+	case err != nil:
+		return c, fmt.Errorf("get query row sql: %w", err)
+	case expired:
+		return c, ErrPromoCodeInvalid
+	case c.MaxUses != nil && c.UsedCount >= *c.MaxUses:
+		return c, ErrPromoCodeExhausted
+	}
+
+	if c.PerUserLimit != nil {
+		var used int64
+		if err := q.QueryRow(ctx, `
+			SELECT count(*)
+			FROM merch_shop.orders
+			WHERE promo_code = $1 AND user_id = $2 AND status NOT IN ('cancelled', 'refunded')
+		`, c.Code, userId).Scan(&used); err != nil {
+			return c, fmt.Errorf("get query row sql: %w", err)
+		}
+
+		if used >= *c.PerUserLimit {
+			return c, ErrPromoCodeUserLimit
+		}
+	}
+
+	if _, err := q.Exec(ctx, `
+		UPDATE merch_shop.promo_codes SET used_count = used_count + 1 WHERE code = $1
+	`, c.Code); err != nil {
+		return c, fmt.Errorf("exec sql: %w", err)
+	}
+
+	c.UsedCount++
+
+	return c, nil
+}
+
+// releasePromoCode gives back the use taken by an order that was returned.
+func (r *Repo) releasePromoCode(ctx context.Context, code string) error {
+	q := r.runner(ctx)
+
+	if _, err := q.Exec(ctx, `
+		UPDATE merch_shop.promo_codes SET used_count = used_count - 1
+		WHERE code = $1 AND used_count > 0
+	`, code); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// replicaLagCheckEvery is how long a replica lag reading is trusted.
+	replicaLagCheckEvery = time.Second
+	// replicaLagCheckTimeout bounds the lag query, so a stuck replica costs
+	// reads at most this much before they go to the primary.
+	replicaLagCheckTimeout = 500 * time.Millisecond
+)
+
+// replicaLagQuery is how far behind the primary the replica replays, in
+// seconds; 0 once it has replayed everything it received, and on a server
+// that is not a replica at all.
+const replicaLagQuery = `
+	SELECT COALESCE(CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END, 0)::float8`
+
+// replica is a read-only copy of the database that reads may go to while it
+// is no more than maxLag behind.
+type replica struct {
+	db     Runner
+	maxLag time.Duration
+	now    func() time.Time
+	// probe runs a lag check; it starts a goroutine, so reads never wait
+	// for one.
+	probe func(check func())
+
+	checkedAt atomic.Int64 // UnixNano of the last reading
+	fresh     atomic.Bool
+	checking  atomic.Bool
+}
+
+// WithReplica sends the reads that do not need the latest data, like order
+// and transfer history, to replica instead of the primary. Once replica lags
+// more than maxLag behind, or its lag cannot be read, they go back to the
+// primary until it catches up; maxLag 0 never checks the lag.
+func WithReplica(replica Runner, maxLag time.Duration) Option {
+	return func(r *Repo) {
+		r.replica = newReplica(replica, maxLag)
+	}
+}
+
+func newReplica(db Runner, maxLag time.Duration) *replica {
+	return &replica{
+		db:     db,
+		maxLag: maxLag,
+		now:    time.Now,
+		probe:  func(check func()) { go check() },
+	}
+}
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads makes every read made with ctx go to the primary, for
+// callers that must see what they have just written.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// RecentWrites remembers whose data changed lately, so that their own reads
+// go to the primary until a replica within maxLag has surely caught up.
+// Everyone else's reads of the same data may lag by up to maxLag.
+type RecentWrites struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu sync.Mutex
+	at map[uuid.UUID]time.Time
+}
+
+// NewRecentWrites keeps a write for window; pass the replica's maxLag, with a
+// margin for the time between the commit and Mark.
+func NewRecentWrites(window time.Duration) *RecentWrites {
+	return &RecentWrites{window: window, now: time.Now, at: make(map[uuid.UUID]time.Time)}
+}
+
+// Mark records that the data of the users has just changed.
+func (w *RecentWrites) Mark(userIds ...uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	for id, at := range w.at {
+		if now.Sub(at) >= w.window {
+			delete(w.at, id)
+		}
+	}
+
+	for _, id := range userIds {
+		w.at[id] = now
+	}
+}
+
+// Watch marks the user of an event; it fits events.Broker.Watch, so changes
+// made by other instances and background jobs count too.
+func (w *RecentWrites) Watch(e model.Event) {
+	w.Mark(e.UserID)
+}
+
+// Context is ctx with WithPrimaryReads if the user changed something within
+// the window.
+func (w *RecentWrites) Context(ctx context.Context, userId uuid.UUID) context.Context {
+	w.mu.Lock()
+	at, ok := w.at[userId]
+	recent := ok && w.now().Sub(at) < w.window
+	w.mu.Unlock()
+
+	if recent {
+		return WithPrimaryReads(ctx)
+	}
+
+	return ctx
+}
+
+// reader is runner for reads that may be served by the replica: they go to
+// the transaction in ctx if there is one, else to a fresh enough replica.
+func (r *Repo) reader(ctx context.Context) Runner {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok && tx != nil {
+		return tx
+	}
+
+	if r.replica == nil || ctx.Value(primaryReadsKey{}) != nil || !r.replica.usable() {
+		return r.db
+	}
+
+	return r.replica.db
+}
+
+// usable reports whether the replica was within maxLag when last checked,
+// and has it checked again once the reading is older than
+// replicaLagCheckEvery. Until the first reading comes in it is not usable.
+func (rp *replica) usable() bool {
+	if rp.maxLag <= 0 {
+		return true
+	}
+
+	checkedAt := time.Unix(0, rp.checkedAt.Load())
+	if rp.now().Sub(checkedAt) >= replicaLagCheckEvery && rp.checking.CompareAndSwap(false, true) {
+		rp.probe(rp.check)
+	}
+
+	return rp.fresh.Load()
+}
+
+// check takes a lag reading. It has a context of its own, so that a read
+// whose request went away cannot make the replica look stale.
+func (rp *replica) check() {
+	defer rp.checking.Store(false)
+
+	rp.fresh.Store(rp.lagWithin(context.Background()))
+	rp.checkedAt.Store(rp.now().UnixNano())
+}
+
+func (rp *replica) lagWithin(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, replicaLagCheckTimeout)
+	defer cancel()
+
+	var seconds float64
+	if err := rp.db.QueryRow(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		return false
+	}
+
+	return time.Duration(seconds*float64(time.Second)) <= rp.maxLag
+}
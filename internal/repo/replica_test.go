@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDB answers every query with no rows and counts the queries; as a
+// replica it reports lag for replicaLagQuery.
+type recordingDB struct {
+	fakeDB
+
+	queries   int
+	lagChecks int
+	lag       time.Duration
+	lagErr    error
+}
+
+func (db *recordingDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	db.queries++
+
+	return emptyRows{}, nil
+}
+
+func (db *recordingDB) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	if sql == replicaLagQuery {
+		db.lagChecks++
+
+		return lagRow{lag: db.lag, err: db.lagErr}
+	}
+
+	db.queries++
+
+	return lagRow{err: pgx.ErrNoRows}
+}
+
+func (db *recordingDB) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	db.queries++
+
+	return noUserBatch{}
+}
+
+// noUserBatch answers the first query of a batch with no rows.
+type noUserBatch struct {
+	pgx.BatchResults
+}
+
+func (noUserBatch) QueryRow() pgx.Row { return lagRow{err: pgx.ErrNoRows} }
+func (noUserBatch) Close() error      { return nil }
+
+type emptyRows struct {
+	pgx.Rows
+}
+
+func (emptyRows) Next() bool { return false }
+func (emptyRows) Close()     {}
+func (emptyRows) Err() error { return nil }
+
+type lagRow struct {
+	lag time.Duration
+	err error
+}
+
+func (r lagRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	*dest[0].(*float64) = r.lag.Seconds()
+
+	return nil
+}
+
+func TestReadsGoToReplica(t *testing.T) {
+	t.Parallel()
+
+	primary, replica := &recordingDB{}, &recordingDB{}
+	r := NewRepo(primary, WithReplica(replica, 0))
+	ctx := context.Background()
+	id := uuid.New()
+
+	_, err := r.FindOrdersByUserID(ctx, id)
+	require.NoError(t, err)
+	_, err = r.FindTransfersFromID(ctx, id)
+	require.NoError(t, err)
+	_, err = r.FindTransfersToID(ctx, id)
+	require.NoError(t, err)
+	_, err = r.FindTransfersByUserID(ctx, id, model.TransferFilter{Limit: 10})
+	require.NoError(t, err)
+	_, err = r.FindProductByTitle(ctx, "pen")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Equal(t, 5, replica.queries)
+	require.Zero(t, replica.lagChecks)
+	require.Zero(t, primary.queries)
+
+	// Everything else stays on the primary.
+	_, err = r.FindProductByID(ctx, id)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = r.FindUserByID(ctx, id)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Equal(t, 2, primary.queries)
+	require.Equal(t, 5, replica.queries)
+}
+
+func TestUserInfoSkipsLaggingReplica(t *testing.T) {
+	t.Parallel()
+
+	// The replica reports no lag, yet may not have the write that just
+	// invalidated the cached summary; only the primary surely has it.
+	primary, replica := &recordingDB{}, &recordingDB{}
+	r := NewRepo(primary, WithReplica(replica, 5*time.Second))
+
+	_, err := r.FindUserInfo(context.Background(), uuid.New(), 10)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Equal(t, 1, primary.queries)
+	require.Zero(t, replica.queries)
+	require.Zero(t, replica.lagChecks)
+}
+
+func TestReaderRouting(t *testing.T) {
+	t.Parallel()
+
+	primary, replica := &recordingDB{}, &recordingDB{}
+	r := NewRepo(primary, WithReplica(replica, 0))
+	ctx := context.Background()
+
+	require.Same(t, replica, r.reader(ctx))
+	require.Same(t, primary, r.reader(WithPrimaryReads(ctx)))
+
+	require.NoError(t, r.WithTx(ctx, func(txCtx context.Context) error {
+		require.IsType(t, &fakeTx{}, r.reader(txCtx))
+
+		return nil
+	}, nil))
+
+	require.Same(t, primary, NewRepo(primary).reader(ctx))
+}
+
+func TestReplicaLagFallsBackToPrimary(t *testing.T) {
+	t.Parallel()
+
+	primary, replica := &recordingDB{}, &recordingDB{lag: 2 * time.Second}
+	r := NewRepo(primary, WithReplica(replica, 5*time.Second))
+	ctx := context.Background()
+
+	now := time.Now()
+	r.replica.now = func() time.Time { return now }
+	r.replica.probe = func(check func()) { check() }
+
+	require.Same(t, replica, r.reader(ctx))
+	require.Same(t, replica, r.reader(ctx))
+	require.Equal(t, 1, replica.lagChecks, "the lag is checked once per interval")
+
+	// The replica falls behind, but the last reading is trusted a while longer.
+	replica.lag = 10 * time.Second
+	now = now.Add(replicaLagCheckEvery / 2)
+
+	require.Same(t, replica, r.reader(ctx))
+
+	now = now.Add(replicaLagCheckEvery)
+
+	require.Same(t, primary, r.reader(ctx))
+	require.Equal(t, 2, replica.lagChecks)
+
+	replica.lag, replica.lagErr = 0, errors.New("connection refused")
+	now = now.Add(replicaLagCheckEvery)
+
+	require.Same(t, primary, r.reader(ctx))
+
+	replica.lagErr = nil
+	now = now.Add(replicaLagCheckEvery)
+
+	require.Same(t, replica, r.reader(ctx))
+	require.Equal(t, 4, replica.lagChecks)
+}
+
+// slowLagDB answers the lag query once release is closed.
+type slowLagDB struct {
+	fakeDB
+
+	release chan struct{}
+	ctxErr  error
+}
+
+func (db *slowLagDB) QueryRow(ctx context.Context, _ string, _ ...any) pgx.Row {
+	<-db.release
+	db.ctxErr = ctx.Err()
+
+	return lagRow{}
+}
+
+func TestReplicaLagCheckDoesNotBlockReads(t *testing.T) {
+	t.Parallel()
+
+	primary, replica := &recordingDB{}, &slowLagDB{release: make(chan struct{})}
+	r := NewRepo(primary, WithReplica(replica, 5*time.Second))
+
+	// The request is gone, which must not count against the replica.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Reads go on to the primary while the first lag check hangs.
+	for range 3 {
+		require.Same(t, primary, r.reader(ctx))
+	}
+
+	close(replica.release)
+
+	require.Eventually(t, func() bool {
+		return r.reader(ctx) == replica
+	}, time.Second, time.Millisecond)
+	require.NoError(t, replica.ctxErr)
+}
+
+func TestRecentWrites(t *testing.T) {
+	t.Parallel()
+
+	primary, replica := &recordingDB{}, &recordingDB{}
+	r := NewRepo(primary, WithReplica(replica, 0))
+	ctx := context.Background()
+	writer, other := uuid.New(), uuid.New()
+
+	w := NewRecentWrites(3 * time.Second)
+	now := time.Now()
+	w.now = func() time.Time { return now }
+
+	w.Watch(model.Event{UserID: writer})
+
+	require.Same(t, primary, r.reader(w.Context(ctx, writer)))
+	require.Same(t, replica, r.reader(w.Context(ctx, other)))
+
+	now = now.Add(3 * time.Second)
+
+	require.Same(t, replica, r.reader(w.Context(ctx, writer)))
+
+	w.Mark(other)
+	require.NotContains(t, w.at, writer, "expired writes are dropped")
+	require.Same(t, primary, r.reader(w.Context(ctx, other)))
+}
@@ -4,25 +4,95 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/6ermvH/MerchShop/internal/model"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
 type Repo struct {
-	db DB
+	db            DB
+	transferRules []TransferRule
+	coinTTL       time.Duration
+	retry         RetryPolicy
+	// replica is nil when all reads go to db.
+	replica *replica
 }
 
-func NewRepo(db DB) *Repo {
-	return &Repo{db: db}
+type Option func(*Repo)
+
+// WithTransferRules makes SendCoins check every transfer against rules,
+// in order, inside the transfer transaction.
+func WithTransferRules(rules ...TransferRule) Option {
+	return func(r *Repo) {
+		r.transferRules = append(r.transferRules, rules...)
+	}
+}
+
+// WithCoinTTL makes credited coins expire ttl after they were granted;
+// without it coins never expire.
+func WithCoinTTL(ttl time.Duration) Option {
+	return func(r *Repo) {
+		r.coinTTL = ttl
+	}
+}
+
+func NewRepo(db DB, opts ...Option) *Repo {
+	r := &Repo{db: db, retry: DefaultRetryPolicy()}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 var (
 	ErrTransferToSelf       = errors.New("cannot transfer to self")
 	ErrAmountMustBePositive = errors.New("amount must be positive")
+	ErrVariantRequired      = errors.New("product variant required")
+	ErrUnknownVariant       = errors.New("unknown product variant")
 )
 
-func (r *Repo) SendCoins(ctx context.Context, fromUserId, toUserId uuid.UUID, amount int64) error {
+// SendCoins moves amount coins from one user to another. Both users are
+// locked up front in ID order, so transfers between the same users queue up
+// rather than deadlock, and Read Committed is enough: every later statement
+// sees what the transfers before it committed.
+func (r *Repo) SendCoins(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	note model.TransferNote,
+) error {
+	if err := CheckTransfer(fromUserId, toUserId, amount); err != nil {
+		return err
+	}
+
+	return r.WithTx(ctx, func(txCtx context.Context) error {
+		if err := r.lockUsers(txCtx, fromUserId, toUserId); err != nil {
+			return err
+		}
+
+		from, err := r.withdrawForTransfer(txCtx, fromUserId, toUserId, amount, nil)
+		if err != nil {
+			return err
+		}
+
+		transfer, err := r.CreateTransfer(txCtx, fromUserId, toUserId, amount, note)
+		if err != nil {
+			return err
+		}
+
+		transfer.FromUserName = from.Username
+
+		return r.deliverTransfer(txCtx, transfer)
+	}, nil)
+}
+
+// CheckTransfer rejects transfers no rule could ever allow.
+func CheckTransfer(fromUserId, toUserId uuid.UUID, amount int64) error {
 	if amount <= 0 {
 		return fmt.Errorf("send coins: %w", ErrAmountMustBePositive)
 	}
@@ -31,40 +101,219 @@ func (r *Repo) SendCoins(ctx context.Context, fromUserId, toUserId uuid.UUID, am
 		return fmt.Errorf("send coins: %w", ErrTransferToSelf)
 	}
 
-	return r.WithTx(ctx, func(txCtx context.Context) error {
-		if _, err := r.AddToBalance(txCtx, fromUserId, -amount); err != nil {
-			return err
-		}
+	return nil
+}
+
+// withdrawForTransfer takes amount from the sender and checks the transfer
+// rules, returning the sender as of after the withdrawal. A held transfer
+// passes its id as ref, see spendCoins.
+func (r *Repo) withdrawForTransfer(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+	ref *uuid.UUID,
+) (model.User, error) {
+	from, err := r.changeBalance(ctx, fromUserId, -amount, ref)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	// The sender's row is locked by now, so concurrent transfers from
+	// the same user see each other when counting towards the limits.
+	if err := r.checkTransferRules(ctx, TransferAttempt{
+		From:   from,
+		ToID:   toUserId,
+		Amount: amount,
+	}); err != nil {
+		return model.User{}, err
+	}
+
+	return from, nil
+}
+
+// deliverTransfer credits the recipient with coins already taken from the
+// sender and tells the recipient about it.
+func (r *Repo) deliverTransfer(ctx context.Context, t model.Transfer) error {
+	if _, err := r.AddToBalance(ctx, t.ToUserID, +t.Amount); err != nil {
+		return err
+	}
+
+	if err := r.publishEvent(ctx, t.ToUserID, model.EventTransfer, map[string]any{
+		"transferId": t.ID.String(),
+		"from":       t.FromUserName,
+		"amount":     t.Amount,
+		"memo":       t.Memo,
+		"category":   t.Category,
+	}); err != nil {
+		return err
+	}
 
-		if _, err := r.AddToBalance(txCtx, toUserId, +amount); err != nil {
+	return r.notify(ctx, model.Notification{
+		UserID:  t.ToUserID,
+		Kind:    model.NotificationCoinsReceived,
+		Message: fmt.Sprintf("%s sent you %d coins", t.FromUserName, t.Amount),
+		Data: map[string]string{
+			"transferId": t.ID.String(),
+			"from":       t.FromUserName,
+			"amount":     strconv.FormatInt(t.Amount, 10),
+		},
+	})
+}
+
+// AdjustBalance is an admin correction of a user's balance by delta coins;
+// the user is notified with the reason.
+func (r *Repo) AdjustBalance(
+	ctx context.Context,
+	userId uuid.UUID,
+	delta int64,
+	reason string,
+) (model.User, error) {
+	var user model.User
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		var err error
+		if user, err = r.AddToBalance(txCtx, userId, delta); err != nil {
 			return err
 		}
 
-		_, err := r.CreateTransfer(txCtx, fromUserId, toUserId, amount)
+		message := fmt.Sprintf("Your balance was adjusted by %+d coins", delta)
+		if reason != "" {
+			message += ": " + reason
+		}
 
-		return err
+		return r.notify(txCtx, model.Notification{
+			UserID:  userId,
+			Kind:    model.NotificationBalanceAdjusted,
+			Message: message,
+			Data: map[string]string{
+				"delta":  strconv.FormatInt(delta, 10),
+				"reason": reason,
+			},
+		})
 	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return user, err
 }
 
+// BuyProduct charges the user for one item of the product. Products with
+// variants require Variant to be the SKU or ID of one of them. The price is
+// the running promotion price, if any, less the promo code discount.
 func (r *Repo) BuyProduct(
 	ctx context.Context,
 	userId uuid.UUID,
-	productTitle string,
-) error {
-	return r.WithTx(ctx, func(txCtx context.Context) error {
-		product, err := r.FindProductByTitle(txCtx, productTitle)
+	purchase model.Purchase,
+) (model.Order, error) {
+	var order model.Order
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		product, err := r.FindProductByTitle(txCtx, purchase.Product)
 		if err != nil {
 			return err
 		}
 
-		if _, err := r.AddToBalance(txCtx, userId, -product.Price); err != nil {
+		variants, err := r.FindVariantsByProductID(txCtx, product.ID)
+		if err != nil {
 			return err
 		}
 
-		if _, err := r.CreateOrder(txCtx, userId, product.ID); err != nil {
+		chosen, err := PickVariant(variants, purchase.Variant)
+		if err != nil {
 			return err
 		}
 
-		return nil
+		order = model.Order{
+			ID:           uuid.New(),
+			UserID:       userId,
+			ProductID:    product.ID,
+			ProductTitle: product.Title,
+			ProductPrice: product.Price,
+			Count:        1,
+		}
+		if chosen != nil {
+			order.VariantID = &chosen.ID
+			order.VariantSKU = chosen.SKU
+			order.ProductPrice = chosen.PriceOr(product.Price)
+		}
+
+		order.PricePaid = order.ProductPrice
+
+		if err := r.applyDiscounts(txCtx, &order, purchase.PromoCode); err != nil {
+			return err
+		}
+
+		if _, err := r.spendCoins(txCtx, userId, order.PricePaid, order.ID); err != nil {
+			return err
+		}
+
+		if chosen != nil {
+			err = r.AddToVariantStock(txCtx, chosen.ID, -1)
+		} else {
+			err = r.AddToStock(txCtx, product.ID, -1)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		order, err = r.CreateOrder(txCtx, order)
+
+		return err
 	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return order, err
+}
+
+func (r *Repo) applyDiscounts(ctx context.Context, order *model.Order, promoCode string) error {
+	price, ok, err := r.promotionPrice(ctx, order.ProductID, order.VariantID)
+	if err != nil {
+		return err
+	}
+
+	// A product-wide promotion may sit above a cheap variant's own price.
+	if ok {
+		order.PricePaid = min(order.PricePaid, price)
+	}
+
+	if promoCode = strings.TrimSpace(promoCode); promoCode == "" {
+		return nil
+	}
+
+	code, err := r.usePromoCode(ctx, promoCode, order.UserID)
+	if err != nil {
+		return err
+	}
+
+	order.PricePaid = code.Apply(order.PricePaid)
+	order.PromoCode = code.Code
+
+	return nil
+}
+
+// PickVariant finds the variant a purchase names by SKU or ID, or the
+// default one when it names none; it is nil for products without variants.
+func PickVariant(variants []model.ProductVariant, key string) (*model.ProductVariant, error) {
+	key = strings.TrimSpace(key)
+
+	switch {
+	case len(variants) == 0 && key == "":
+		return nil, nil //nolint:nilnil
+	case len(variants) == 0:
+		return nil, ErrUnknownVariant
+	case key == "":
+		for i := range variants {
+			if variants[i].Default {
+				return &variants[i], nil
+			}
+		}
+
+		return nil, ErrVariantRequired
+	}
+
+	for i := range variants {
+		if strings.EqualFold(variants[i].SKU, key) || variants[i].ID.String() == key {
+			return &variants[i], nil
+		}
+	}
+
+	return nil, ErrUnknownVariant
 }
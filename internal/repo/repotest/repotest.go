@@ -0,0 +1,976 @@
+// Package repotest is the behaviour every repo.MerchRepo must share, written
+// once and run against both the Postgres and the in-memory implementation.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// day is how far from now the suite puts the times it hands the repo, so
+// they stay in the past or future whatever time zone Postgres stores its
+// timestamps in.
+const day = 24 * time.Hour
+
+// Harness is a fresh repo holding only the catalog the migrations seed.
+type Harness struct {
+	Repo repo.MerchRepo
+	// SetStock makes a product stock-tracked with stock items left; the
+	// repo interface has no way to do that.
+	SetStock func(tb testing.TB, productId uuid.UUID, stock int64)
+	// SetVariantPrice gives a variant a price of its own.
+	SetVariantPrice func(tb testing.TB, variantId uuid.UUID, price int64)
+	// CheckCoins, if set, checks that whatever else the implementation
+	// keeps track of coins in agrees that the users hold want coins; the
+	// concurrent tests call it last.
+	CheckCoins func(tb testing.TB, users []uuid.UUID, want int64)
+}
+
+// Run runs the suite, calling newHarness once per test.
+func Run(t *testing.T, newHarness func(t *testing.T) Harness) {
+	t.Helper()
+
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, h Harness)
+	}{
+		{"Users", testUsers},
+		{"SendCoins", testSendCoins},
+		{"PendingTransfers", testPendingTransfers},
+		{"Catalog", testCatalog},
+		{"BuyProduct", testBuyProduct},
+		{"BuyVariant", testBuyVariant},
+		{"PromoCodes", testPromoCodes},
+		{"Orders", testOrders},
+		{"UserInfo", testUserInfo},
+		{"Wishlist", testWishlist},
+		{"Leaderboard", testLeaderboard},
+		{"ScheduledTransfers", testScheduledTransfers},
+		{"ConcurrentSendCoins", testConcurrentSendCoins},
+		{"ConcurrentBuyProduct", testConcurrentBuyProduct},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.test(t, newHarness(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+
+	u, err := r.CreateUser(ctx, "alice", "hash")
+	require.NoError(t, err)
+	require.Zero(t, u.Balance)
+	require.Equal(t, model.RoleUser, u.Role)
+
+	_, err = r.CreateUser(ctx, "alice", "hash")
+	require.Error(t, err)
+
+	byName, err := r.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, u.ID, byName.ID)
+
+	_, err = r.FindUserByUsername(ctx, "bob")
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	_, err = r.FindUserByID(ctx, uuid.New())
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	u, err = r.AdjustBalance(ctx, u.ID, 100, "welcome")
+	require.NoError(t, err)
+	require.EqualValues(t, 100, u.Balance)
+
+	_, err = r.AddToBalance(ctx, u.ID, -101)
+	require.ErrorIs(t, err, repo.ErrInsufficient)
+
+	u, err = r.AddToBalance(ctx, u.ID, -40)
+	require.NoError(t, err)
+	require.EqualValues(t, 60, u.Balance)
+
+	notes, err := r.FindNotifications(ctx, u.ID, model.NotificationFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	require.Equal(t, model.NotificationBalanceAdjusted, notes[0].Kind)
+	require.Equal(t, "Your balance was adjusted by +100 coins: welcome", notes[0].Message)
+
+	require.NoError(t, r.SetMutedNotificationKinds(ctx, u.ID, []model.NotificationKind{
+		model.NotificationBalanceAdjusted,
+	}))
+
+	_, err = r.AdjustBalance(ctx, u.ID, 1, "")
+	require.NoError(t, err)
+
+	unread, err := r.CountUnreadNotifications(ctx, u.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, unread)
+
+	marked, err := r.MarkNotificationsRead(ctx, u.ID, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, marked)
+
+	events, err := r.FindEventsSince(ctx, u.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, model.EventBalance, events[0].Type)
+	require.Less(t, events[0].ID, events[2].ID)
+}
+
+func testSendCoins(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+	alice, bob := users[0], users[1]
+
+	note := model.TransferNote{Memo: "lunch", Category: "thanks"}
+	require.NoError(t, r.SendCoins(ctx, alice, bob, 30, note))
+
+	require.ErrorIs(t, r.SendCoins(ctx, alice, bob, 71, note), repo.ErrInsufficient)
+	require.ErrorIs(t, r.SendCoins(ctx, alice, uuid.New(), 1, note), repo.ErrNotFound)
+	require.ErrorIs(t, r.SendCoins(ctx, alice, alice, 1, note), repo.ErrTransferToSelf)
+	require.ErrorIs(t, r.SendCoins(ctx, alice, bob, 0, note), repo.ErrAmountMustBePositive)
+
+	transfers, err := r.FindTransfersByUserID(ctx, bob, model.TransferFilter{
+		Direction: model.TransferDirectionReceived,
+		Limit:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, alice, transfers[0].FromUserID)
+	require.EqualValues(t, 30, transfers[0].Amount)
+	require.Equal(t, "lunch", transfers[0].Memo)
+	require.Equal(t, "thanks", transfers[0].Category)
+	require.Equal(t, model.TransferAccepted, transfers[0].Status)
+
+	sent, err := r.FindTransfersByUserID(ctx, bob, model.TransferFilter{
+		Direction: model.TransferDirectionSent,
+		Limit:     10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, sent)
+
+	from, err := r.FindTransfersFromID(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, from, 1)
+	require.Equal(t, transfers[0].ToUserName, from[0].ToUserName)
+
+	notes, err := r.FindNotifications(ctx, bob, model.NotificationFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, model.NotificationCoinsReceived, notes[0].Kind)
+	require.Equal(t, "30", notes[0].Data["amount"])
+
+	requireBalance(t, r, alice, 70)
+	requireBalance(t, r, bob, 130)
+}
+
+func testPendingTransfers(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+	alice, bob := users[0], users[1]
+
+	accepted, err := r.SendPendingCoins(ctx, alice, bob, 10, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, model.TransferPending, accepted.Status)
+	require.NotNil(t, accepted.ExpiresAt)
+	requireBalance(t, r, alice, 90)
+	requireBalance(t, r, bob, 100)
+
+	_, err = r.AcceptTransfer(ctx, alice, accepted.ID)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	_, err = r.AcceptTransfer(ctx, bob, accepted.ID)
+	require.NoError(t, err)
+	requireBalance(t, r, bob, 110)
+
+	_, err = r.DeclineTransfer(ctx, bob, accepted.ID)
+	require.ErrorIs(t, err, repo.ErrTransferNotPending)
+
+	declined, err := r.SendPendingCoins(ctx, alice, bob, 20, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+
+	_, err = r.DeclineTransfer(ctx, bob, declined.ID)
+	require.NoError(t, err)
+	requireBalance(t, r, alice, 90)
+
+	// A transfer that expired the moment it was sent.
+	expired, err := r.SendPendingCoins(ctx, alice, bob, 5, model.TransferNote{}, -time.Minute)
+	require.NoError(t, err)
+	requireBalance(t, r, alice, 85)
+
+	_, err = r.AcceptTransfer(ctx, bob, expired.ID)
+	require.ErrorIs(t, err, repo.ErrTransferNotPending)
+
+	n, err := r.ExpireTransfers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	requireBalance(t, r, alice, 90)
+
+	notes, err := r.FindNotifications(ctx, alice, model.NotificationFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, model.NotificationTransferReturned, notes[0].Kind)
+	require.Equal(t, string(model.TransferExpired), notes[0].Data["status"])
+
+	all, err := r.FindTransfersByUserID(ctx, alice, model.TransferFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+
+	statuses := map[model.TransferStatus]int{}
+	for _, tr := range all {
+		statuses[tr.Status]++
+	}
+
+	require.Equal(t, map[model.TransferStatus]int{
+		model.TransferAccepted: 1,
+		model.TransferDeclined: 1,
+		model.TransferExpired:  1,
+	}, statuses)
+}
+
+func testCatalog(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+
+	products, err := r.FindProducts(ctx, model.ProductFilter{Sort: model.ProductSortPrice, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, products, 10)
+	require.Equal(t, "pen", products[0].Title)
+	require.Equal(t, "socks", products[1].Title)
+	require.Equal(t, "pink-hoody", products[9].Title)
+
+	maxPrice := int64(50)
+	cheap, err := r.FindProducts(ctx, model.ProductFilter{
+		MaxPrice: &maxPrice,
+		Sort:     model.ProductSortNameDesc,
+		Limit:    2,
+		Offset:   1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"socks", "pen"}, titles(cheap))
+
+	hoodies, err := r.FindProducts(ctx, model.ProductFilter{Query: "HOODY", Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hoody", "pink-hoody"}, titles(hoodies))
+
+	shirt, err := r.FindProductByTitle(ctx, "T-Shirt")
+	require.NoError(t, err)
+	require.Equal(t, "t-shirt", shirt.Title)
+	require.True(t, shirt.Available)
+
+	variants, err := r.FindVariantsByProductID(ctx, shirt.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 4)
+	require.Equal(t, "t-shirt-l", variants[0].SKU)
+	require.Equal(t, "L", variants[0].Attributes["size"])
+
+	_, err = r.FindProductByID(ctx, uuid.New())
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	price := int64(70)
+	updated, err := r.UpdateProduct(ctx, shirt.ID, model.ProductUpdate{Price: &price})
+	require.NoError(t, err)
+	require.EqualValues(t, 70, updated.Price)
+
+	require.ErrorIs(t, r.SetProductPrice(ctx, uuid.New(), 1), repo.ErrNotFound)
+}
+
+func testBuyProduct(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	buyer := seedUsers(t, r, 1, 50)[0]
+
+	cup, err := r.FindProductByTitle(ctx, "cup")
+	require.NoError(t, err)
+	h.SetStock(t, cup.ID, 1)
+
+	order, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "cup"})
+	require.NoError(t, err)
+	require.Equal(t, cup.ID, order.ProductID)
+	require.Equal(t, "cup", order.ProductTitle)
+	require.EqualValues(t, 20, order.PricePaid)
+	require.EqualValues(t, 1, order.Count)
+	require.Equal(t, model.OrderStatusPlaced, order.Status)
+	requireBalance(t, r, buyer, 30)
+
+	// The charge comes before the stock check, so this one has to be rolled back.
+	_, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "cup"})
+	require.ErrorIs(t, err, repo.ErrOutOfStock)
+	requireBalance(t, r, buyer, 30)
+
+	_, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "powerbank"})
+	require.ErrorIs(t, err, repo.ErrInsufficient)
+
+	_, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "no-such-product"})
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	cup, err = r.FindProductByID(ctx, cup.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, *cup.Stock)
+	require.False(t, cup.Available)
+
+	orders, err := r.FindOrdersByUserID(ctx, buyer)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, order.ID, orders[0].ID)
+	requireBalance(t, r, buyer, 30)
+}
+
+func testBuyVariant(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	buyer := seedUsers(t, r, 1, 350)[0]
+
+	_, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "t-shirt", Variant: "t-shirt-xxl"})
+	require.ErrorIs(t, err, repo.ErrUnknownVariant)
+
+	_, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "cup", Variant: "cup-m"})
+	require.ErrorIs(t, err, repo.ErrUnknownVariant)
+
+	order, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "t-shirt", Variant: "T-SHIRT-M"})
+	require.NoError(t, err)
+	require.Equal(t, "t-shirt-m", order.VariantSKU)
+	require.NotNil(t, order.VariantID)
+	require.EqualValues(t, 80, order.PricePaid)
+
+	// A promotion for the variant beats the one for the whole product.
+	_, err = r.CreatePromotion(ctx, model.Promotion{
+		ProductID: order.ProductID,
+		Price:     60,
+		StartsAt:  time.Now().Add(-day),
+		EndsAt:    time.Now().Add(day),
+	})
+	require.NoError(t, err)
+
+	_, err = r.CreatePromotion(ctx, model.Promotion{
+		ProductID: order.ProductID,
+		VariantID: order.VariantID,
+		Price:     65,
+		StartsAt:  time.Now().Add(-day),
+		EndsAt:    time.Now().Add(day),
+	})
+	require.NoError(t, err)
+
+	order, err = r.BuyProduct(ctx, buyer, model.Purchase{
+		Product: "t-shirt",
+		Variant: order.VariantID.String(),
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 65, order.PricePaid)
+	require.EqualValues(t, 80, order.ProductPrice)
+
+	order, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "t-shirt", Variant: "t-shirt-s"})
+	require.NoError(t, err)
+	require.EqualValues(t, 60, order.PricePaid)
+
+	// Without a variant, as v1 clients buy, the default one is sold.
+	order, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "t-shirt"})
+	require.NoError(t, err)
+	require.Equal(t, "t-shirt-m", order.VariantSKU)
+	require.EqualValues(t, 65, order.PricePaid)
+
+	// The product-wide promotion never makes a cheaper variant dearer.
+	variants, err := r.FindVariantsByProductID(ctx, order.ProductID)
+	require.NoError(t, err)
+
+	i := slices.IndexFunc(variants, func(v model.ProductVariant) bool { return v.SKU == "t-shirt-l" })
+	require.NotEqual(t, -1, i)
+	h.SetVariantPrice(t, variants[i].ID, 40)
+
+	order, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "t-shirt", Variant: "t-shirt-l"})
+	require.NoError(t, err)
+	require.EqualValues(t, 40, order.PricePaid)
+	requireBalance(t, r, buyer, 350-80-65-60-65-40)
+}
+
+func testPromoCodes(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+
+	maxUses := int64(1)
+	code, err := r.CreatePromoCode(ctx, model.PromoCode{
+		Code:    "save10",
+		Kind:    model.PromoCodePercent,
+		Value:   10,
+		MaxUses: &maxUses,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "SAVE10", code.Code)
+
+	_, err = r.CreatePromoCode(ctx, model.PromoCode{Code: "SAVE10", Kind: model.PromoCodeFixed, Value: 1})
+	require.ErrorIs(t, err, repo.ErrPromoCodeExists)
+
+	_, err = r.BuyProduct(ctx, users[0], model.Purchase{Product: "book", PromoCode: "nope"})
+	require.ErrorIs(t, err, repo.ErrPromoCodeInvalid)
+
+	order, err := r.BuyProduct(ctx, users[0], model.Purchase{Product: "book", PromoCode: "save10"})
+	require.NoError(t, err)
+	require.EqualValues(t, 45, order.PricePaid)
+	require.Equal(t, "SAVE10", order.PromoCode)
+
+	_, err = r.BuyProduct(ctx, users[1], model.Purchase{Product: "book", PromoCode: "save10"})
+	require.ErrorIs(t, err, repo.ErrPromoCodeExhausted)
+	requireBalance(t, r, users[1], 100)
+
+	// Refunding the order gives the use back.
+	_, err = r.RefundOrder(ctx, order.ID)
+	require.NoError(t, err)
+
+	order, err = r.BuyProduct(ctx, users[1], model.Purchase{Product: "book", PromoCode: "save10"})
+	require.NoError(t, err)
+	require.EqualValues(t, 45, order.PricePaid)
+	requireBalance(t, r, users[0], 100)
+	requireBalance(t, r, users[1], 55)
+}
+
+func testOrders(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 100)
+	buyer := users[0]
+
+	pen, err := r.FindProductByTitle(ctx, "pen")
+	require.NoError(t, err)
+	h.SetStock(t, pen.ID, 5)
+
+	cancelled, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "pen"})
+	require.NoError(t, err)
+
+	_, err = r.CancelOrder(ctx, users[1], cancelled.ID, time.Hour)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	_, err = r.CancelOrder(ctx, buyer, cancelled.ID, 0)
+	require.ErrorIs(t, err, repo.ErrCancelWindowExpired)
+
+	cancelled, err = r.CancelOrder(ctx, buyer, cancelled.ID, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusCancelled, cancelled.Status)
+	require.NotNil(t, cancelled.Timeline.CancelledAt)
+	requireBalance(t, r, buyer, 100)
+
+	_, err = r.CancelOrder(ctx, buyer, cancelled.ID, time.Hour)
+	require.ErrorIs(t, err, repo.ErrOrderNotCancellable)
+
+	delivered, err := r.BuyProduct(ctx, buyer, model.Purchase{Product: "pen"})
+	require.NoError(t, err)
+
+	_, err = r.AdvanceOrder(ctx, delivered.ID, model.OrderStatusDelivered)
+	require.ErrorIs(t, err, repo.ErrBadOrderTransition)
+
+	for _, next := range []model.OrderStatus{
+		model.OrderStatusPacked, model.OrderStatusReadyForPickup, model.OrderStatusDelivered,
+	} {
+		delivered, err = r.AdvanceOrder(ctx, delivered.ID, next)
+		require.NoError(t, err)
+		require.Equal(t, next, delivered.Status)
+	}
+
+	require.NotNil(t, delivered.Timeline.PackedAt)
+	require.NotNil(t, delivered.Timeline.DeliveredAt)
+
+	_, err = r.CancelOrder(ctx, buyer, delivered.ID, time.Hour)
+	require.ErrorIs(t, err, repo.ErrOrderNotCancellable)
+
+	refunded, err := r.RefundOrder(ctx, delivered.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusRefunded, refunded.Status)
+	requireBalance(t, r, buyer, 100)
+
+	// The delivered pen stays with the buyer.
+	pen, err = r.FindProductByID(ctx, pen.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *pen.Stock)
+
+	_, err = r.RefundOrder(ctx, delivered.ID)
+	require.ErrorIs(t, err, repo.ErrOrderNotRefundable)
+
+	_, err = r.AdvanceOrder(ctx, uuid.New(), model.OrderStatusPacked)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	_, err = r.BuyProduct(ctx, buyer, model.Purchase{Product: "pen"})
+	require.NoError(t, err)
+
+	pen, err = r.FindProductByID(ctx, pen.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, *pen.Stock)
+	requireBalance(t, r, buyer, 90)
+
+	orders, err := r.FindOrdersByUserID(ctx, buyer)
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+
+	returned, err := r.FindOrders(ctx, model.OrderFilter{
+		Status:  model.OrderStatusRefunded,
+		Product: "PEN",
+		Limit:   10,
+	})
+	require.NoError(t, err)
+	require.Len(t, returned, 1)
+	require.Equal(t, delivered.ID, returned[0].ID)
+	require.Equal(t, refunded.UserName, returned[0].UserName)
+
+	notes, err := r.FindNotifications(ctx, buyer, model.NotificationFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, model.NotificationOrderStatus, notes[0].Kind)
+	require.Equal(t, "Your pen order is refunded", notes[0].Message)
+
+	stats, err := r.FindUserStats(ctx, buyer)
+	require.NoError(t, err)
+	require.Equal(t, "pen", stats.FavouriteProduct)
+}
+
+func testUserInfo(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 500)
+	alice, bob := users[0], users[1]
+
+	for _, p := range []model.Purchase{
+		{Product: "pen"},
+		{Product: "t-shirt", Variant: "t-shirt-m"},
+		{Product: "pen"},
+	} {
+		_, err := r.BuyProduct(ctx, alice, p)
+		require.NoError(t, err)
+	}
+
+	cup, err := r.BuyProduct(ctx, alice, model.Purchase{Product: "cup"})
+	require.NoError(t, err)
+
+	_, err = r.CancelOrder(ctx, alice, cup.ID, time.Hour)
+	require.NoError(t, err)
+
+	for _, amount := range []int64{1, 2, 3} {
+		require.NoError(t, r.SendCoins(ctx, alice, bob, amount, model.TransferNote{}))
+	}
+
+	require.NoError(t, r.SendCoins(ctx, bob, alice, 5, model.TransferNote{Memo: "back"}))
+
+	info, err := r.FindUserInfo(ctx, alice, 2)
+	require.NoError(t, err)
+
+	u, err := r.FindUserByID(ctx, alice)
+	require.NoError(t, err)
+	require.Equal(t, u.Balance, info.Balance)
+
+	require.Len(t, info.Inventory, 2)
+	require.Equal(t, model.InventoryItem{
+		ProductTitle: "pen", Count: 2, AcquiredAt: info.Inventory[0].AcquiredAt,
+	}, info.Inventory[0])
+	require.Equal(t, model.InventoryItem{
+		ProductTitle: "t-shirt", VariantSKU: "t-shirt-m", Count: 1, AcquiredAt: info.Inventory[1].AcquiredAt,
+	}, info.Inventory[1])
+
+	require.Len(t, info.Orders, 2)
+	require.Equal(t, cup.ID, info.Orders[0].ID)
+	require.Equal(t, model.OrderStatusCancelled, info.Orders[0].Status)
+
+	// The second pen was the last purchase before the cup.
+	require.Equal(t, info.Orders[1].CreatedAt, info.Inventory[0].AcquiredAt)
+
+	require.Len(t, info.Sent, 2)
+	require.EqualValues(t, 3, info.Sent[0].Amount)
+	require.EqualValues(t, 2, info.Sent[1].Amount)
+
+	sender, err := r.FindUserByID(ctx, bob)
+	require.NoError(t, err)
+	require.Len(t, info.Received, 1)
+	require.Equal(t, sender.Username, info.Received[0].FromUserName)
+	require.Equal(t, "back", info.Received[0].Memo)
+
+	sent, err := r.FindTransfersFromID(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, sent, 3)
+
+	for i, want := range []int64{3, 2, 1} {
+		require.Equal(t, want, sent[i].Amount)
+	}
+
+	_, err = r.FindUserInfo(ctx, uuid.New(), 2)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+}
+
+func testWishlist(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	user := seedUsers(t, r, 1, 0)[0]
+
+	umbrella, err := r.FindProductByTitle(ctx, "umbrella")
+	require.NoError(t, err)
+	h.SetStock(t, umbrella.ID, 0)
+
+	require.NoError(t, r.AddToWishlist(ctx, user, umbrella.ID))
+	require.NoError(t, r.AddToWishlist(ctx, user, umbrella.ID))
+	require.ErrorIs(t, r.AddToWishlist(ctx, user, uuid.New()), repo.ErrNotFound)
+
+	require.NoError(t, r.SetProductPrice(ctx, umbrella.ID, 150))
+	require.NoError(t, r.SetProductPrice(ctx, umbrella.ID, 175))
+
+	_, err = r.UpdateProduct(ctx, umbrella.ID, model.ProductUpdate{Restock: 3})
+	require.NoError(t, err)
+
+	items, err := r.FindWishlist(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.EqualValues(t, 175, items[0].Price)
+	require.True(t, items[0].Product.Available)
+
+	notes, err := r.FindNotifications(ctx, user, model.NotificationFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, notes, 2)
+	require.Equal(t, model.NotificationBackInStock, notes[0].Kind)
+	require.Equal(t, model.NotificationPriceDrop, notes[1].Kind)
+	require.Equal(t, "umbrella is now 150 coins, was 200", notes[1].Message)
+
+	// Only the running promotion that undercuts the wishlist price notifies.
+	now := time.Now()
+	for _, promo := range []model.Promotion{
+		{ProductID: umbrella.ID, Price: 100, StartsAt: now.Add(day), EndsAt: now.Add(2 * day)},
+		{ProductID: umbrella.ID, Price: 180, StartsAt: now.Add(-day), EndsAt: now.Add(day)},
+		{ProductID: umbrella.ID, Price: 120, StartsAt: now.Add(-day), EndsAt: now.Add(day)},
+		{ProductID: umbrella.ID, Price: 130, StartsAt: now.Add(-day), EndsAt: now.Add(day)},
+	} {
+		_, err = r.CreatePromotion(ctx, promo)
+		require.NoError(t, err)
+	}
+
+	items, err = r.FindWishlist(ctx, user)
+	require.NoError(t, err)
+	require.EqualValues(t, 120, items[0].Price)
+
+	notes, err = r.FindNotifications(ctx, user, model.NotificationFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, notes, 3)
+	require.Equal(t, "umbrella is now 120 coins, was 175", notes[0].Message)
+	require.Equal(t, "120", notes[0].Data["price"])
+
+	require.NoError(t, r.RemoveFromWishlist(ctx, user, umbrella.ID))
+	require.ErrorIs(t, r.RemoveFromWishlist(ctx, user, umbrella.ID), repo.ErrNotFound)
+}
+
+func testLeaderboard(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 3, 100)
+
+	require.NoError(t, r.SendCoins(ctx, users[0], users[1], 30, model.TransferNote{}))
+	require.NoError(t, r.SendCoins(ctx, users[0], users[2], 10, model.TransferNote{}))
+	require.NoError(t, r.SendCoins(ctx, users[1], users[2], 50, model.TransferNote{}))
+
+	// Pending transfers do not count until they are accepted.
+	_, err := r.SendPendingCoins(ctx, users[2], users[0], 90, model.TransferNote{}, time.Hour)
+	require.NoError(t, err)
+
+	board, err := r.FindLeaderboard(ctx, model.LeaderboardAll, 10)
+	require.NoError(t, err)
+	require.Len(t, board.TopReceivers, 2)
+	require.EqualValues(t, 60, board.TopReceivers[0].Amount)
+	require.EqualValues(t, 2, board.TopReceivers[0].Count)
+	require.Len(t, board.TopSenders, 2)
+	require.EqualValues(t, 50, board.TopSenders[0].Amount)
+	require.EqualValues(t, 2, board.MostGenerous[0].Amount)
+
+	require.NoError(t, r.SetLeaderboardOptOut(ctx, users[2], true))
+
+	board, err = r.FindLeaderboard(ctx, model.LeaderboardAll, 1)
+	require.NoError(t, err)
+	require.Len(t, board.TopReceivers, 1)
+	require.EqualValues(t, 30, board.TopReceivers[0].Amount)
+
+	board, err = r.FindLeaderboard(ctx, model.LeaderboardWeek, 10)
+	require.NoError(t, err)
+	require.Len(t, board.TopSenders, 2)
+
+	stats, err := r.FindUserStats(ctx, users[0])
+	require.NoError(t, err)
+	require.EqualValues(t, 40, stats.Sent)
+	require.EqualValues(t, 2, stats.SentCount)
+	require.Zero(t, stats.Received)
+	require.EqualValues(t, 2, stats.Counterparties)
+	require.Empty(t, stats.FavouriteProduct)
+
+	_, err = r.FindUserStats(ctx, uuid.New())
+	require.ErrorIs(t, err, repo.ErrNotFound)
+}
+
+func testScheduledTransfers(t *testing.T, h Harness) {
+	r := h.Repo
+	ctx := context.Background()
+	users := seedUsers(t, r, 2, 25)
+	alice, bob := users[0], users[1]
+	due := time.Now().Add(-day)
+
+	_, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: alice, ToUserID: alice, Amount: 1, NextRunAt: &due,
+	})
+	require.ErrorIs(t, err, repo.ErrTransferToSelf)
+
+	once, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: alice, ToUserID: bob, Amount: 20, NextRunAt: &due,
+	})
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduleActive, once.Status)
+	require.Nil(t, once.LastRun)
+
+	// Alice cannot afford this one after the first has run.
+	broke, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: alice, ToUserID: bob, Amount: 20, NextRunAt: &due,
+	})
+	require.NoError(t, err)
+
+	paused, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: alice, ToUserID: bob, Amount: 1, Recurrence: "0 9 * * *", NextRunAt: &due,
+	})
+	require.NoError(t, err)
+
+	paused, err = r.SetScheduledTransferStatus(ctx, alice, paused.ID, model.SchedulePaused)
+	require.NoError(t, err)
+	require.Equal(t, model.SchedulePaused, paused.Status)
+
+	_, err = r.SetScheduledTransferStatus(ctx, bob, paused.ID, model.ScheduleCancelled)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	_, err = r.SetScheduledTransferStatus(ctx, alice, paused.ID, model.SchedulePaused)
+	require.ErrorIs(t, err, repo.ErrScheduleTransition)
+
+	n, err := r.RunDueScheduledTransfers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+	requireBalance(t, r, alice, 5)
+	requireBalance(t, r, bob, 45)
+
+	schedules, err := r.FindScheduledTransfers(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, schedules, 3)
+
+	byID := map[uuid.UUID]model.ScheduledTransfer{}
+	for _, s := range schedules {
+		byID[s.ID] = s
+	}
+
+	require.Equal(t, model.ScheduleCompleted, byID[once.ID].Status)
+	require.Nil(t, byID[once.ID].NextRunAt)
+	require.Equal(t, model.ScheduledRunSucceeded, byID[once.ID].LastRun.Status)
+	require.Equal(t, model.ScheduledRunSkipped, byID[broke.ID].LastRun.Status)
+	require.Nil(t, byID[paused.ID].LastRun)
+
+	// Resuming skips the run missed while paused.
+	resumed, err := r.SetScheduledTransferStatus(ctx, alice, paused.ID, model.ScheduleActive)
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduleActive, resumed.Status)
+	require.NotNil(t, resumed.NextRunAt)
+
+	n, err = r.RunDueScheduledTransfers(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	cancelled, err := r.SetScheduledTransferStatus(ctx, alice, paused.ID, model.ScheduleCancelled)
+	require.NoError(t, err)
+	require.Nil(t, cancelled.NextRunAt)
+
+	// An hourly schedule a few days behind runs once, not once per missed hour.
+	behind := time.Now().Add(-3 * day)
+	hourly, err := r.CreateScheduledTransfer(ctx, model.ScheduledTransfer{
+		FromUserID: bob, ToUserID: alice, Amount: 1, Recurrence: "0 * * * *", NextRunAt: &behind,
+	})
+	require.NoError(t, err)
+
+	for _, want := range []int64{1, 0} {
+		n, err = r.RunDueScheduledTransfers(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, n)
+	}
+
+	requireBalance(t, r, alice, 6)
+
+	schedules, err = r.FindScheduledTransfers(ctx, bob)
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+	require.Equal(t, hourly.ID, schedules[0].ID)
+	require.Equal(t, model.ScheduledRunSucceeded, schedules[0].LastRun.Status)
+}
+
+func testConcurrentSendCoins(t *testing.T, h Harness) {
+	const (
+		senders   = 8
+		transfers = 25
+		balance   = 100
+	)
+
+	r := h.Repo
+	users := seedUsers(t, r, 4, balance)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, senders)
+
+	for range senders {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range transfers {
+				from := rand.IntN(len(users))
+				to := (from + 1 + rand.IntN(len(users)-1)) % len(users)
+
+				err := r.SendCoins(context.Background(), users[from], users[to],
+					1+rand.Int64N(balance/2), model.TransferNote{})
+				if err != nil && !errors.Is(err, repo.ErrInsufficient) {
+					errs <- err
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	requireTotal(t, r, users, int64(len(users))*balance)
+
+	if h.CheckCoins != nil {
+		h.CheckCoins(t, users, int64(len(users))*balance)
+	}
+}
+
+func testConcurrentBuyProduct(t *testing.T, h Harness) {
+	const (
+		price    = 10
+		stock    = 10
+		buyers   = 4
+		attempts = 30
+	)
+
+	r := h.Repo
+	users := seedUsers(t, r, buyers, 50)
+
+	pen, err := r.FindProductByTitle(context.Background(), "pen")
+	require.NoError(t, err)
+	h.SetStock(t, pen.ID, stock)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, attempts)
+
+	for i := range attempts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := r.BuyProduct(context.Background(), users[i%buyers],
+				model.Purchase{Product: "pen"})
+			switch {
+			case err == nil,
+				errors.Is(err, repo.ErrInsufficient),
+				errors.Is(err, repo.ErrOutOfStock),
+				errors.Is(err, repo.ErrTxRetriesExhausted):
+			default:
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	var orders int64
+
+	for _, u := range users {
+		bought, err := r.FindOrdersByUserID(context.Background(), u)
+		require.NoError(t, err)
+
+		orders += int64(len(bought))
+	}
+
+	require.LessOrEqual(t, orders, int64(stock))
+
+	pen, err = r.FindProductByID(context.Background(), pen.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, stock-orders, *pen.Stock)
+
+	requireTotal(t, r, users, buyers*50-orders*price)
+
+	if h.CheckCoins != nil {
+		h.CheckCoins(t, users, buyers*50-orders*price)
+	}
+}
+
+func requireBalance(t *testing.T, r repo.MerchRepo, userId uuid.UUID, want int64) {
+	t.Helper()
+
+	u, err := r.FindUserByID(context.Background(), userId)
+	require.NoError(t, err)
+	require.Equal(t, want, u.Balance)
+}
+
+// requireTotal fails unless the users hold want coins between them and none
+// has a negative balance.
+func requireTotal(t *testing.T, r repo.MerchRepo, users []uuid.UUID, want int64) {
+	t.Helper()
+
+	var total int64
+
+	for _, id := range users {
+		u, err := r.FindUserByID(context.Background(), id)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, u.Balance, int64(0))
+
+		total += u.Balance
+	}
+
+	require.Equal(t, want, total)
+}
+
+func seedUsers(t *testing.T, r repo.MerchRepo, n int, balance int64) []uuid.UUID {
+	t.Helper()
+
+	ctx := context.Background()
+	ids := make([]uuid.UUID, n)
+
+	for i := range ids {
+		u, err := r.CreateUser(ctx, fmt.Sprintf("user-%d-%s", i, uuid.NewString()[:8]), "x")
+		require.NoError(t, err)
+
+		if balance > 0 {
+			_, err = r.AdjustBalance(ctx, u.ID, balance, "test")
+			require.NoError(t, err)
+		}
+
+		ids[i] = u.ID
+	}
+
+	return ids
+}
+
+func titles(products []model.Product) []string {
+	titles := make([]string, len(products))
+	for i, p := range products {
+		titles[i] = p.Title
+	}
+
+	return titles
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATEs worth running a transaction again for.
+const (
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+)
+
+// RetryPolicy decides whether a failed transaction attempt is retried.
+type RetryPolicy interface {
+	// Backoff returns how long to wait before retrying after attempt, the
+	// first being 1, failed with err; ok is false if err is not worth a retry.
+	Backoff(err error, attempt int) (wait time.Duration, ok bool)
+}
+
+// BackoffPolicy retries the Postgres errors listed in Codes with exponential
+// backoff and full jitter: the wait after attempt n is picked at random from
+// [0, min(Max, Base*2^(n-1))], so contending transactions spread out.
+type BackoffPolicy struct {
+	Codes []string
+	Base  time.Duration
+	Max   time.Duration
+
+	// rand returns a number in [0, 1); tests pin it.
+	rand func() float64
+}
+
+func DefaultRetryPolicy() BackoffPolicy {
+	return BackoffPolicy{
+		Codes: []string{CodeSerializationFailure, CodeDeadlockDetected},
+		Base:  5 * time.Millisecond,   //nolint:mnd
+		Max:   500 * time.Millisecond, //nolint:mnd
+	}
+}
+
+func (p BackoffPolicy) Backoff(err error, attempt int) (time.Duration, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || !slices.Contains(p.Codes, pgErr.Code) {
+		return 0, false
+	}
+
+	// Base<<shift is compared as Base against Max>>shift, which cannot
+	// overflow however large either is.
+	ceiling := p.Max
+	if shift := max(attempt-1, 0); shift < 63 && p.Base <= p.Max>>shift { //nolint:mnd
+		ceiling = p.Base << shift
+	}
+
+	random := rand.Float64
+	if p.rand != nil {
+		random = p.rand
+	}
+
+	return time.Duration(random() * float64(ceiling)), true
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for every transaction of the repo.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(r *Repo) {
+		r.retry = p
+	}
+}
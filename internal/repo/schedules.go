@@ -0,0 +1,378 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/cron"
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrScheduleTransition = errors.New("schedule cannot change to that status")
+
+const (
+	// ScheduleMaxAttempts is how many passes in a row a schedule may hit an
+	// error ScheduledRunResult returns before its run is recorded as failed.
+	ScheduleMaxAttempts = 5
+	// ScheduleRetryAfter is how long a schedule waits after such an error,
+	// so that the other due schedules still run.
+	ScheduleRetryAfter = time.Minute
+)
+
+// scheduleColumns is the select list scanSchedule expects; it needs
+// scheduleJoins.
+const scheduleColumns = `
+	s.id, s.from_user_id, s.to_user_id, u.username, s.amount, s.memo, s.category,
+	s.recurrence, s.status, s.next_run_at, s.created_at,
+	lr.scheduled_for, lr.status, lr.error, lr.created_at`
+
+const scheduleJoins = `
+	FROM merch_shop.scheduled_transfers AS s
+	JOIN merch_shop.users AS u ON u.id = s.to_user_id
+	LEFT JOIN LATERAL (
+		SELECT scheduled_for, status, error, created_at
+		FROM merch_shop.scheduled_transfer_runs
+		WHERE schedule_id = s.id
+		ORDER BY created_at DESC
+		LIMIT 1
+	) AS lr ON true`
+
+func scanSchedule(row pgx.Row, s *model.ScheduledTransfer) error {
+	var (
+		runFor, runAt       *time.Time
+		runStatus, runError *string
+	)
+
+	if err := row.Scan(
+		&s.ID, &s.FromUserID, &s.ToUserID, &s.ToUserName, &s.Amount, &s.Note.Memo, &s.Note.Category,
+		&s.Recurrence, &s.Status, &s.NextRunAt, &s.CreatedAt,
+		&runFor, &runStatus, &runError, &runAt,
+	); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if runStatus != nil {
+		s.LastRun = &model.ScheduledRun{
+			ScheduledFor: *runFor,
+			Status:       model.ScheduledRunStatus(*runStatus),
+			Error:        *runError,
+			CreatedAt:    *runAt,
+		}
+	}
+
+	return nil
+}
+
+// CreateScheduledTransfer stores a schedule that first runs at s.NextRunAt.
+func (r *Repo) CreateScheduledTransfer(
+	ctx context.Context,
+	s model.ScheduledTransfer,
+) (model.ScheduledTransfer, error) {
+	if err := CheckTransfer(s.FromUserID, s.ToUserID, s.Amount); err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+
+	q := r.runner(ctx)
+
+	var id uuid.UUID
+
+	if err := q.QueryRow(ctx, `
+		INSERT INTO merch_shop.scheduled_transfers
+			(from_user_id, to_user_id, amount, memo, category, recurrence, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, s.FromUserID, s.ToUserID, s.Amount, s.Note.Memo, s.Note.Category, s.Recurrence, s.NextRunAt,
+	).Scan(&id); err != nil {
+		return model.ScheduledTransfer{}, fmt.Errorf("create scheduled transfer: %w", err)
+	}
+
+	return r.findSchedule(ctx, `s.id = $1`, id)
+}
+
+func (r *Repo) findSchedule(
+	ctx context.Context,
+	where string,
+	args ...any,
+) (model.ScheduledTransfer, error) {
+	q := r.runner(ctx)
+
+	var s model.ScheduledTransfer
+
+	row := q.QueryRow(ctx, `SELECT `+scheduleColumns+scheduleJoins+` WHERE `+where, args...)
+	if err := scanSchedule(row, &s); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, ErrNotFound
+		}
+
+		return s, fmt.Errorf("get query row sql: %w", err)
+	}
+
+	return s, nil
+}
+
+// FindScheduledTransfers lists the schedules the user set up, newest first.
+func (r *Repo) FindScheduledTransfers(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]model.ScheduledTransfer, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT `+scheduleColumns+scheduleJoins+`
+		WHERE s.from_user_id = $1
+		ORDER BY s.created_at DESC, s.id
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var schedules []model.ScheduledTransfer
+
+	for rows.Next() {
+		var s model.ScheduledTransfer
+		if err := scanSchedule(rows, &s); err != nil {
+			return schedules, fmt.Errorf("scan row: %w", err)
+		}
+
+		schedules = append(schedules, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// SetScheduledTransferStatus pauses, resumes or cancels a schedule of the
+// user. A resumed recurring schedule skips the runs it missed while paused.
+func (r *Repo) SetScheduledTransferStatus(
+	ctx context.Context,
+	userId, scheduleId uuid.UUID,
+	status model.ScheduleStatus,
+) (model.ScheduledTransfer, error) {
+	var schedule model.ScheduledTransfer
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		q := r.runner(txCtx)
+
+		var (
+			current    model.ScheduleStatus
+			recurrence string
+			next       *time.Time
+			now        time.Time
+		)
+
+		// localtimestamp is now() as the TIMESTAMP next_run_at is kept in.
+		err := q.QueryRow(txCtx, `
+			SELECT status, recurrence, next_run_at, localtimestamp
+			FROM merch_shop.scheduled_transfers
+			WHERE id = $1 AND from_user_id = $2
+			FOR UPDATE
+		`, scheduleId, userId).Scan(&current, &recurrence, &next, &now)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+
+			return fmt.Errorf("get query row sql: %w", err)
+		}
+
+		if !current.CanChangeTo(status) {
+			return fmt.Errorf("set schedule status: %w", ErrScheduleTransition)
+		}
+
+		switch {
+		case status == model.ScheduleCancelled:
+			next = nil
+		case status == model.ScheduleActive && recurrence != "" && next != nil && next.Before(now):
+			if next, err = nextRun(recurrence, now); err != nil {
+				return err
+			}
+		}
+
+		if _, err := q.Exec(txCtx, `
+			UPDATE merch_shop.scheduled_transfers
+			SET status = $2, next_run_at = $3
+			WHERE id = $1
+		`, scheduleId, status, next); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		schedule, err = r.findSchedule(txCtx, `s.id = $1`, scheduleId)
+
+		return err
+	}, nil)
+
+	return schedule, err
+}
+
+// RunDueScheduledTransfers makes every transfer that is due, one
+// transaction each, and returns how many schedules ran. A schedule whose
+// transfer hits an unexpected error is put off by ScheduleRetryAfter and
+// the pass goes on with the others.
+//
+// There is no catching up: a recurring schedule that missed several runs,
+// say while no instance was up, runs once for the earliest of them and
+// moves on to its first run after the database's now(); the runs in
+// between leave no record.
+func (r *Repo) RunDueScheduledTransfers(ctx context.Context) (int64, error) {
+	var n int64
+
+	for {
+		claimed, ran, err := r.runDueScheduledTransfer(ctx)
+		if err != nil || !claimed {
+			return n, err
+		}
+
+		if ran {
+			n++
+		}
+	}
+}
+
+// runDueScheduledTransfer claims one due schedule, sends the coins through
+// SendCoins, records the run and moves the schedule on to its next run.
+// Schedules claimed by other instances are skipped.
+func (r *Repo) runDueScheduledTransfer(ctx context.Context) (bool, bool, error) {
+	var claimed, ran bool
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		claimed, ran = false, false
+		q := r.runner(txCtx)
+
+		var (
+			s        model.ScheduledTransfer
+			due, now time.Time
+			attempts int
+		)
+
+		err := q.QueryRow(txCtx, `
+			SELECT id, from_user_id, to_user_id, amount, memo, category, recurrence, next_run_at, attempts,
+			       localtimestamp
+			FROM merch_shop.scheduled_transfers
+			WHERE status = 'active' AND next_run_at <= now()
+			ORDER BY next_run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		`).Scan(
+			&s.ID, &s.FromUserID, &s.ToUserID, &s.Amount, &s.Note.Memo, &s.Note.Category,
+			&s.Recurrence, &due, &attempts, &now,
+		)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+
+			return fmt.Errorf("get query row sql: %w", err)
+		}
+
+		claimed = true
+
+		sendErr := r.withSavepoint(txCtx, func(spCtx context.Context) error {
+			return r.SendCoins(spCtx, s.FromUserID, s.ToUserID, s.Amount, s.Note)
+		})
+
+		run, err := ScheduledRunResult(sendErr)
+		if err != nil {
+			if attempts+1 < ScheduleMaxAttempts {
+				return r.retryScheduledTransfer(txCtx, s.ID)
+			}
+
+			run = model.ScheduledRun{Status: model.ScheduledRunFailed, Error: err.Error()}
+		}
+
+		if _, err := q.Exec(txCtx, `
+			INSERT INTO merch_shop.scheduled_transfer_runs (schedule_id, scheduled_for, status, error)
+			VALUES ($1, $2, $3, $4)
+		`, s.ID, due, run.Status, run.Error); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		status, next := model.ScheduleCompleted, (*time.Time)(nil)
+		if s.Recurrence != "" {
+			if next, err = nextRun(s.Recurrence, now); err != nil {
+				return err
+			}
+
+			if next != nil {
+				status = model.ScheduleActive
+			}
+		}
+
+		if _, err := q.Exec(txCtx, `
+			UPDATE merch_shop.scheduled_transfers
+			SET status = $2, next_run_at = $3, attempts = 0
+			WHERE id = $1
+		`, s.ID, status, next); err != nil {
+			return fmt.Errorf("exec sql: %w", err)
+		}
+
+		ran = true
+
+		return nil
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10}) //nolint:mnd
+
+	return claimed, ran, err
+}
+
+// retryScheduledTransfer counts a failed attempt and puts the schedule off
+// by ScheduleRetryAfter.
+func (r *Repo) retryScheduledTransfer(ctx context.Context, scheduleId uuid.UUID) error {
+	q := r.runner(ctx)
+
+	if _, err := q.Exec(ctx, `
+		UPDATE merch_shop.scheduled_transfers
+		SET attempts = attempts + 1, next_run_at = now() + make_interval(secs => $2)
+		WHERE id = $1
+	`, scheduleId, ScheduleRetryAfter.Seconds()); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+// ScheduledRunResult turns what SendCoins returned into the run to record.
+// Errors that may go away on their own, like a lost connection, are
+// returned instead, and the schedule is tried again ScheduleRetryAfter later.
+func ScheduledRunResult(sendErr error) (model.ScheduledRun, error) {
+	var policyErr *TransferPolicyError
+
+	switch {
+	case sendErr == nil:
+		return model.ScheduledRun{Status: model.ScheduledRunSucceeded}, nil
+	case errors.Is(sendErr, ErrInsufficient):
+		return model.ScheduledRun{
+			Status: model.ScheduledRunSkipped,
+			Error:  ErrInsufficient.Error(),
+		}, nil
+	case errors.As(sendErr, &policyErr),
+		errors.Is(sendErr, ErrNotFound),
+		errors.Is(sendErr, ErrTransferToSelf),
+		errors.Is(sendErr, ErrAmountMustBePositive):
+		return model.ScheduledRun{Status: model.ScheduledRunFailed, Error: sendErr.Error()}, nil
+	default:
+		return model.ScheduledRun{}, sendErr
+	}
+}
+
+// nextRun is the first match of recurrence after now, nil if there is none.
+func nextRun(recurrence string, now time.Time) (*time.Time, error) {
+	schedule, err := cron.Parse(recurrence)
+	if err != nil {
+		return nil, fmt.Errorf("next run: %w", err)
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &next, nil
+}
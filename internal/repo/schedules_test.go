@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduledRunResult(t *testing.T) {
+	cases := []struct {
+		err  error
+		want model.ScheduledRunStatus
+	}{
+		{nil, model.ScheduledRunSucceeded},
+		{fmt.Errorf("add to balance: %w", ErrInsufficient), model.ScheduledRunSkipped},
+		{
+			fmt.Errorf("send coins: %w", &TransferPolicyError{Code: TransferCodeDailyCap}),
+			model.ScheduledRunFailed,
+		},
+		{ErrNotFound, model.ScheduledRunFailed},
+	}
+
+	for _, tc := range cases {
+		run, err := ScheduledRunResult(tc.err)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, run.Status, tc.err)
+	}
+
+	_, err := ScheduledRunResult(errors.New("conn reset"))
+	require.Error(t, err)
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+
+	next, err := nextRun("0 9 1 * *", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2025, 12, 1, 9, 0, 0, 0, time.UTC), *next)
+
+	next, err = nextRun("0 0 31 2 *", now)
+	require.NoError(t, err)
+	require.Nil(t, next)
+
+	_, err = nextRun("bad", now)
+	require.Error(t, err)
+}
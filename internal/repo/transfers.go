@@ -12,15 +12,18 @@ func (r *Repo) CreateTransfer(
 	ctx context.Context,
 	fromID, toID uuid.UUID,
 	amount int64,
+	note model.TransferNote,
 ) (model.Transfer, error) {
 	q := r.runner(ctx)
 
 	var t model.Transfer
 	if err := q.QueryRow(ctx, `
-		INSERT INTO merch_shop.transfers (from_user_id, to_user_id, amount)
-		VALUES ($1, $2, $3)
-		RETURNING id, from_user_id, to_user_id, amount, created_at
-	`, fromID, toID, amount).Scan(&t.ID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.CreatedAt); err != nil {
+		INSERT INTO merch_shop.transfers (from_user_id, to_user_id, amount, memo, category)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, from_user_id, to_user_id, amount, memo, category, status, created_at
+	`, fromID, toID, amount, note.Memo, note.Category).Scan(
+		&t.ID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.Memo, &t.Category, &t.Status, &t.CreatedAt,
+	); err != nil {
 		return t, fmt.Errorf("create transfer: %w", err)
 	}
 
@@ -28,13 +31,14 @@ func (r *Repo) CreateTransfer(
 }
 
 func (r *Repo) FindTransfersFromID(ctx context.Context, id uuid.UUID) ([]model.Transfer, error) {
-	q := r.runner(ctx)
+	q := r.reader(ctx)
 
 	rows, err := q.Query(ctx, `
-		SELECT t.id, t.from_user_id, u.username, t.to_user_id, t.amount, t.created_at
+		SELECT t.id, t.from_user_id, t.to_user_id, u.username, t.amount, t.memo, t.category, t.created_at
 		FROM merch_shop.transfers AS t
 		JOIN merch_shop.users AS u ON t.to_user_id = u.id
-		WHERE t.from_user_id = $1
+		WHERE t.from_user_id = $1 AND t.status = 'accepted'
+		ORDER BY t.created_at DESC, t.id
 	`, id)
 	if err != nil {
 		return nil, fmt.Errorf("get query sql: %w", err)
@@ -46,7 +50,9 @@ func (r *Repo) FindTransfersFromID(ctx context.Context, id uuid.UUID) ([]model.T
 
 	for rows.Next() {
 		var t model.Transfer
-		if err := rows.Scan(&t.ID, &t.FromUserID, &t.FromUserName, &t.ToUserID, &t.Amount, &t.CreatedAt); err != nil {
+		if err := rows.Scan(
+			&t.ID, &t.FromUserID, &t.ToUserID, &t.ToUserName, &t.Amount, &t.Memo, &t.Category, &t.CreatedAt,
+		); err != nil {
 			return transfers, fmt.Errorf("check next row: %w", err)
 		}
 
@@ -61,13 +67,14 @@ func (r *Repo) FindTransfersFromID(ctx context.Context, id uuid.UUID) ([]model.T
 }
 
 func (r *Repo) FindTransfersToID(ctx context.Context, id uuid.UUID) ([]model.Transfer, error) {
-	q := r.runner(ctx)
+	q := r.reader(ctx)
 
 	rows, err := q.Query(ctx, `
-		SELECT t.id, t.from_user_id, t.to_user_id, u.username, t.amount, t.created_at
+		SELECT t.id, t.from_user_id, u.username, t.to_user_id, t.amount, t.memo, t.category, t.created_at
 		FROM merch_shop.transfers AS t
 		JOIN merch_shop.users AS u ON t.from_user_id = u.id
-		WHERE t.to_user_id = $1
+		WHERE t.to_user_id = $1 AND t.status = 'accepted'
+		ORDER BY t.created_at DESC, t.id
 	`, id)
 	if err != nil {
 		return nil, fmt.Errorf("get query sql: %w", err)
@@ -79,7 +86,55 @@ func (r *Repo) FindTransfersToID(ctx context.Context, id uuid.UUID) ([]model.Tra
 
 	for rows.Next() {
 		var t model.Transfer
-		if err := rows.Scan(&t.ID, &t.FromUserID, &t.ToUserID, &t.ToUserName, &t.Amount, &t.CreatedAt); err != nil {
+		if err := rows.Scan(
+			&t.ID, &t.FromUserID, &t.FromUserName, &t.ToUserID, &t.Amount, &t.Memo, &t.Category, &t.CreatedAt,
+		); err != nil {
+			return transfers, fmt.Errorf("check next row: %w", err)
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return transfers, nil
+}
+
+func (r *Repo) FindTransfersByUserID(
+	ctx context.Context,
+	userId uuid.UUID,
+	filter model.TransferFilter,
+) ([]model.Transfer, error) {
+	q := r.reader(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT t.id, t.from_user_id, fu.username, t.to_user_id, tu.username,
+		       t.amount, t.memo, t.category, t.status, t.expires_at, t.resolved_at, t.created_at
+		FROM merch_shop.transfers AS t
+		JOIN merch_shop.users AS fu ON t.from_user_id = fu.id
+		JOIN merch_shop.users AS tu ON t.to_user_id = tu.id
+		WHERE ((t.from_user_id = $1 AND $2::text <> 'received')
+		    OR (t.to_user_id = $1 AND $2::text <> 'sent'))
+		  AND ($3::text = '' OR t.category = $3)
+		ORDER BY t.created_at DESC, t.id
+		LIMIT $4 OFFSET $5
+	`, userId, string(filter.Direction), filter.Category, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var transfers []model.Transfer
+
+	for rows.Next() {
+		var t model.Transfer
+		if err := rows.Scan(
+			&t.ID, &t.FromUserID, &t.FromUserName, &t.ToUserID, &t.ToUserName,
+			&t.Amount, &t.Memo, &t.Category, &t.Status, &t.ExpiresAt, &t.ResolvedAt, &t.CreatedAt,
+		); err != nil {
 			return transfers, fmt.Errorf("check next row: %w", err)
 		}
 
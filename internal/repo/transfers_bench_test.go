@@ -0,0 +1,115 @@
+//go:build integration
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/6ermvH/MerchShop/internal/pgtest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	hotAccounts  = 4
+	startBalance = 1_000_000
+)
+
+// countingPolicy counts the retries of the policy it wraps.
+type countingPolicy struct {
+	RetryPolicy
+
+	retries atomic.Int64
+}
+
+func (p *countingPolicy) Backoff(err error, attempt int) (time.Duration, bool) {
+	wait, ok := p.RetryPolicy.Backoff(err, attempt)
+	if ok {
+		p.retries.Add(1)
+	}
+
+	return wait, ok
+}
+
+// sendCoinsSerializable is SendCoins as it was before the users were locked
+// in ID order: Serializable, sender first and recipient second.
+func (r *Repo) sendCoinsSerializable(
+	ctx context.Context,
+	fromUserId, toUserId uuid.UUID,
+	amount int64,
+) error {
+	return r.WithTx(ctx, func(txCtx context.Context) error {
+		from, err := r.withdrawForTransfer(txCtx, fromUserId, toUserId, amount, nil)
+		if err != nil {
+			return err
+		}
+
+		transfer, err := r.CreateTransfer(txCtx, fromUserId, toUserId, amount, model.TransferNote{})
+		if err != nil {
+			return err
+		}
+
+		transfer.FromUserName = from.Username
+
+		return r.deliverTransfer(txCtx, transfer)
+	}, &TxOptions{Level: pgx.Serializable, MaxRetries: 10})
+}
+
+// BenchmarkHotAccountTransfers sends coins back and forth between a few
+// users from every goroutine and checks no coin is made or lost.
+//
+//	go test -tags integration -run '^$' \
+//		-bench HotAccountTransfers -cpu 16 ./internal/repo
+func BenchmarkHotAccountTransfers(b *testing.B) {
+	pool := pgtest.DB(b)
+
+	for _, bc := range []struct {
+		name string
+		send func(r *Repo, ctx context.Context, from, to uuid.UUID) error
+	}{
+		{"serializable", func(r *Repo, ctx context.Context, from, to uuid.UUID) error {
+			return r.sendCoinsSerializable(ctx, from, to, 1)
+		}},
+		{"ordered-locks", func(r *Repo, ctx context.Context, from, to uuid.UUID) error {
+			return r.SendCoins(ctx, from, to, 1, model.TransferNote{})
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			policy := &countingPolicy{RetryPolicy: DefaultRetryPolicy()}
+			r := NewRepo(pool, WithRetryPolicy(policy))
+			users := seedUsers(b, r, hotAccounts, startBalance)
+
+			var failed atomic.Int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				ctx := context.Background()
+
+				for pb.Next() {
+					from := rand.IntN(len(users))
+					to := (from + 1 + rand.IntN(len(users)-1)) % len(users)
+
+					err := bc.send(r, ctx, users[from], users[to])
+					switch {
+					case err == nil:
+					case errors.Is(err, ErrTxRetriesExhausted):
+						failed.Add(1)
+					default:
+						b.Error(err)
+					}
+				}
+			})
+			b.StopTimer()
+
+			b.ReportMetric(float64(policy.retries.Load())/float64(b.N), "retries/op")
+			b.ReportMetric(float64(failed.Load())/float64(b.N), "failed/op")
+			checkConserved(b, pool, users, hotAccounts*startBalance)
+		})
+	}
+}
@@ -15,6 +15,7 @@ type Runner interface {
 	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
 type Tx interface {
@@ -42,8 +43,31 @@ type TxOptions struct {
 	Level          pgx.TxIsoLevel
 	MaxRetries     int
 	AttemptTimeout time.Duration
+	// Retry overrides the repo's retry policy for this transaction.
+	Retry RetryPolicy
 }
 
+// ErrTxRetriesExhausted matches, with errors.Is, the *TxRetriesExhaustedError
+// WithTx returns when every attempt failed with a retryable error.
+var ErrTxRetriesExhausted = errors.New("transaction retries exhausted")
+
+type TxRetriesExhaustedError struct {
+	Attempts int
+	// Err is what the last attempt failed with.
+	Err error
+}
+
+func (e *TxRetriesExhaustedError) Error() string {
+	return fmt.Sprintf("%s after %d attempts: %v", ErrTxRetriesExhausted, e.Attempts, e.Err)
+}
+
+func (e *TxRetriesExhaustedError) Unwrap() []error {
+	return []error{ErrTxRetriesExhausted, e.Err}
+}
+
+// WithTx runs fn in a transaction, or straight in the one already in ctx.
+// Attempts that fail with an error the retry policy accepts are retried
+// after its backoff, as long as ctx leaves time for the wait.
 func (r *Repo) WithTx(
 	ctx context.Context,
 	fn func(txCtx context.Context) error,
@@ -55,20 +79,34 @@ func (r *Repo) WithTx(
 		return fn(ctx)
 	}
 
-	for attempt := 0; attempt <= retries; attempt++ {
+	policy := r.retry
+	if opts != nil && opts.Retry != nil {
+		policy = opts.Retry
+	}
+
+	for attempt := 1; ; attempt++ {
 		inner, cancel := withMaybeTimeout(ctx, timeout)
 		err := r.doTxAttempt(inner, fn, level)
 
 		cancel()
 
-		if shouldRetry(err, level, attempt, retries) {
-			continue
+		if err == nil {
+			return nil
 		}
 
-		return err
-	}
+		wait, retryable := policy.Backoff(err, attempt)
+		if !retryable {
+			return err
+		}
 
-	return nil
+		if attempt > retries {
+			return &TxRetriesExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		if waitErr := sleepCtx(ctx, wait); waitErr != nil {
+			return fmt.Errorf("wait to retry transaction: %w (last attempt: %w)", waitErr, err)
+		}
+	}
 }
 
 func (r *Repo) doTxAttempt(
@@ -126,12 +164,47 @@ func withMaybeTimeout(ctx context.Context, d time.Duration) (context.Context, co
 	return context.WithTimeout(ctx, d)
 }
 
-func shouldRetry(err error, level pgx.TxIsoLevel, attempt, retries int) bool {
-	return err != nil && isSerialization(err) && level == pgx.Serializable && attempt < retries
+// sleepCtx waits for d, giving up at once if ctx would end first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-t.C:
+		return nil
+	}
 }
 
-func isSerialization(err error) bool {
-	var pgErr *pgconn.PgError
+// withSavepoint runs fn in a savepoint of the transaction in ctx, so a
+// failing fn is undone while the transaction carries on.
+func (r *Repo) withSavepoint(ctx context.Context, fn func(spCtx context.Context) error) error {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	if !ok || tx == nil {
+		return r.WithTx(ctx, fn, nil)
+	}
+
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin savepoint: %w", err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, sp)); err != nil {
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("rollback savepoint: %w", rbErr)
+		}
+
+		return err
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
 
-	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+	return nil
 }
@@ -0,0 +1,223 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB hands out transactions whose commits fail with the queued errors
+// and then succeed.
+type fakeDB struct {
+	DB
+
+	commitErrs []error
+	begins     int
+	levels     []pgx.TxIsoLevel
+}
+
+func (db *fakeDB) BeginTx(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	db.begins++
+	db.levels = append(db.levels, opts.IsoLevel)
+
+	var err error
+	if len(db.commitErrs) > 0 {
+		err, db.commitErrs = db.commitErrs[0], db.commitErrs[1:]
+	}
+
+	return &fakeTx{commitErr: err}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+
+	commitErr error
+}
+
+func (tx *fakeTx) Commit(context.Context) error   { return tx.commitErr }
+func (tx *fakeTx) Rollback(context.Context) error { return nil }
+
+func pgError(code string) error {
+	return &pgconn.PgError{Code: code}
+}
+
+// noWait retries the default codes without sleeping.
+var noWait = BackoffPolicy{
+	Codes: DefaultRetryPolicy().Codes,
+	rand:  func() float64 { return 0 },
+}
+
+func TestWithTxRetries(t *testing.T) {
+	t.Parallel()
+
+	serialization := pgError(CodeSerializationFailure)
+	deadlock := pgError(CodeDeadlockDetected)
+	uniqueViolation := pgError("23505")
+
+	tests := []struct {
+		name       string
+		commitErrs []error
+		opts       *TxOptions
+		wantBegins int
+		wantErr    error
+	}{
+		{
+			name:       "succeeds after serialization failures",
+			commitErrs: []error{serialization, serialization},
+			opts:       &TxOptions{Level: pgx.Serializable},
+			wantBegins: 3,
+		},
+		{
+			name:       "retries deadlocks at read committed",
+			commitErrs: []error{deadlock},
+			wantBegins: 2,
+		},
+		{
+			name:       "does not retry other errors",
+			commitErrs: []error{uniqueViolation},
+			wantBegins: 1,
+			wantErr:    uniqueViolation,
+		},
+		{
+			name:       "codes are configurable",
+			commitErrs: []error{deadlock},
+			opts: &TxOptions{Retry: BackoffPolicy{
+				Codes: []string{CodeSerializationFailure},
+			}},
+			wantBegins: 1,
+			wantErr:    deadlock,
+		},
+		{
+			name:       "gives up after max retries",
+			commitErrs: []error{serialization, deadlock, serialization},
+			opts:       &TxOptions{MaxRetries: 2},
+			wantBegins: 3,
+			wantErr:    ErrTxRetriesExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &fakeDB{commitErrs: tt.commitErrs}
+			r := NewRepo(db, WithRetryPolicy(noWait))
+
+			err := r.WithTx(context.Background(), func(context.Context) error { return nil }, tt.opts)
+
+			require.Equal(t, tt.wantBegins, db.begins)
+
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWithTxRetriesExhaustedCarriesAttempts(t *testing.T) {
+	t.Parallel()
+
+	db := &fakeDB{commitErrs: []error{
+		pgError(CodeDeadlockDetected),
+		pgError(CodeDeadlockDetected),
+	}}
+	r := NewRepo(db, WithRetryPolicy(noWait))
+
+	opts := &TxOptions{MaxRetries: 1}
+	err := r.WithTx(context.Background(), func(context.Context) error { return nil }, opts)
+
+	var exhausted *TxRetriesExhaustedError
+	require.ErrorAs(t, err, &exhausted)
+	require.Equal(t, 2, exhausted.Attempts)
+
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	require.Equal(t, CodeDeadlockDetected, pgErr.Code)
+}
+
+func TestWithTxStopsAtDeadline(t *testing.T) {
+	t.Parallel()
+
+	db := &fakeDB{commitErrs: []error{pgError(CodeSerializationFailure)}}
+	r := NewRepo(db, WithRetryPolicy(BackoffPolicy{
+		Codes: []string{CodeSerializationFailure},
+		Base:  time.Hour,
+		Max:   time.Hour,
+		rand:  func() float64 { return 1 },
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := r.WithTx(ctx, func(context.Context) error { return nil }, nil)
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, 1, db.begins)
+}
+
+func TestWithTxNestedRunsInOuterTx(t *testing.T) {
+	t.Parallel()
+
+	db := &fakeDB{}
+	r := NewRepo(db)
+
+	err := r.WithTx(context.Background(), func(ctx context.Context) error {
+		return r.WithTx(ctx, func(context.Context) error { return nil }, nil)
+	}, &TxOptions{Level: pgx.Serializable})
+
+	require.NoError(t, err)
+	require.Equal(t, 1, db.begins)
+	require.Equal(t, []pgx.TxIsoLevel{pgx.Serializable}, db.levels)
+}
+
+func TestBackoffPolicy(t *testing.T) {
+	t.Parallel()
+
+	p := BackoffPolicy{
+		Codes: []string{CodeSerializationFailure},
+		Base:  10 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+		rand:  func() float64 { return 0.5 },
+	}
+
+	// Base<<(attempt-1) overflows int64 for these, but Max still caps them.
+	huge := p
+	huge.Base, huge.Max = 1<<40, 1<<62
+
+	for _, tt := range []struct {
+		p       BackoffPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{p, 1, 5 * time.Millisecond},
+		{p, 2, 10 * time.Millisecond},
+		{p, 4, 40 * time.Millisecond},
+		{p, 5, 50 * time.Millisecond},
+		{p, 64, 50 * time.Millisecond},
+		{huge, 1, 1 << 39},
+		{huge, 23, 1 << 61},
+		{huge, 30, 1 << 61},
+		{huge, 100, 1 << 61},
+	} {
+		wait, ok := tt.p.Backoff(pgError(CodeSerializationFailure), tt.attempt)
+		require.True(t, ok)
+		require.Equal(t, tt.want, wait, "base %v, attempt %d", tt.p.Base, tt.attempt)
+	}
+
+	_, ok := p.Backoff(pgError(CodeDeadlockDetected), 1)
+	require.False(t, ok)
+
+	_, ok = p.Backoff(errors.New("boom"), 1)
+	require.False(t, ok)
+}
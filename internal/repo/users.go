@@ -21,9 +21,9 @@ func (r *Repo) FindUserByID(ctx context.Context, id uuid.UUID) (model.User, erro
 	var u model.User
 
 	err := q.QueryRow(ctx, `
-		SELECT id, username, password_hash, balance, created_at
+		SELECT id, username, password_hash, balance, role, created_at
 		FROM merch_shop.users WHERE id=$1
-	`, id).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.CreatedAt)
+	`, id).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.Role, &u.CreatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return model.User{}, ErrNotFound
@@ -41,9 +41,9 @@ func (r *Repo) FindUserByUsername(ctx context.Context, username string) (model.U
 	var u model.User
 
 	err := q.QueryRow(ctx, `
-		SELECT id, username, password_hash, balance, created_at
+		SELECT id, username, password_hash, balance, role, created_at
 		FROM merch_shop.users WHERE username=$1
-	`, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.CreatedAt)
+	`, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.Role, &u.CreatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return model.User{}, ErrNotFound
@@ -55,11 +55,44 @@ func (r *Repo) FindUserByUsername(ctx context.Context, username string) (model.U
 	return u, nil
 }
 
+// AddToBalance credits delta coins as a new lot, or debits them from the
+// user's oldest lots first.
 func (r *Repo) AddToBalance(
 	ctx context.Context,
 	userId uuid.UUID,
 	delta int64,
 ) (model.User, error) {
+	return r.changeBalance(ctx, userId, delta, nil)
+}
+
+// changeBalance is AddToBalance; a debit with a ref books the coins it takes
+// from each lot against ref, so that refundCoins can put them back.
+func (r *Repo) changeBalance(
+	ctx context.Context,
+	userId uuid.UUID,
+	delta int64,
+	ref *uuid.UUID,
+) (model.User, error) {
+	cur, err := r.lockBalance(ctx, userId)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	newBal := cur + delta
+	if newBal < 0 {
+		return model.User{}, fmt.Errorf("add to balance: %w", ErrInsufficient)
+	}
+
+	if err := r.moveCoinLots(ctx, userId, delta, ref); err != nil {
+		return model.User{}, err
+	}
+
+	return r.setBalance(ctx, userId, newBal, delta)
+}
+
+// lockBalance locks the user's row for a balance change. Every change to
+// the balance or the coin lots of a user holds this lock.
+func (r *Repo) lockBalance(ctx context.Context, userId uuid.UUID) (int64, error) {
 	q := r.runner(ctx)
 
 	var cur int64
@@ -67,27 +100,80 @@ func (r *Repo) AddToBalance(
 		SELECT balance FROM merch_shop.users WHERE id=$1 FOR UPDATE
 	`, userId).Scan(&cur); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return model.User{}, ErrNotFound
+			return 0, ErrNotFound
 		}
 
-		return model.User{}, fmt.Errorf("scan row: %w", err)
+		return 0, fmt.Errorf("scan row: %w", err)
 	}
 
-	newBal := cur + delta
-	if newBal < 0 {
-		return model.User{}, fmt.Errorf("add to balance: %w", ErrInsufficient)
+	return cur, nil
+}
+
+// lockUsers takes lockBalance on several users at once, in ID order, so
+// transactions locking the same users never wait on each other in a cycle.
+func (r *Repo) lockUsers(ctx context.Context, ids ...uuid.UUID) error {
+	q := r.runner(ctx)
+
+	// FOR UPDATE locks the rows as the sorted result is read.
+	rows, err := q.Query(ctx, `
+		SELECT id FROM merch_shop.users WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	locked := make(map[uuid.UUID]bool, len(ids))
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+
+		locked[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("check row: %w", err)
 	}
 
+	for _, id := range ids {
+		if !locked[id] {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) setBalance(
+	ctx context.Context,
+	userId uuid.UUID,
+	balance, delta int64,
+) (model.User, error) {
+	q := r.runner(ctx)
+
 	var u model.User
 	if err := q.QueryRow(ctx, `
 		UPDATE merch_shop.users
 		SET balance=$2
 		WHERE id=$1
-		RETURNING id, username, password_hash, balance, created_at
-	`, userId, newBal).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.CreatedAt); err != nil {
+		RETURNING id, username, password_hash, balance, role, created_at
+	`, userId, balance).Scan(
+		&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.Role, &u.CreatedAt,
+	); err != nil {
 		return u, fmt.Errorf("get query row sql: %w", err)
 	}
 
+	if err := r.publishEvent(ctx, userId, model.EventBalance, map[string]any{
+		"balance": u.Balance,
+		"delta":   delta,
+	}); err != nil {
+		return model.User{}, err
+	}
+
 	return u, nil
 }
 
@@ -98,8 +184,10 @@ func (r *Repo) CreateUser(ctx context.Context, username, passwordHash string) (m
 	if err := q.QueryRow(ctx, `
 		INSERT INTO merch_shop.users (username, password_hash)
 		VALUES ($1, $2)
-		RETURNING id, username, password_hash, balance, created_at
-	`, username, passwordHash).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.CreatedAt); err != nil {
+		RETURNING id, username, password_hash, balance, role, created_at
+	`, username, passwordHash).Scan(
+		&u.ID, &u.Username, &u.PasswordHash, &u.Balance, &u.Role, &u.CreatedAt,
+	); err != nil {
 		return u, fmt.Errorf("get query row sql: %w", err)
 	}
 
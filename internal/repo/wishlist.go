@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/6ermvH/MerchShop/internal/model"
+	"github.com/google/uuid"
+)
+
+// FindWishlist lists the user's wishlist, newest first, with each product's
+// current price including promotions that cover all its variants.
+func (r *Repo) FindWishlist(ctx context.Context, userId uuid.UUID) ([]model.WishlistItem, error) {
+	q := r.runner(ctx)
+
+	rows, err := q.Query(ctx, `
+		SELECT `+productColumns+`,
+		       COALESCE((
+		           SELECT min(pr.price)
+		           FROM merch_shop.promotions AS pr
+		           WHERE pr.product_id = p.id AND pr.variant_id IS NULL
+		             AND pr.starts_at <= now() AND now() < pr.ends_at
+		       ), p.price),
+		       w.created_at
+		FROM merch_shop.wishlist_items AS w
+		JOIN merch_shop.products AS p ON p.id = w.product_id
+		WHERE w.user_id = $1
+		ORDER BY w.created_at DESC, p.title
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get query sql: %w", err)
+	}
+
+	defer rows.Close()
+
+	var items []model.WishlistItem
+
+	for rows.Next() {
+		var (
+			item model.WishlistItem
+			p    = &item.Product
+		)
+
+		if err := rows.Scan(
+			&p.ID, &p.Title, &p.Price, &p.Description, &p.ImageURL, &p.Stock, &p.Available,
+			&item.Price, &item.AddedAt,
+		); err != nil {
+			return items, fmt.Errorf("scan row: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check row: %w", err)
+	}
+
+	return items, nil
+}
+
+// AddToWishlist is a no-op when the product is already on the wishlist.
+func (r *Repo) AddToWishlist(ctx context.Context, userId, productId uuid.UUID) error {
+	q := r.runner(ctx)
+
+	if _, err := q.Exec(ctx, `
+		INSERT INTO merch_shop.wishlist_items (user_id, product_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userId, productId); err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) RemoveFromWishlist(ctx context.Context, userId, productId uuid.UUID) error {
+	q := r.runner(ctx)
+
+	tag, err := q.Exec(ctx, `
+		DELETE FROM merch_shop.wishlist_items
+		WHERE user_id = $1 AND product_id = $2
+	`, userId, productId)
+	if err != nil {
+		return fmt.Errorf("exec sql: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS merch_shop.transfers_category_idx;
+
+ALTER TABLE merch_shop.transfers
+  DROP COLUMN IF EXISTS category,
+  DROP COLUMN IF EXISTS memo;
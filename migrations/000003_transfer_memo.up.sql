@@ -0,0 +1,6 @@
+ALTER TABLE merch_shop.transfers
+  ADD COLUMN IF NOT EXISTS memo VARCHAR(200) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS category VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS transfers_category_idx
+  ON merch_shop.transfers (category, created_at DESC) WHERE category <> '';
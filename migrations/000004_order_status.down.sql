@@ -0,0 +1,3 @@
+ALTER TABLE merch_shop.orders DROP COLUMN IF EXISTS status;
+ALTER TABLE merch_shop.products DROP COLUMN IF EXISTS stock;
+ALTER TABLE merch_shop.users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,11 @@
+ALTER TABLE merch_shop.users
+  ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin'));
+
+-- NULL stock means the product is not tracked and never runs out.
+ALTER TABLE merch_shop.products
+  ADD COLUMN IF NOT EXISTS stock BIGINT CHECK (stock >= 0);
+
+ALTER TABLE merch_shop.orders
+  ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'placed'
+    CHECK (status IN ('placed', 'fulfilled', 'cancelled', 'refunded'));
@@ -0,0 +1,22 @@
+DROP INDEX IF EXISTS merch_shop.orders_status_created_idx;
+
+ALTER TABLE merch_shop.orders
+  DROP CONSTRAINT IF EXISTS orders_status_check,
+  DROP COLUMN IF EXISTS refunded_at,
+  DROP COLUMN IF EXISTS cancelled_at,
+  DROP COLUMN IF EXISTS delivered_at,
+  DROP COLUMN IF EXISTS ready_for_pickup_at,
+  DROP COLUMN IF EXISTS packed_at;
+
+UPDATE merch_shop.orders SET status = 'placed' WHERE status IN ('packed', 'ready_for_pickup');
+UPDATE merch_shop.orders SET status = 'fulfilled' WHERE status = 'delivered';
+
+ALTER TABLE merch_shop.orders
+  ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('placed', 'fulfilled', 'cancelled', 'refunded'));
+
+UPDATE merch_shop.users SET role = 'user' WHERE role = 'staff';
+
+ALTER TABLE merch_shop.users
+  DROP CONSTRAINT IF EXISTS users_role_check,
+  ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
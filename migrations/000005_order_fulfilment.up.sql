@@ -0,0 +1,20 @@
+ALTER TABLE merch_shop.users
+  DROP CONSTRAINT IF EXISTS users_role_check,
+  ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'staff', 'admin'));
+
+ALTER TABLE merch_shop.orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+UPDATE merch_shop.orders SET status = 'delivered' WHERE status = 'fulfilled';
+
+ALTER TABLE merch_shop.orders
+  ADD CONSTRAINT orders_status_check CHECK (status IN (
+    'placed', 'packed', 'ready_for_pickup', 'delivered', 'cancelled', 'refunded'
+  )),
+  ADD COLUMN IF NOT EXISTS packed_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS ready_for_pickup_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS orders_status_created_idx
+  ON merch_shop.orders (status, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE merch_shop.orders DROP COLUMN IF EXISTS variant_id;
+
+DROP TABLE IF EXISTS merch_shop.product_variants;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS merch_shop.product_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES merch_shop.products (id) ON DELETE CASCADE,
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    attributes JSONB NOT NULL DEFAULT '{}'::jsonb,
+    -- NULL price falls back to products.price, NULL stock is not tracked.
+    price BIGINT CHECK (price >= 0),
+    stock BIGINT CHECK (stock >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS product_variants_product_idx
+  ON merch_shop.product_variants (product_id);
+
+ALTER TABLE merch_shop.orders
+  ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES merch_shop.product_variants (id);
+
+INSERT INTO merch_shop.product_variants (product_id, sku, attributes)
+SELECT p.id, p.title || '-' || lower(s.size), jsonb_build_object('size', s.size)
+FROM merch_shop.products AS p
+CROSS JOIN (VALUES ('S'), ('M'), ('L'), ('XL')) AS s (size)
+WHERE p.title IN ('t-shirt', 'hoody', 'pink-hoody')
+ON CONFLICT (sku) DO NOTHING;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS merch_shop.products_price_idx;
+DROP INDEX IF EXISTS merch_shop.products_title_trgm_idx;
+
+ALTER TABLE merch_shop.products
+  DROP COLUMN IF EXISTS image_url,
+  DROP COLUMN IF EXISTS description;
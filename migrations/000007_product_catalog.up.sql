@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE merch_shop.products
+  ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS image_url TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS products_title_trgm_idx
+  ON merch_shop.products USING gin (title gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS products_price_idx
+  ON merch_shop.products (price, title);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS merch_shop.orders_promo_code_user_idx;
+
+ALTER TABLE merch_shop.orders
+  DROP COLUMN IF EXISTS promo_code,
+  DROP COLUMN IF EXISTS price_paid;
+
+DROP TABLE IF EXISTS merch_shop.promo_codes;
+DROP TABLE IF EXISTS merch_shop.promotions;
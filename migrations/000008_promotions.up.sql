@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS merch_shop.promotions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES merch_shop.products (id) ON DELETE CASCADE,
+    -- NULL variant_id applies the promotion to the product and all its variants.
+    variant_id UUID REFERENCES merch_shop.product_variants (id) ON DELETE CASCADE,
+    price BIGINT NOT NULL CHECK (price >= 0),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK (starts_at < ends_at)
+);
+
+CREATE INDEX IF NOT EXISTS promotions_product_period_idx
+  ON merch_shop.promotions (product_id, starts_at, ends_at);
+
+CREATE TABLE IF NOT EXISTS merch_shop.promo_codes (
+    code VARCHAR(32) PRIMARY KEY CHECK (code = upper(code)),
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('percent', 'fixed')),
+    value BIGINT NOT NULL CHECK (value > 0 AND (kind <> 'percent' OR value <= 100)),
+    max_uses BIGINT CHECK (max_uses > 0),
+    per_user_limit BIGINT CHECK (per_user_limit > 0),
+    expires_at TIMESTAMP,
+    used_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE merch_shop.orders
+  ADD COLUMN IF NOT EXISTS price_paid BIGINT CHECK (price_paid >= 0),
+  ADD COLUMN IF NOT EXISTS promo_code VARCHAR(32) REFERENCES merch_shop.promo_codes (code);
+
+UPDATE merch_shop.orders AS o
+SET price_paid = COALESCE(
+    (SELECT v.price FROM merch_shop.product_variants AS v WHERE v.id = o.variant_id),
+    (SELECT p.price FROM merch_shop.products AS p WHERE p.id = o.product_id))
+WHERE o.price_paid IS NULL;
+
+ALTER TABLE merch_shop.orders ALTER COLUMN price_paid SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS orders_promo_code_user_idx
+  ON merch_shop.orders (promo_code, user_id) WHERE promo_code IS NOT NULL;
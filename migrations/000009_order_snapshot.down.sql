@@ -0,0 +1,5 @@
+ALTER TABLE merch_shop.orders
+  DROP COLUMN IF EXISTS quantity,
+  DROP COLUMN IF EXISTS unit_price,
+  DROP COLUMN IF EXISTS variant_sku,
+  DROP COLUMN IF EXISTS product_title;
@@ -0,0 +1,19 @@
+ALTER TABLE merch_shop.orders
+  ADD COLUMN IF NOT EXISTS product_title VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS variant_sku VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS unit_price BIGINT CHECK (unit_price >= 0),
+  ADD COLUMN IF NOT EXISTS quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0);
+
+-- Past orders get the catalog as it is now; nothing older was recorded.
+UPDATE merch_shop.orders AS o
+SET product_title = p.title,
+    variant_sku = COALESCE(
+      (SELECT v.sku FROM merch_shop.product_variants AS v WHERE v.id = o.variant_id), ''),
+    unit_price = COALESCE(
+      (SELECT v.price FROM merch_shop.product_variants AS v WHERE v.id = o.variant_id), p.price)
+FROM merch_shop.products AS p
+WHERE p.id = o.product_id AND o.unit_price IS NULL;
+
+ALTER TABLE merch_shop.orders
+  ALTER COLUMN product_title SET NOT NULL,
+  ALTER COLUMN unit_price SET NOT NULL;
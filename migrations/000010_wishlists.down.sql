@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merch_shop.notifications;
+DROP TABLE IF EXISTS merch_shop.wishlist_items;
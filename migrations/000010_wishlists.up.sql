@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS merch_shop.wishlist_items (
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES merch_shop.products (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS wishlist_items_product_idx
+  ON merch_shop.wishlist_items (product_id);
+
+CREATE TABLE IF NOT EXISTS merch_shop.notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_created_idx
+  ON merch_shop.notifications (user_id, created_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS merch_shop.notifications_user_unread_idx;
+DROP TABLE IF EXISTS merch_shop.notification_mutes;
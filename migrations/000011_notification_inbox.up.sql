@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS merch_shop.notification_mutes (
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_unread_idx
+  ON merch_shop.notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,13 @@
+-- events backs GET /api/stream: rows are inserted in the transaction that
+-- causes them and announced with pg_notify('merch_events') on commit; the
+-- table itself lets clients resume with Last-Event-ID.
+CREATE TABLE IF NOT EXISTS merch_shop.events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    type VARCHAR(32) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS events_user_id_idx ON merch_shop.events (user_id, id);
+CREATE INDEX IF NOT EXISTS events_created_at_idx ON merch_shop.events (created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS merch_shop.transfers_created_idx;
+
+ALTER TABLE merch_shop.users DROP COLUMN IF EXISTS leaderboard_opt_out;
@@ -0,0 +1,7 @@
+ALTER TABLE merch_shop.users
+  ADD COLUMN IF NOT EXISTS leaderboard_opt_out BOOLEAN NOT NULL DEFAULT false;
+
+-- Leaderboards scan every transfer in a window; covering the columns they
+-- aggregate keeps that an index-only scan.
+CREATE INDEX IF NOT EXISTS transfers_created_idx
+  ON merch_shop.transfers (created_at) INCLUDE (from_user_id, to_user_id, amount);
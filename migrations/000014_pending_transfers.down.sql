@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS merch_shop.transfers_pending_expires_idx;
+
+-- Coins held by pending transfers go back to their senders.
+UPDATE merch_shop.users AS u
+SET balance = u.balance + p.amount
+FROM (
+  SELECT from_user_id, sum(amount) AS amount
+  FROM merch_shop.transfers
+  WHERE status = 'pending'
+  GROUP BY from_user_id
+) AS p
+WHERE u.id = p.from_user_id;
+
+DELETE FROM merch_shop.transfers WHERE status IN ('pending', 'declined', 'expired');
+
+ALTER TABLE merch_shop.transfers
+  DROP CONSTRAINT IF EXISTS transfers_status_check,
+  DROP COLUMN IF EXISTS resolved_at,
+  DROP COLUMN IF EXISTS expires_at,
+  DROP COLUMN IF EXISTS status;
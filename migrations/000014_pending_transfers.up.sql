@@ -0,0 +1,11 @@
+ALTER TABLE merch_shop.transfers
+  ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'accepted',
+  ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP,
+  ADD CONSTRAINT transfers_status_check CHECK (status IN (
+    'pending', 'accepted', 'declined', 'expired'
+  ));
+
+CREATE INDEX IF NOT EXISTS transfers_pending_expires_idx
+  ON merch_shop.transfers (expires_at)
+  WHERE status = 'pending';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merch_shop.scheduled_transfer_runs;
+DROP TABLE IF EXISTS merch_shop.scheduled_transfers;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS merch_shop.scheduled_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    from_user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    to_user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    memo VARCHAR(200) NOT NULL DEFAULT '',
+    category VARCHAR(32) NOT NULL DEFAULT '',
+    -- recurrence is a cron expression; empty for a one-off transfer.
+    recurrence VARCHAR(64) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN (
+      'active', 'paused', 'cancelled', 'completed'
+    )),
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfers_due_idx
+  ON merch_shop.scheduled_transfers (next_run_at)
+  WHERE status = 'active';
+
+CREATE INDEX IF NOT EXISTS scheduled_transfers_from_idx
+  ON merch_shop.scheduled_transfers (from_user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS merch_shop.scheduled_transfer_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    schedule_id UUID NOT NULL REFERENCES merch_shop.scheduled_transfers (id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('succeeded', 'skipped', 'failed')),
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfer_runs_schedule_idx
+  ON merch_shop.scheduled_transfer_runs (schedule_id, created_at DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merch_shop.coin_ledger;
+DROP TABLE IF EXISTS merch_shop.coin_lots;
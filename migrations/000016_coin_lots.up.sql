@@ -0,0 +1,38 @@
+-- A lot is one credit to a user's balance. Debits take coins from the oldest
+-- lots first, and coins left in a lot past expires_at are written off.
+CREATE TABLE IF NOT EXISTS merch_shop.coin_lots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    remaining BIGINT NOT NULL CHECK (remaining >= 0 AND remaining <= amount),
+    granted_at TIMESTAMP NOT NULL DEFAULT now(),
+    -- expires_at is NULL for coins that never expire.
+    expires_at TIMESTAMP,
+    expired_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS coin_lots_user_open_idx
+  ON merch_shop.coin_lots (user_id, granted_at, id)
+  WHERE remaining > 0;
+
+CREATE INDEX IF NOT EXISTS coin_lots_expires_idx
+  ON merch_shop.coin_lots (expires_at)
+  WHERE remaining > 0;
+
+-- Balances from before lots were tracked get a lot from the app at startup,
+-- lasting COIN_TTL (see repo.BackfillCoinLots), since SQL cannot know it.
+-- Earlier versions of this migration credited them here with a fixed year;
+-- databases migrated by those already have the lots, and the startup pass
+-- finds nothing left to credit there.
+
+CREATE TABLE IF NOT EXISTS merch_shop.coin_ledger (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES merch_shop.users (id) ON DELETE CASCADE,
+    lot_id UUID REFERENCES merch_shop.coin_lots (id) ON DELETE SET NULL,
+    delta BIGINT NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS coin_ledger_user_created_idx
+  ON merch_shop.coin_ledger (user_id, created_at DESC);
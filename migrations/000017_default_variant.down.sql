@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS merch_shop.product_variants_default_idx;
+
+ALTER TABLE merch_shop.product_variants DROP COLUMN IF EXISTS is_default;
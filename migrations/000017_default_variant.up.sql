@@ -0,0 +1,11 @@
+ALTER TABLE merch_shop.product_variants
+  ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT false;
+
+CREATE UNIQUE INDEX IF NOT EXISTS product_variants_default_idx
+  ON merch_shop.product_variants (product_id) WHERE is_default;
+
+-- Purchases that name no variant, such as GET /api/buy/t-shirt from before
+-- variants, get size M.
+UPDATE merch_shop.product_variants
+SET is_default = true
+WHERE sku IN ('t-shirt-m', 'hoody-m', 'pink-hoody-m');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS merch_shop.coin_ledger_ref_idx;
+
+ALTER TABLE merch_shop.coin_ledger DROP COLUMN IF EXISTS ref_id;
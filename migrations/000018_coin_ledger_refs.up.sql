@@ -0,0 +1,7 @@
+-- ref_id is the order or held transfer coins were spent on, so that a refund
+-- puts them back into the lots they came from.
+ALTER TABLE merch_shop.coin_ledger ADD COLUMN IF NOT EXISTS ref_id UUID;
+
+CREATE INDEX IF NOT EXISTS coin_ledger_ref_idx
+  ON merch_shop.coin_ledger (ref_id)
+  WHERE ref_id IS NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE merch_shop.scheduled_transfers DROP COLUMN IF EXISTS attempts;
+
+ALTER TABLE merch_shop.scheduled_transfer_runs
+  ALTER COLUMN scheduled_for TYPE TIMESTAMP USING scheduled_for AT TIME ZONE 'UTC';
+
+ALTER TABLE merch_shop.scheduled_transfers
+  ALTER COLUMN next_run_at TYPE TIMESTAMP USING next_run_at AT TIME ZONE 'UTC';
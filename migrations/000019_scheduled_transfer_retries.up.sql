@@ -0,0 +1,11 @@
+-- Run times are compared with now(), so they are stored as instants; the
+-- times written so far were UTC.
+ALTER TABLE merch_shop.scheduled_transfers
+  ALTER COLUMN next_run_at TYPE TIMESTAMPTZ USING next_run_at AT TIME ZONE 'UTC';
+
+ALTER TABLE merch_shop.scheduled_transfer_runs
+  ALTER COLUMN scheduled_for TYPE TIMESTAMPTZ USING scheduled_for AT TIME ZONE 'UTC';
+
+-- attempts counts the passes in a row that hit an unexpected error.
+ALTER TABLE merch_shop.scheduled_transfers
+  ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
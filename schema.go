@@ -0,0 +1,10 @@
+// Package merchshop carries the OpenAPI document the API is generated from
+// and validated against.
+package merchshop
+
+import _ "embed"
+
+// Schema is schema.yaml.
+//
+//go:embed schema.yaml
+var Schema []byte